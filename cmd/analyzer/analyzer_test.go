@@ -3,6 +3,8 @@ package main
 import (
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -21,6 +23,10 @@ func TestAnalyzer(t *testing.T) {
 		args      []string
 		wantErr   bool
 		debugFlag bool
+		want      string
+		// baseline is a package directory whose findings are written to
+		// the baseline file first; args name the file baseline.json
+		baseline string
 	}{
 		{
 			name:      "missing input file",
@@ -34,11 +40,56 @@ func TestAnalyzer(t *testing.T) {
 			wantErr:   false,
 			debugFlag: true,
 		},
+		{
+			name:    "package directory",
+			args:    []string{"./analyzer", "-i", "../../internal/analyzer/testdata/lockset"},
+			wantErr: false,
+			want:    `"var": "(Server).hits"`,
+		},
+		{
+			name:    "module root",
+			args:    []string{"./analyzer", "-module", "-i", "../../internal/analyzer/testdata/module"},
+			wantErr: false,
+			want:    `"import_path": "example.com/shop/store"`,
+		},
+		{
+			name:    "write baseline",
+			args:    []string{"./analyzer", "-write-baseline", "baseline.json", "-i", "../../internal/analyzer/testdata/lockset"},
+			wantErr: false,
+			want:    "Wrote 7 findings to ",
+		},
+		{
+			name:     "findings in baseline",
+			args:     []string{"./analyzer", "-baseline", "baseline.json", "-i", "../../internal/analyzer/testdata/lockset"},
+			wantErr:  false,
+			want:     `"baselined": 7`,
+			baseline: "../../internal/analyzer/testdata/lockset",
+		},
+		{
+			name:     "findings not in baseline",
+			args:     []string{"./analyzer", "-baseline", "baseline.json", "-module", "-i", "../../internal/analyzer/testdata/module"},
+			wantErr:  true,
+			want:     "findings not in baseline ",
+			baseline: "../../internal/analyzer/testdata/lockset",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			path := filepath.Join(t.TempDir(), "baseline.json")
+			args := append([]string(nil), tt.args...)
+			for i, arg := range args {
+				if arg == "baseline.json" {
+					args[i] = path
+				}
+			}
+			if tt.baseline != "" {
+				if output, err := exec.Command("./analyzer", "-write-baseline", path, "-i", tt.baseline).CombinedOutput(); err != nil {
+					t.Fatalf("Failed to write baseline: %v\nOutput: %s", err, output)
+				}
+			}
+
+			cmd := exec.Command(args[0], args[1:]...)
 			output, err := cmd.CombinedOutput()
 
 			if tt.wantErr {
@@ -50,6 +101,9 @@ func TestAnalyzer(t *testing.T) {
 					t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
 				}
 			}
+			if tt.want != "" && !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
 		})
 	}
 }
@@ -5,13 +5,20 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/uber/data-race-skeletons/internal/analyzer"
 )
 
 func main() {
 	debug := flag.Bool("debug", false, "Enable debug mode")
-	inputFile := flag.String("i", "", "Input Go file to analyze")
+	inputFile := flag.String("i", "", "Input Go file, package directory, or module root with -module, to analyze")
+	module := flag.Bool("module", false, "Analyze every package of the module whose root is the input directory")
+	tests := flag.Bool("tests", false, "Include _test.go files when analyzing a package directory or module")
+	tags := flag.String("tags", "", "Comma-separated build tags to satisfy when selecting the files of a package")
+	baseline := flag.String("baseline", "", "Baseline file of accepted findings; only other findings are reported, and fail the run")
+	writeBaseline := flag.String("write-baseline", "", "Write the findings of a package directory or module to a baseline file")
+	goVersion := flag.String("go", "", "Go language version of the input, such as 1.21 (default: go directive of the nearest go.mod)")
 	flag.Parse()
 
 	if *inputFile == "" {
@@ -21,10 +28,62 @@ func main() {
 	}
 
 	analyzer.SetDebugMode(*debug)
-	result, err := analyzer.AnalyzeFile(*inputFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error analyzing file: %v\n", err)
+	analyzer.SetGoVersion(*goVersion)
+	opts := analyzer.ParseOptions{Tests: *tests}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			opts.Tags = append(opts.Tags, tag)
+		}
+	}
+	var result interface{}
+	var results []*analyzer.PackageResult
+	if *module {
+		m, err := analyzer.ParseModule(*inputFile, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing module: %v\n", err)
+			os.Exit(1)
+		}
+		results = analyzer.AnalyzeModule(m)
+		result = results
+	} else if info, err := os.Stat(*inputFile); err == nil && info.IsDir() {
+		pkgs, err := analyzer.ParseDir(*inputFile, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing package: %v\n", err)
+			os.Exit(1)
+		}
+		results = []*analyzer.PackageResult{}
+		for _, pkg := range pkgs {
+			results = append(results, analyzer.AnalyzePackage(pkg))
+		}
+		result = results
+	} else if *baseline != "" || *writeBaseline != "" {
+		fmt.Fprintf(os.Stderr, "Error: A baseline needs a package directory or module\n")
 		os.Exit(1)
+	} else {
+		result, err = analyzer.AnalyzeFile(*inputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error analyzing file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *writeBaseline != "" {
+		b := analyzer.NewBaseline(results)
+		if err := b.Write(*writeBaseline); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing baseline: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %d findings to %s\n", len(b.Findings), *writeBaseline)
+		return
+	}
+	left := 0
+	if *baseline != "" {
+		b, err := analyzer.ReadBaseline(*baseline)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading baseline: %v\n", err)
+			os.Exit(1)
+		}
+		left = b.Apply(results)
 	}
 
 	// Output result as JSON
@@ -34,4 +93,8 @@ func main() {
 		os.Exit(1)
 	}
 	fmt.Println(string(jsonData))
+	if left > 0 {
+		fmt.Fprintf(os.Stderr, "%d findings not in baseline %s\n", left, *baseline)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCFG(t *testing.T) {
+	// Build the cfg binary
+	cmd := exec.Command("go", "build", "-o", "cfg")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build cfg: %v", err)
+	}
+	defer os.Remove("cfg")
+
+	output := filepath.Join(t.TempDir(), "read1.dot")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input",
+			args:    []string{"./cfg"},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			args:    []string{"./cfg", "-i", "../../data/skeletons/missing.go"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown function",
+			args:    []string{"./cfg", "-i", "../../data/skeletons/D10447847/read1.go", "-func", "func9"},
+			wantErr: true,
+		},
+		{
+			name: "all functions",
+			args: []string{"./cfg", "-i", "../../data/skeletons/D10447847/read1.go"},
+			want: `digraph "func@10:15" {`,
+		},
+		{
+			name: "one function",
+			args: []string{"./cfg", "-i", "../../data/skeletons/D10447847/read1.go", "-func", "(type0).func1"},
+			want: `n6 -> n5;`,
+		},
+		{
+			name: "to file",
+			args: []string{"./cfg", "-i", "../../data/skeletons/D10447847/read1.go", "-o", output},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%.500s", tt.want, output)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Missing %s: %v", output, err)
+	}
+	if n := strings.Count(string(data), "digraph"); n != 2 {
+		t.Errorf("Wrote %d graphs, want 2", n)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+
+	"github.com/uber/data-race-skeletons/internal/cfg"
+)
+
+func main() {
+	input := flag.String("i", "", "Input Go file")
+	funcName := flag.String("func", "", "Only dump the function with this name, such as func1, (type0).func1 or func@12:5")
+	outputFile := flag.String("o", "", "Output DOT file (default: stdout)")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input file is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, *input, nil, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing file: %v\n", err)
+		os.Exit(1)
+	}
+	graphs := cfg.File(file)
+	if *funcName != "" {
+		var matched []*cfg.Graph
+		for _, g := range graphs {
+			if g.Name(fset) == *funcName {
+				matched = append(matched, g)
+			}
+		}
+		if len(matched) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: No function %s in %s\n", *funcName, *input)
+			os.Exit(1)
+		}
+		graphs = matched
+	}
+
+	out := os.Stdout
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", *outputFile, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	if err := cfg.WriteDOT(w, fset, graphs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing graphs: %v\n", err)
+		os.Exit(1)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing graphs: %v\n", err)
+		os.Exit(1)
+	}
+}
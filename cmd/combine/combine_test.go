@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+	// Build the combine binary
+	cmd := exec.Command("go", "build", "-o", "combine")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build combine: %v", err)
+	}
+	defer os.Remove("combine")
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "combined.go")
+	index := filepath.Join(dir, "index.json")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input",
+			args:    []string{"./combine"},
+			wantErr: true,
+		},
+		{
+			name:    "nonexistent directory",
+			args:    []string{"./combine", "-i", "nonexistent"},
+			wantErr: true,
+		},
+		{
+			name: "single case to stdout",
+			args: []string{"./combine", "-i", "../../data/skeletons/D10447847"},
+			want: "func (v1 *type0_D10447847_read1) func1(",
+		},
+		{
+			name: "skipped files reported",
+			args: []string{"./combine", "-i", "../../internal/combine/testdata", "-o", output, "-index", index},
+			want: "Skipped D3/write1.go",
+		},
+		{
+			name: "stubs",
+			args: []string{"./combine", "-i", "../../data/skeletons/D10447847", "-stubs"},
+			want: "var Wrapper1_D10447847_read1 = &",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+
+	for _, name := range []string{output, index} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("Missing %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/uber/data-race-skeletons/internal/combine"
+)
+
+func main() {
+	input := flag.String("i", "", "Skeletons directory, or a single case directory")
+	outputFile := flag.String("o", "", "Output combined Go file (default: stdout)")
+	indexFile := flag.String("index", "", "Output JSON index of the cases in the combined file")
+	pkg := flag.String("package", "skeleton", "Package name of the combined file")
+	stubs := flag.Bool("stubs", false, "Add synthesized declarations so the combined file compiles, skipping skeletons that do not")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input directory is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	result, err := combine.Dir(*input, combine.Options{Package: *pkg, Stubs: *stubs})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error combining %s: %v\n", *input, err)
+		os.Exit(1)
+	}
+
+	if *outputFile == "" {
+		os.Stdout.Write(result.Src)
+	} else if err := os.WriteFile(*outputFile, result.Src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing combined file: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *indexFile != "" {
+		jsonData, err := json.MarshalIndent(result.Index, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling index: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*indexFile, append(jsonData, '\n'), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing index: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	skipped := 0
+	for _, e := range result.Index {
+		if e.Skipped != "" {
+			skipped++
+			fmt.Fprintf(os.Stderr, "Skipped %s/%s: %s\n", e.Case, e.File, e.Skipped)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Combined %d of %d files\n", len(result.Index)-skipped, len(result.Index))
+}
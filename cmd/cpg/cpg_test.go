@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCPG(t *testing.T) {
+	// Build the cpg binary
+	cmd := exec.Command("go", "build", "-o", "cpg")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build cpg: %v", err)
+	}
+	defer os.Remove("cpg")
+
+	output := filepath.Join(t.TempDir(), "graphs.jsonl")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input",
+			args:    []string{"./cpg"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			args:    []string{"./cpg", "-i", "../../data/skeletons/D10447847", "-format", "dot"},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			args:    []string{"./cpg", "-i", "../../data/skeletons/missing.go"},
+			wantErr: true,
+		},
+		{
+			name: "single file",
+			args: []string{"./cpg", "-i", "../../data/skeletons/D10447847/read1.go"},
+			want: `"kind":"spawn"`,
+		},
+		{
+			name: "graphml",
+			args: []string{"./cpg", "-i", "../../data/skeletons/D10447847", "-format", "graphml"},
+			want: `<graph id="D10447847/read1.go" edgedefault="directed">`,
+		},
+		{
+			name: "corpus to file",
+			args: []string{"./cpg", "-i", "../../internal/cpg/testdata", "-o", output},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%.500s", tt.want, output)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Missing %s: %v", output, err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Errorf("Wrote %d graphs, want 3", n)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uber/data-race-skeletons/internal/cpg"
+)
+
+func main() {
+	input := flag.String("i", "", "Skeleton file, skeletons directory, or a single case directory")
+	format := flag.String("format", "json", "Output format: json, one graph per line, or graphml")
+	outputFile := flag.String("o", "", "Output file (default: stdout)")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input file or directory is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	var write func(w io.Writer, graphs []*cpg.Graph) error
+	switch *format {
+	case "json":
+		write = cpg.WriteJSON
+	case "graphml":
+		write = cpg.WriteGraphML
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unknown format %q\n", *format)
+		os.Exit(1)
+	}
+
+	info, err := os.Stat(*input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", *input, err)
+		os.Exit(1)
+	}
+	var graphs []*cpg.Graph
+	if info.IsDir() {
+		graphs, err = cpg.Dir(*input)
+	} else {
+		var g *cpg.Graph
+		g, err = cpg.File(*input)
+		graphs = []*cpg.Graph{g}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building graphs for %s: %v\n", *input, err)
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", *outputFile, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	if err := write(w, graphs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing graphs: %v\n", err)
+		os.Exit(1)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing graphs: %v\n", err)
+		os.Exit(1)
+	}
+}
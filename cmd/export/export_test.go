@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	// Build the export binary
+	cmd := exec.Command("go", "build", "-o", "export")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build export: %v", err)
+	}
+	defer os.Remove("export")
+
+	output := filepath.Join(t.TempDir(), "dataset.jsonl")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input",
+			args:    []string{"./export"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown text mode",
+			args:    []string{"./export", "-i", "../../data/skeletons/D10447847", "-text", "tokens"},
+			wantErr: true,
+		},
+		{
+			name: "raw",
+			args: []string{"./export", "-i", "../../data/skeletons/D10447847"},
+			want: `"text":"raw"`,
+		},
+		{
+			name: "canonical",
+			args: []string{"./export", "-i", "../../data/skeletons/D10447847", "-text", "canonical"},
+			want: `func (v0 *type0) func1(v2 pkg0.v3`,
+		},
+		{
+			name:    "unknown format",
+			args:    []string{"./export", "-i", "../../data/skeletons/D10447847", "-format", "csv"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown vocabulary",
+			args:    []string{"./export", "-i", "../../data/skeletons/D10447847", "-format", "tokens", "-vocab", "bpe"},
+			wantErr: true,
+		},
+		{
+			name: "tokens",
+			args: []string{"./export", "-i", "../../data/skeletons/D10447847", "-format", "tokens", "-vocab", "class"},
+			want: `"vocab":"class"`,
+		},
+		{
+			name: "corpus to file",
+			args: []string{"./export", "-i", "../../internal/export/testdata", "-o", output},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%.500s", tt.want, output)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Missing %s: %v", output, err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Errorf("Exported %d records, want 3", n)
+	}
+}
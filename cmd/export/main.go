@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uber/data-race-skeletons/internal/export"
+)
+
+func main() {
+	input := flag.String("i", "", "Skeletons directory, or a single case directory")
+	format := flag.String("format", "cases", "Output: cases, one record per case, or tokens, one labeled token stream per file")
+	text := flag.String("text", export.Raw, "Text of the files: raw, or canonical with renumbered placeholders")
+	vocab := flag.String("vocab", export.Exact, "Token vocabulary: exact, or class to replace placeholders by their class")
+	outputFile := flag.String("o", "", "Output JSONL file (default: stdout)")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input directory is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	var opts export.Options
+	switch *text {
+	case export.Raw:
+	case export.Canonical:
+		opts.Canonical = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unknown text mode %q\n", *text)
+		os.Exit(1)
+	}
+	switch *vocab {
+	case export.Exact:
+	case export.Class:
+		opts.Class = true
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unknown vocabulary %q\n", *vocab)
+		os.Exit(1)
+	}
+
+	var write func(w io.Writer) error
+	switch *format {
+	case "cases":
+		records, err := export.Dir(*input, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting %s: %v\n", *input, err)
+			os.Exit(1)
+		}
+		write = func(w io.Writer) error { return export.WriteJSONL(w, records) }
+	case "tokens":
+		records, err := export.TokensDir(*input, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting %s: %v\n", *input, err)
+			os.Exit(1)
+		}
+		write = func(w io.Writer) error { return export.WriteTokensJSONL(w, records) }
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unknown format %q\n", *format)
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", *outputFile, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	if err := write(w); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing records: %v\n", err)
+		os.Exit(1)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing records: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestHarness(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test -race")
+	}
+
+	// Build the harness binary
+	cmd := exec.Command("go", "build", "-o", "harness")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build harness: %v", err)
+	}
+	defer os.Remove("harness")
+
+	racy := "../../internal/harness/testdata/racy"
+	fixed := "../../internal/harness/testdata/fixed"
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input",
+			args:    []string{"./harness"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown expectation",
+			args:    []string{"./harness", "-i", racy, "-expect", "maybe"},
+			wantErr: true,
+		},
+		{
+			name: "racy pair",
+			args: []string{"./harness", "-i", racy},
+			want: "racy: race",
+		},
+		{
+			name: "fixed pair",
+			args: []string{"./harness", "-i", fixed, "-expect", "none"},
+			want: "fixed: no-race",
+		},
+		{
+			name:    "fixed pair still racy",
+			args:    []string{"./harness", "-i", racy, "-expect", "none"},
+			wantErr: true,
+			want:    "1 not as expected",
+		},
+		{
+			name: "files as json",
+			args: []string{"./harness", "-i", racy + "/read1.go," + racy + "/write1.go", "-format", "json"},
+			want: `"outcome": "race"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/data-race-skeletons/internal/corpus"
+	"github.com/uber/data-race-skeletons/internal/harness"
+)
+
+func main() {
+	input := flag.String("i", "", "Case directory, directory of cases, or comma-separated skeleton files")
+	expect := flag.String("expect", "race", "Expected outcome: race, or none for fixed variants")
+	format := flag.String("format", "text", "Output format: text or json")
+	parallel := flag.Int("parallel", 4, "Number of cases run at the same time")
+	timeout := flag.Duration("timeout", 5*time.Minute, "Time limit for building and running each case")
+	keep := flag.Bool("keep", false, "Keep the generated modules")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input file or directory is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *expect != "race" && *expect != "none" {
+		fmt.Fprintf(os.Stderr, "Error: Unknown expectation %q\n", *expect)
+		os.Exit(1)
+	}
+	if *parallel < 1 {
+		*parallel = 1
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Error: Unknown format %q\n", *format)
+		os.Exit(1)
+	}
+
+	var cases []corpus.Case
+	if info, err := os.Stat(*input); err == nil && info.IsDir() {
+		cases, err = corpus.FindCases(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", *input, err)
+			os.Exit(1)
+		}
+	} else {
+		files := strings.Split(*input, ",")
+		cases = []corpus.Case{{Name: filepath.Base(filepath.Dir(files[0])), Files: files}}
+	}
+	if len(cases) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No skeletons found in %s\n", *input)
+		os.Exit(1)
+	}
+
+	opts := harness.Options{Timeout: *timeout, Keep: *keep}
+	results := make([]harness.Result, len(cases))
+	sem := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	for i, c := range cases {
+		wg.Add(1)
+		go func(i int, c corpus.Case) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = harness.RunFiles(c.Name, c.Files, opts)
+		}(i, c)
+	}
+	wg.Wait()
+
+	mismatches := 0
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Outcome]++
+		if !r.Expected(*expect == "race") {
+			mismatches++
+		}
+	}
+
+	if *format == "json" {
+		jsonData, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling results: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		for _, r := range results {
+			fmt.Println(r)
+			if r.Dir != "" {
+				fmt.Printf("  module: %s\n", r.Dir)
+			}
+		}
+	}
+
+	var summary []string
+	for _, outcome := range []string{harness.OutcomeRace, harness.OutcomeNoRace, harness.OutcomePanic, harness.OutcomeTimeout, harness.OutcomeBuildError, harness.OutcomeError} {
+		if counts[outcome] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[outcome], outcome))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d cases: %s; %d not as expected\n", len(results), strings.Join(summary, ", "), mismatches)
+	if mismatches > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestLeakcheck(t *testing.T) {
+	// Build the leakcheck binary
+	cmd := exec.Command("go", "build", "-o", "leakcheck")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build leakcheck: %v", err)
+	}
+	defer os.Remove("leakcheck")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input",
+			args:    []string{"./leakcheck"},
+			wantErr: true,
+		},
+		{
+			name: "clean skeleton",
+			args: []string{"./leakcheck", "-i", "../../internal/leakcheck/testdata/clean.go"},
+		},
+		{
+			name:    "leaky skeleton fails",
+			args:    []string{"./leakcheck", "-i", "../../internal/leakcheck/testdata/leaky.go"},
+			wantErr: true,
+			want:    `high: string "\"card declined\"" is not anonymized`,
+		},
+		{
+			name: "leaky skeleton below threshold",
+			args: []string{"./leakcheck", "-i", "../../internal/leakcheck/testdata/leaky.go", "-fail-on", "none", "-format", "json"},
+			want: `"severity": "high"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/uber/data-race-skeletons/internal/leakcheck"
+)
+
+func main() {
+	input := flag.String("i", "", "Skeleton file or directory to scan")
+	allowFile := flag.String("allow", "", "File with extra allowed names or import paths, one per line")
+	format := flag.String("format", "text", "Output format: text or json")
+	failOn := flag.String("fail-on", leakcheck.SeverityLow, "Exit with status 1 if a finding has at least this severity: low, medium, high or none")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input file or directory is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	threshold := leakcheck.SeverityRank(*failOn)
+	if threshold == 0 && *failOn != "none" {
+		fmt.Fprintf(os.Stderr, "Error: Unknown severity %q\n", *failOn)
+		os.Exit(1)
+	}
+
+	var extra []string
+	if *allowFile != "" {
+		names, err := leakcheck.LoadAllowlist(*allowFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading allowlist: %v\n", err)
+			os.Exit(1)
+		}
+		extra = names
+	}
+
+	findings, err := leakcheck.NewChecker(extra).CheckPath(*input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning %s: %v\n", *input, err)
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "json":
+		if findings == nil {
+			findings = []leakcheck.Finding{}
+		}
+		jsonData, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling findings: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	case "text":
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unknown format %q\n", *format)
+		os.Exit(1)
+	}
+
+	for _, f := range findings {
+		if threshold > 0 && leakcheck.SeverityRank(f.Severity) >= threshold {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/skeletonizer"
+)
+
+func main() {
+	inputFile := flag.String("i", "", "Input Go file to skeletonize")
+	outputFile := flag.String("o", "", "Output skeleton file (default: stdout)")
+	racy := flag.String("racy", "", "Comma-separated line:column positions of the racy variables")
+	mappingFile := flag.String("map", "", "Mapping file for de-anonymization; extended if it already exists")
+	wholeFile := flag.Bool("whole", false, "Keep every declaration instead of only those enclosing the racy variables")
+	slice := flag.Bool("slice", false, "Slice kept functions down to the statements relevant to the racy variables")
+	flag.Parse()
+
+	if *inputFile == "" || *racy == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input file and racy positions are required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	opts := skeletonizer.Options{WholeFile: *wholeFile, Slice: *slice}
+	for _, s := range strings.Split(*racy, ",") {
+		pos, err := skeletonizer.ParsePosition(strings.TrimSpace(s))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Racy = append(opts.Racy, pos)
+	}
+
+	mapping := skeletonizer.NewMapping()
+	if *mappingFile != "" {
+		m, err := skeletonizer.LoadMapping(*mappingFile)
+		switch {
+		case err == nil:
+			mapping = m
+		case !errors.Is(err, fs.ErrNotExist):
+			fmt.Fprintf(os.Stderr, "Error loading mapping: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	src, err := os.ReadFile(*inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		os.Exit(1)
+	}
+	out, err := skeletonizer.Skeletonize(*inputFile, src, mapping, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error skeletonizing file: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *outputFile == "" {
+		fmt.Print(string(out))
+	} else if err := os.WriteFile(*outputFile, out, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing skeleton: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *mappingFile != "" {
+		if err := mapping.WriteFile(*mappingFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing mapping: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSkeletonize(t *testing.T) {
+	// Build the skeletonize binary
+	cmd := exec.Command("go", "build", "-o", "skeletonize")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build skeletonize: %v", err)
+	}
+	defer os.Remove("skeletonize")
+
+	mappingFile := filepath.Join(t.TempDir(), "mapping.json")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input file",
+			args:    []string{"./skeletonize"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid position",
+			args:    []string{"./skeletonize", "-i", "testdata/test.go", "-racy", "six"},
+			wantErr: true,
+		},
+		{
+			name: "skeleton with mapping",
+			args: []string{"./skeletonize", "-i", "testdata/test.go", "-racy", "6:2", "-map", mappingFile},
+			want: "racyVar0++",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+
+	if _, err := os.Stat(mappingFile); err != nil {
+		t.Errorf("Mapping file not written: %v", err)
+	}
+}
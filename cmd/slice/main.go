@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/slicer"
+)
+
+func main() {
+	inputFile := flag.String("i", "", "Input Go file to slice")
+	outputFile := flag.String("o", "", "Output file (default: stdout)")
+	funcName := flag.String("func", "", "Function to slice, as Name or Recv.Name (default: first function using the racy variables)")
+	vars := flag.String("vars", "", "Comma-separated racy variable names (default: racyVarN identifiers)")
+	flag.Parse()
+
+	if *inputFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input file is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var names []string
+	if *vars != "" {
+		for _, name := range strings.Split(*vars, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+
+	src, err := os.ReadFile(*inputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+		os.Exit(1)
+	}
+	out, err := slicer.File(*inputFile, src, *funcName, names)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error slicing file: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *outputFile == "" {
+		fmt.Print(string(out))
+	} else if err := os.WriteFile(*outputFile, out, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing slice: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSlice(t *testing.T) {
+	// Build the slice binary
+	cmd := exec.Command("go", "build", "-o", "slice")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build slice: %v", err)
+	}
+	defer os.Remove("slice")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input file",
+			args:    []string{"./slice"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown function",
+			args:    []string{"./slice", "-i", "../../data/skeletons/D6645345/write1.go", "-func", "missing"},
+			wantErr: true,
+		},
+		{
+			name: "skeleton",
+			args: []string{"./slice", "-i", "../../data/skeletons/D6645345/write1.go"},
+			want: "racyVar0[v28.Func20()] = v22",
+		},
+		{
+			name: "source tidied",
+			args: []string{"./slice", "-i", "../../internal/slicer/testdata/input.go", "-func", "Service.Process", "-vars", "total"},
+			want: "go func(id string) {\n\t\t\tdefer wg.Done()\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/split"
+)
+
+func main() {
+	input := flag.String("i", "", "Skeletons directory")
+	outputDir := flag.String("o", "output/split", "Directory to write the manifests to")
+	ratio := flag.String("ratio", "0.8,0.1,0.1", "Comma-separated train, val and test ratios")
+	seed := flag.Int64("seed", 1, "Seed of the shuffle")
+	similarity := flag.Float64("similarity", 0.9, "Token-shingle similarity above which cases are near-duplicates; above 1 only alpha-equivalent cases are grouped")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input directory is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	ratios, err := parseRatios(*ratio)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	m, err := split.Dir(*input, split.Options{Ratios: ratios, Seed: *seed, Similarity: *similarity})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error splitting %s: %v\n", *input, err)
+		os.Exit(1)
+	}
+	if err := m.WriteFiles(*outputDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing manifests: %v\n", err)
+		os.Exit(1)
+	}
+
+	var parts []string
+	for _, name := range split.Names {
+		parts = append(parts, fmt.Sprintf("%d %s", len(m.Splits[name]), name))
+	}
+	fmt.Fprintf(os.Stderr, "%d cases in %d duplicate groups: %s\n", len(m.Cases), len(m.Groups), strings.Join(parts, ", "))
+}
+
+// parseRatios parses the train, val and test ratios
+func parseRatios(s string) ([3]float64, error) {
+	var ratios [3]float64
+	fields := strings.Split(s, ",")
+	if len(fields) != len(ratios) {
+		return ratios, fmt.Errorf("expected 3 ratios, got %q", s)
+	}
+	for i, f := range fields {
+		r, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return ratios, fmt.Errorf("invalid ratio %q", f)
+		}
+		ratios[i] = r
+	}
+	return ratios, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	// Build the split binary
+	cmd := exec.Command("go", "build", "-o", "split")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build split: %v", err)
+	}
+	defer os.Remove("split")
+
+	output := filepath.Join(t.TempDir(), "split")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input",
+			args:    []string{"./split"},
+			wantErr: true,
+		},
+		{
+			name:    "two ratios",
+			args:    []string{"./split", "-i", "../../internal/split/testdata", "-ratio", "0.8,0.2", "-o", output},
+			wantErr: true,
+		},
+		{
+			name:    "zero ratios",
+			args:    []string{"./split", "-i", "../../internal/split/testdata", "-ratio", "0,0,0", "-o", output},
+			wantErr: true,
+		},
+		{
+			name: "split",
+			args: []string{"./split", "-i", "../../internal/split/testdata", "-ratio", "0.6,0.2,0.2", "-seed", "3", "-o", output},
+			want: "7 cases in 1 duplicate groups",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+
+	var listed []string
+	for _, name := range []string{"train", "val", "test"} {
+		data, err := os.ReadFile(filepath.Join(output, name+".txt"))
+		if err != nil {
+			t.Fatalf("Missing %s manifest: %v", name, err)
+		}
+		listed = append(listed, strings.Fields(string(data))...)
+	}
+	if len(listed) != 7 {
+		t.Errorf("Manifests list %d cases, want 7: %v", len(listed), listed)
+	}
+	if _, err := os.Stat(filepath.Join(output, "manifest.json")); err != nil {
+		t.Errorf("Missing manifest.json: %v", err)
+	}
+}
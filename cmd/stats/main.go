@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/uber/data-race-skeletons/internal/stats"
+)
+
+func main() {
+	input := flag.String("i", "", "Skeletons directory, or a single case directory")
+	format := flag.String("format", "json", "Output format: json or markdown")
+	outputFile := flag.String("o", "", "Output file (default: stdout)")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input directory is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	report, err := stats.Dir(*input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", *input, err)
+		os.Exit(1)
+	}
+	if len(report.Files) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No skeletons found in %s\n", *input)
+		os.Exit(1)
+	}
+
+	var out []byte
+	switch *format {
+	case "json":
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error marshaling statistics: %v\n", err)
+			os.Exit(1)
+		}
+		out = append(jsonData, '\n')
+	case "markdown":
+		out = []byte(report.Markdown())
+	default:
+		fmt.Fprintf(os.Stderr, "Error: Unknown format %q\n", *format)
+		os.Exit(1)
+	}
+
+	if *outputFile == "" {
+		os.Stdout.Write(out)
+		return
+	}
+	if err := os.WriteFile(*outputFile, out, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *outputFile, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	// Build the stats binary
+	cmd := exec.Command("go", "build", "-o", "stats")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build stats: %v", err)
+	}
+	defer os.Remove("stats")
+
+	output := filepath.Join(t.TempDir(), "stats.md")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input",
+			args:    []string{"./stats"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			args:    []string{"./stats", "-i", "../../data/skeletons/D10447847", "-format", "csv"},
+			wantErr: true,
+		},
+		{
+			name: "json",
+			args: []string{"./stats", "-i", "../../data/skeletons/D10447847"},
+			want: `"spawner_closures": 2`,
+		},
+		{
+			name: "markdown",
+			args: []string{"./stats", "-i", "../../data/skeletons/D10447847", "-format", "markdown"},
+			want: "| Spawner closures | 2 | 2 |",
+		},
+		{
+			name: "markdown to file",
+			args: []string{"./stats", "-i", "../../internal/export/testdata", "-format", "markdown", "-o", output},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Missing %s: %v", output, err)
+	}
+	if summary := "3 cases, 5 files"; !strings.Contains(string(data), summary) {
+		t.Errorf("Corpus summary missing %q:\n%.200s", summary, data)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/stubgen"
+)
+
+func main() {
+	inputs := flag.String("i", "", "Comma-separated skeleton files of one package")
+	outputDir := flag.String("o", "", "Output module directory (default: next to the first skeleton, named <skeleton>"+stubgen.ModuleSuffix+")")
+	check := flag.Bool("check", true, "Type-check the generated module and exit with status 1 on errors")
+	populate := flag.Bool("populate", false, "Make synthesized functions return non-empty values instead of zero values")
+	flag.Parse()
+
+	if *inputs == "" {
+		fmt.Fprintf(os.Stderr, "Error: Input file is required\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	filenames := strings.Split(*inputs, ",")
+	if *outputDir == "" {
+		*outputDir = strings.TrimSuffix(filenames[0], ".go") + stubgen.ModuleSuffix
+	}
+
+	module, err := stubgen.GenerateFiles(filenames, stubgen.Options{Populate: *populate})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating stubs: %v\n", err)
+		os.Exit(1)
+	}
+	if err := module.Write(*outputDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing module: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote module to %s\n", *outputDir)
+
+	if !*check {
+		return
+	}
+	errs := module.Check()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+}
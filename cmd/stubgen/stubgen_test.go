@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStubgen(t *testing.T) {
+	// Build the stubgen binary
+	cmd := exec.Command("go", "build", "-o", "stubgen")
+	cmd.Dir = "."
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to build stubgen: %v", err)
+	}
+	defer os.Remove("stubgen")
+
+	dir := filepath.Join(t.TempDir(), "read1.module")
+
+	// Test cases
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    string
+	}{
+		{
+			name:    "missing input file",
+			args:    []string{"./stubgen"},
+			wantErr: true,
+		},
+		{
+			name:    "nonexistent file",
+			args:    []string{"./stubgen", "-i", "nonexistent.go", "-o", dir},
+			wantErr: true,
+		},
+		{
+			name: "skeleton",
+			args: []string{"./stubgen", "-i", "../../data/skeletons/D10447847/read1.go", "-o", dir},
+			want: "Wrote module to " + dir,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(tt.args[0], tt.args[1:]...)
+			output, err := cmd.CombinedOutput()
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output missing %q:\n%s", tt.want, output)
+			}
+		})
+	}
+
+	for _, name := range []string{"go.mod", "stubs.go", "read1.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Module missing %s: %v", name, err)
+		}
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"go/parser"
 	"go/token"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/patterns"
 )
 
 var debugMode bool
@@ -17,7 +20,16 @@ type AnalysisResult struct {
 	HasWrite    bool   `json:"has_write"` // Whether the file contains a write to a racy variable
 	LineNumber  int    `json:"line_number,omitempty"`
 	LineContent string `json:"line_content,omitempty"`
-	Error       string `json:"error,omitempty"`
+	// Patterns are the race patterns the file matches, most confident first
+	Patterns []patterns.Match `json:"patterns,omitempty"`
+	// DefUse lists the reads of racy variables with the definitions that may reach them
+	DefUse []DefUse `json:"def_use,omitempty"`
+	// Goroutines lists the go statements and spawner calls with the variables their closures capture
+	Goroutines []Goroutine `json:"goroutines,omitempty"`
+	// Pairs lists the accesses to racy variables that may run in different
+	// goroutines, labeled ordered or potentially concurrent
+	Pairs []Pair `json:"pairs,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
 // SetDebugMode sets the debug mode for the analyzer
@@ -193,14 +205,125 @@ func (v *visitor) Visit(node ast.Node) ast.Visitor {
 	return v
 }
 
+// Kinds of racy variable accesses
+const (
+	Read  = "read"
+	Write = "write"
+)
+
+// Access is a read or write of a racy variable. Offset and End delimit the
+// identifier in the source in bytes, and ExprOffset and ExprEnd the accessed
+// expression: the identifier with the operands it is selected from or
+// dereferences, such as v1.v2.racyVar0.
+type Access struct {
+	Var        string `json:"var"`
+	Kind       string `json:"kind"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	Offset     int    `json:"offset"`
+	End        int    `json:"end"`
+	ExprOffset int    `json:"expr_offset"`
+	ExprEnd    int    `json:"expr_end"`
+}
+
+// Accesses returns the accesses to racy variables in a parsed file, in source
+// order. Identifiers that only declare a racy variable are not accesses.
+func Accesses(fset *token.FileSet, file *ast.File) []Access {
+	var accesses []Access
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		ident, ok := n.(*ast.Ident)
+		if !ok || !isRacyVarWrite(ident) {
+			return true
+		}
+		kind := Read
+		if isWritten(ident, stack) {
+			kind = Write
+		} else if isDeclaration(ident, stack[len(stack)-2]) {
+			return true
+		}
+		pos, end := fset.Position(ident.Pos()), fset.Position(ident.End())
+		expr := accessedExpr(ident, stack)
+		accesses = append(accesses, Access{
+			Var:        ident.Name,
+			Kind:       kind,
+			Line:       pos.Line,
+			Column:     pos.Column,
+			Offset:     pos.Offset,
+			End:        end.Offset,
+			ExprOffset: fset.Position(expr.Pos()).Offset,
+			ExprEnd:    fset.Position(expr.End()).Offset,
+		})
+		return true
+	})
+	return accesses
+}
+
+// accessedExpr returns the expression an identifier is accessed through:
+// the selector it is the field of, or the dereference of it
+func accessedExpr(ident *ast.Ident, stack []ast.Node) ast.Expr {
+	var expr ast.Expr = ident
+	for i := len(stack) - 2; i >= 0; i-- {
+		switch p := stack[i].(type) {
+		case *ast.SelectorExpr:
+			if p.Sel != expr {
+				return expr
+			}
+		case *ast.StarExpr, *ast.ParenExpr:
+		default:
+			return expr
+		}
+		expr = stack[i].(ast.Expr)
+	}
+	return expr
+}
+
+// isDeclaration checks if an identifier declares a name rather than uses it
+func isDeclaration(ident *ast.Ident, parent ast.Node) bool {
+	switch p := parent.(type) {
+	case *ast.AssignStmt:
+		if p.Tok == token.DEFINE {
+			for _, lhs := range p.Lhs {
+				if lhs == ident {
+					return true
+				}
+			}
+		}
+	case *ast.ValueSpec:
+		for _, name := range p.Names {
+			if name == ident {
+				return true
+			}
+		}
+	case *ast.Field:
+		for _, name := range p.Names {
+			if name == ident {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // AnalyzeFile analyzes a Go source file and returns whether it contains writes to racy variables
 func AnalyzeFile(filename string) (*AnalysisResult, error) {
 	result := &AnalysisResult{
 		File: filename,
 	}
 
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		result.Error = fmt.Sprintf("error reading file: %v", err)
+		return result, err
+	}
+
 	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	node, err := parser.ParseFile(fset, filename, content, parser.ParseComments)
 	if err != nil {
 		result.Error = fmt.Sprintf("error parsing file: %v", err)
 		return result, err
@@ -216,17 +339,25 @@ func AnalyzeFile(filename string) (*AnalysisResult, error) {
 		result.HasWrite = true
 		result.LineNumber = v.writePos.Line
 
-		// Read the file to get the line content
-		content, err := os.ReadFile(filename)
-		if err != nil {
-			result.Error = fmt.Sprintf("error reading file: %v", err)
-			return result, err
-		}
 		lines := strings.Split(string(content), "\n")
 		if v.writePos.Line-1 < len(lines) {
 			result.LineContent = strings.TrimSpace(lines[v.writePos.Line-1])
 		}
 	}
+	result.Patterns = patterns.File(fset, node, content)
+	if !sharesLoopVars(findGoVersion(filepath.Dir(filename))) {
+		// Loops declare their variables for each iteration since Go 1.22
+		var kept []patterns.Match
+		for _, m := range result.Patterns {
+			if m.Pattern != patterns.LoopVarCapture {
+				kept = append(kept, m)
+			}
+		}
+		result.Patterns = kept
+	}
+	result.DefUse = DefUseChains(fset, node)
+	result.Goroutines = Goroutines(fset, node)
+	result.Pairs = Pairs(fset, node)
 
 	return result, nil
 }
@@ -1,6 +1,12 @@
 package analyzer
 
 import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -34,3 +40,872 @@ func TestAnalyzeFile(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalyzeFilePatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     []string
+	}{
+		{
+			name:     "errgroup closure in loop",
+			filename: "testdata/errgroup.go",
+			want:     []string{"errgroup-shared-err", "loop-variable-capture"},
+		},
+		{
+			name:     "no goroutines",
+			filename: "testdata/write.go",
+		},
+		{
+			name:     "loop variables per iteration",
+			filename: "testdata/loopvars/modern/worker.go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := AnalyzeFile(tt.filename)
+			if err != nil {
+				t.Fatalf("AnalyzeFile() error = %v", err)
+			}
+			var got []string
+			for _, m := range result.Patterns {
+				got = append(got, m.Pattern)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("AnalyzeFile() patterns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccesses(t *testing.T) {
+	src := `package skeleton
+
+func (v1 *type0) func1(racyVar1 []int) {
+	v2, racyVar0 := v1.Func1()
+	go func() {
+		racyVar0 = v2
+		v1.racyVar2++
+	}()
+	v3.Func2(racyVar0, racyVar1[0])
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "skeleton.go", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	var got []string
+	for _, a := range Accesses(fset, file) {
+		if src[a.Offset:a.End] != a.Var {
+			t.Errorf("access %v spans %q", a, src[a.Offset:a.End])
+		}
+		got = append(got, fmt.Sprintf("%s %s %d:%d %s", a.Var, a.Kind, a.Line, a.Column, src[a.ExprOffset:a.ExprEnd]))
+	}
+	want := []string{
+		"racyVar0 write 6:3 racyVar0",
+		"racyVar2 write 7:6 v1.racyVar2",
+		"racyVar0 read 9:11 racyVar0",
+		"racyVar1 read 9:21 racyVar1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Accesses() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDefUseChains(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // line expr relation, then kind:line:flow of each def, * if concurrent
+	}{
+		{
+			name: "spawner to goroutine",
+			src: `package skeleton
+
+func func1() {
+	racyVar0 := 1
+	go func() {
+		func2(racyVar0)
+	}()
+}`,
+			want: []string{"6 racyVar0 spawner-to-goroutine declaration:4:captured"},
+		},
+		{
+			name: "spawner writes after spawn",
+			src: `package skeleton
+
+func func1() {
+	racyVar0 := 1
+	go func() {
+		func2(racyVar0)
+	}()
+	racyVar0 = 2
+}`,
+			want: []string{"6 racyVar0 concurrent declaration:4:captured write:8:closure*"},
+		},
+		{
+			name: "goroutine writes before spawner reads",
+			src: `package skeleton
+
+func func1() {
+	racyVar0 := 0
+	func2(racyVar0)
+	go func() {
+		racyVar0 = 1
+	}()
+	func3(racyVar0)
+}`,
+			want: []string{
+				"5 racyVar0 sequential declaration:4:local",
+				"9 racyVar0 concurrent declaration:4:local write:7:closure*",
+			},
+		},
+		{
+			name: "increment in goroutines spawned in a loop",
+			src: `package skeleton
+
+func func1() {
+	var racyVar0 int
+	for v0 := 0; v0 < 3; v0++ {
+		go func() {
+			racyVar0++
+		}()
+	}
+}`,
+			want: []string{"7 racyVar0 concurrent-read-modify-write declaration:4:captured write:7:closure*"},
+		},
+		{
+			name: "later definitions kill earlier ones",
+			src: `package skeleton
+
+func func1(v0 bool) int {
+	racyVar0 := 1
+	if v0 {
+		racyVar0 = 2
+	}
+	func2(racyVar0)
+	racyVar0 = 3
+	return racyVar0
+}`,
+			want: []string{
+				"8 racyVar0 sequential declaration:4:local write:6:local",
+				"10 racyVar0 sequential write:9:local",
+			},
+		},
+		{
+			name: "receiver field and parameter",
+			src: `package skeleton
+
+func (v0 *type0) func1(racyVar1 int) {
+	v0.racyVar0 = racyVar1
+	for {
+		func2(v0.racyVar0)
+		v0.racyVar0 = 2
+	}
+}`,
+			want: []string{
+				"4 racyVar1 sequential parameter:3:local",
+				"6 v0.racyVar0 sequential write:4:local write:7:local",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "skeleton.go", tt.src, 0)
+			if err != nil {
+				t.Fatalf("ParseFile() error = %v", err)
+			}
+			var got []string
+			for _, c := range DefUseChains(fset, file) {
+				s := fmt.Sprintf("%d %s %s", c.Line, c.Expr, c.Relation)
+				for _, d := range c.Defs {
+					s += fmt.Sprintf(" %s:%d:%s", d.Kind, d.Line, d.Flow)
+					if d.Concurrent {
+						s += "*"
+					}
+				}
+				got = append(got, s)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("DefUseChains() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestGoroutines(t *testing.T) {
+	src := `package skeleton
+
+var v9 int
+
+func (v0 *type0) func1(v1 []int) {
+	racyVar0 := map[int]int{}
+	var racyVar1 int
+	go func2(v1)
+	for _, v2 := range v1 {
+		go func(v3 int) {
+			racyVar0[v3] = v2
+			racyVar1++
+			v9++
+			v0.Func3()
+		}(v2)
+	}
+	racyVar1 = 0
+	Wrapper1.Go(func() error {
+		delete(racyVar0, 1)
+		return nil
+	})
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "skeleton.go", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	var got []string
+	for _, g := range Goroutines(fset, file) {
+		s := fmt.Sprintf("%s %s %d %s:", g.Kind, g.Call, g.Line, g.Func)
+		for _, c := range g.Captures {
+			s += fmt.Sprintf(" %s@%d=%s", c.Var, c.Line, c.Written)
+			for _, r := range c.Refs {
+				kind := "r"
+				if r.Write {
+					kind = "w"
+				}
+				if !r.Inside {
+					kind += "o"
+				}
+				s += fmt.Sprintf(",%s%d", kind, r.Line)
+			}
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"go func2 8 func2:",
+		"go func 10 func@10:6: racyVar0@6=both,w11,wo19 v2@9=none,r11 racyVar1@7=both,w12,wo17 v0@5=none,r14",
+		// Writes in other closures are outside
+		"spawner Wrapper1.Go 18 func@18:14: racyVar0@6=both,wo11,w19",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Goroutines() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPairs(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "waitgroup",
+			src: `package skeleton
+
+func func1() {
+	var racyVar0 int
+	v21 := sync.WaitGroup{}
+	v21.Add(1)
+	go func() {
+		defer v21.Done()
+		racyVar0 = 1
+	}()
+	v21.Wait()
+	func2(racyVar0)
+}`,
+			want: []string{"9-12 ordered wait"},
+		},
+		{
+			name: "errgroup",
+			src: `package skeleton
+
+func func1() {
+	var racyVar0 int
+	Wrapper1.Go(func() error {
+		racyVar0 = 1
+		return nil
+	})
+	Wrapper1.Wait()
+	func2(racyVar0)
+}`,
+			want: []string{"6-10 ordered wait"},
+		},
+		{
+			name: "write before and after go",
+			src: `package skeleton
+
+func func1() {
+	racyVar0 := 0
+	racyVar0 = 1
+	go func() {
+		func2(racyVar0)
+	}()
+	racyVar0 = 2
+}`,
+			want: []string{"5-7 ordered go", "7-9 potentially-concurrent"},
+		},
+		{
+			name: "unbuffered channel",
+			src: `package skeleton
+
+func func1() {
+	var racyVar0 int
+	v0 := make(chan bool)
+	go func() {
+		racyVar0 = 1
+		v0 <- true
+	}()
+	<-v0
+	func2(racyVar0)
+}`,
+			want: []string{"7-11 ordered channel"},
+		},
+		{
+			name: "once",
+			src: `package skeleton
+
+func func1() {
+	var racyVar0 int
+	for v1 := 0; v1 < 2; v1++ {
+		go func() {
+			v0.Do(func() {
+				racyVar0 = 1
+			})
+		}()
+	}
+}`,
+			want: []string{"8-8 ordered once"},
+		},
+		{
+			name: "goroutines in a loop",
+			src: `package skeleton
+
+func func1(v1 []int) {
+	var racyVar0 int
+	for range v1 {
+		go func() {
+			racyVar0++
+		}()
+	}
+}`,
+			want: []string{"7-7 potentially-concurrent"},
+		},
+		{
+			// The receive orders the read after only one of the goroutines
+			name: "receive once from goroutines in a loop",
+			src: `package skeleton
+
+func func1(v1 []int) {
+	var racyVar0 int
+	v0 := make(chan bool)
+	for range v1 {
+		go func() {
+			racyVar0 = 1
+			v0 <- true
+		}()
+	}
+	<-v0
+	func2(racyVar0)
+}`,
+			want: []string{"8-8 potentially-concurrent", "8-13 potentially-concurrent"},
+		},
+		{
+			name: "receive in a loop from goroutines in a loop",
+			src: `package skeleton
+
+func func1(v1 []int) {
+	var racyVar0 int
+	v0 := make(chan bool)
+	for range v1 {
+		go func() {
+			racyVar0 = 1
+			v0 <- true
+		}()
+	}
+	for range v1 {
+		<-v0
+	}
+	func2(racyVar0)
+}`,
+			want: []string{"8-8 potentially-concurrent", "8-15 ordered channel"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "skeleton.go", tt.src, 0)
+			if err != nil {
+				t.Fatalf("ParseFile() error = %v", err)
+			}
+			var got []string
+			for _, p := range Pairs(fset, file) {
+				s := fmt.Sprintf("%d-%d %s", p.First.Line, p.Second.Line, p.Order)
+				if p.Sync != "" {
+					s += " " + p.Sync
+				}
+				got = append(got, s)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Pairs() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestLockset(t *testing.T) {
+	pkgs, err := ParseDir("testdata/lockset", ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "lockset" || len(pkgs[0].Files) != 2 {
+		t.Fatalf("ParseDir() = %v, want package lockset with 2 files", pkgs)
+	}
+	var got []string
+	for _, f := range Lockset(pkgs[0]) {
+		s := fmt.Sprintf("%s %s %s:%d %s:", f.Check, f.Var, filepath.Base(f.File), f.Line, f.Func)
+		for _, r := range f.Related {
+			s += fmt.Sprintf(" %s@%d%v", r.Role, r.Line, r.Locks)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		// Inc writes hits after unlocking
+		"lockset (Server).hits server.go:17 (Server).Inc: write@17[] write@21[]",
+		// A read lock does not protect a write
+		"lockset (Cache).size server.go:34 (Cache).Resize: write@34[] write@29[(Cache).mu]",
+		// The package variable is declared in the other file
+		"lockset total worker.go:22 (Server).loop: write@12[(Server).mu] write@22[]",
+		// Goroutines started in a loop race with each other, not with the
+		// read after Wait
+		"lockset sum worker.go:41 func@39:6: write@41[]",
+		// Squares writes the element of results and firsts at the index
+		// each goroutine receives, but the goroutines of Last all write
+		// the same element
+		"lockset out worker.go:92 func@90:6: write@92[]",
+		"lockset arr worker.go:103 func@102:5: write@103[] read@105[]",
+		// The receive orders the goroutine's increment before the return
+		"lockset counts worker.go:113 func@112:5: write@113[] write@116[]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Findings =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFieldRaces(t *testing.T) {
+	pkgs, err := ParseDir("testdata/fields", ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+	var got []string
+	for _, f := range FieldRaces(pkgs[0]) {
+		s := fmt.Sprintf("%s %s:%d: %s", f.Var, filepath.Base(f.File), f.Line, f.Message)
+		for _, r := range f.Related {
+			s += fmt.Sprintf(" %s@%s:%d%v", r.Role, filepath.Base(r.File), r.Line, r.Locks)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		// The methods are in different files
+		"(asyncWorkerQueue).taskChan queue.go:11: (asyncWorkerQueue).taskChan is written in (asyncWorkerQueue).Run and read in (asyncWorkerQueue).Dequeue, which may run concurrently; no mutex field guards them write@queue.go:11[] read@dequeue.go:4[]",
+		"(store).n queue.go:34: (store).n is written in (store).Put and read in (store).Len, which may run concurrently; only (store).Put holds (store).mu write@queue.go:34[(store).mu] read@dequeue.go:14[]",
+		// items is guarded, and plain is not used concurrently
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("FieldRaces() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestConcurrentMaps(t *testing.T) {
+	pkgs, err := ParseDir("testdata/maps", ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+	var got []string
+	for _, f := range ConcurrentMaps(pkgs[0]) {
+		s := fmt.Sprintf("%s %s:%d: %s", f.Var, filepath.Base(f.File), f.Line, f.Message)
+		for _, r := range f.Related {
+			s += fmt.Sprintf(" %s@%d%v", r.Role, r.Line, r.Locks)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		// A read lock does not protect a write
+		"(cache).entries cache.go:15: map (cache).entries is written by a goroutine and read in (cache).Lookup without a common lock spawn@13[] write@15[] read@24[(cache).mu]",
+		// journal also has a field m, but a slice
+		"ix.m fields.go:15: map ix.m is written by goroutines started in a loop without a common lock spawn@14[] write@15[]",
+		// The map is of a named type, and the write after Wait is ordered
+		"registry registry.go:15: map registry is deleted from by goroutines started in a loop without a common lock spawn@13[] delete@15[]",
+		// seen is locked, and the writes to m are ordered by the channel
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ConcurrentMaps() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSliceAppends(t *testing.T) {
+	pkgs, err := ParseDir("testdata/slices", ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+	var got []string
+	for _, f := range SliceAppends(pkgs[0]) {
+		s := fmt.Sprintf("%s %d: %s", f.Var, f.Line, f.Message)
+		for _, r := range f.Related {
+			s += fmt.Sprintf(" %s@%d:%d%v", r.Role, r.Line, r.Column, r.Locks)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"(collector).results 17: slice (collector).results is appended to by goroutines started in a loop without a common lock spawn@15:3[] append@17:6[] read@17:25[]",
+		// The header is replaced while an element is written; errs is locked
+		"parts 40: slice parts is reassigned by a goroutine and written at an index in Shift without a common lock spawn@38:2[] reassign@40:3[] write@42:2[]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("SliceAppends() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLazyInits(t *testing.T) {
+	pkgs, err := ParseDir("testdata/lazyinit", ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+	var got []string
+	for _, f := range LazyInits(pkgs[0]) {
+		s := fmt.Sprintf("%s %s:%d: %s", f.Var, filepath.Base(f.File), f.Line, f.Message)
+		for _, r := range f.Related {
+			s += fmt.Sprintf(" %s@%d%v", r.Role, r.Line, r.Locks)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		// A write in another goroutine makes the function concurrent
+		"instance instance.go:6: instance is checked and set in Instance without synchronization; use sync.Once, or hold a lock across the check and the set check@6[] set@7[] write@14[]",
+		// The type has a mutex, so its methods may run concurrently
+		"(registry).items registry.go:18: (registry).items is checked and set in (registry).get without synchronization; use sync.Once, or hold a lock across the check and the set check@18[] set@19[]",
+		// Double-checked locking reads the flag outside the lock
+		"(registry).ready registry.go:25: (registry).ready is checked in (registry).init outside the lock held where it is set; use sync.Once, or hold (registry).mu across the check and the set check@25[] set@28[(registry).mu]",
+		// Once and the lock in reset synchronize conf, and nothing runs
+		// Defaults concurrently
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("LazyInits() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLoopCaptures(t *testing.T) {
+	var got []string
+	// Lockset also reports the loop variables shared by all iterations,
+	// but not since Go 1.22
+	locksetWant := map[string]string{
+		"testdata/loopvars":        "item worker.go:11 i worker.go:21",
+		"testdata/loopvars/modern": "",
+	}
+	for _, dir := range []string{"testdata/loopvars", "testdata/loopvars/modern"} {
+		pkgs, err := ParseDir(dir, ParseOptions{})
+		if err != nil {
+			t.Fatalf("ParseDir() error = %v", err)
+		}
+		for _, f := range LoopCaptures(pkgs[0]) {
+			s := fmt.Sprintf("%s %s:%d: %s", f.Var, filepath.Base(f.File), f.Line, f.Message)
+			for _, r := range f.Related {
+				s += fmt.Sprintf(" %s@%d", r.Role, r.Line)
+			}
+			got = append(got, s)
+		}
+		var lockset []string
+		for _, f := range Lockset(pkgs[0]) {
+			lockset = append(lockset, fmt.Sprintf("%s %s:%d", f.Var, filepath.Base(f.File), f.Line))
+		}
+		if s := strings.Join(lockset, " "); s != locksetWant[dir] {
+			t.Errorf("Lockset(%s) = %q, want %q", dir, s, locksetWant[dir])
+		}
+	}
+	want := []string{
+		"item worker.go:13: loop variable item of process is used by a goroutine started in the loop; with go 1.20 all iterations share it, so the loop assigns it while the goroutine runs; pass it as an argument or copy it in the loop body spawn@12 loop@11 read@13",
+		"i worker.go:25: loop variable i of start is used by a goroutine started in the loop; with go 1.20 all iterations share it, so the loop assigns it while the goroutine runs; pass it as an argument or copy it in the loop body spawn@23 loop@21 read@25",
+		// The copy and the argument are not loop variables, and the
+		// module of modern declares them per iteration
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("LoopCaptures() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSharesLoopVars(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"1.20", true},
+		{"1.21.5", true},
+		{"go1.21", true},
+		{"1.22", false},
+		{"1.22rc1", false},
+		{"1.23.0", false},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if got := sharesLoopVars(tt.version); got != tt.want {
+			t.Errorf("sharesLoopVars(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParallelSubtests(t *testing.T) {
+	pkgs, err := ParseDir("testdata/subtests", ParseOptions{Tests: true})
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+	if len(pkgs) != 1 || len(pkgs[0].Files) != 2 {
+		t.Fatalf("ParseDir() = %v, want package subtests with 2 files", pkgs)
+	}
+	var got []string
+	for _, f := range ParallelSubtests(pkgs[0]) {
+		s := fmt.Sprintf("%s %s:%d: %s", f.Var, filepath.Base(f.File), f.Line, f.Message)
+		for _, r := range f.Related {
+			s += fmt.Sprintf(" %s@%d%v", r.Role, r.Line, r.Locks)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		// The table entry is shared by the iterations before Go 1.22
+		"tt collect_test.go:20: parallel subtest tt.name uses loop variable tt of TestCollectAll after t.Parallel; with go 1.20 all iterations share it, so the subtests run after the loop ends and see its last value; copy it in the loop body before t.Run subtest@18[] parallel@19[] loop@17[] read@20[] read@20[] read@21[]",
+		// The subtest runs in a loop, so its instances write the map
+		// concurrently
+		"seen collect_test.go:36: parallel subtest name writes seen, captured from TestCounters, after t.Parallel while other parallel subtests use it; copy it into the subtest or guard it with a lock subtest@33[] parallel@35[] write@36[]",
+		// report reads the counter without the lock; runs is only
+		// written before t.Parallel
+		"locked collect_test.go:38: parallel subtest name writes locked, captured from TestCounters, after t.Parallel while other parallel subtests use it; copy it into the subtest or guard it with a lock subtest@33[] parallel@35[] write@38[mu] read@44[]",
+		"locked collect_test.go:44: parallel subtest \"report\" reads locked, captured from TestCounters, after t.Parallel while other parallel subtests use it; copy it into the subtest or guard it with a lock subtest@42[] parallel@43[] read@44[] write@38[mu]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ParallelSubtests() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseModule(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ParseOptions
+		want []string // import path and files of each package
+	}{
+		{
+			name: "default",
+			want: []string{
+				"example.com/shop shop.go",
+				"example.com/shop/store report.go store.go",
+			},
+		},
+		{
+			name: "tests and tags",
+			opts: ParseOptions{Tests: true, Tags: []string{"debug"}},
+			want: []string{
+				"example.com/shop shop.go",
+				"example.com/shop/store debug.go report.go store.go store_test.go",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseModule("testdata/module", tt.opts)
+			if err != nil {
+				t.Fatalf("ParseModule() error = %v", err)
+			}
+			if m.Path != "example.com/shop" || m.GoVersion != "1.21" {
+				t.Errorf("ParseModule() = module %s go %s, want example.com/shop go 1.21", m.Path, m.GoVersion)
+			}
+			var got []string
+			for _, pkg := range m.Packages {
+				s := pkg.ImportPath
+				for _, file := range pkg.Files {
+					s += " " + filepath.Base(pkg.Fset.Position(file.Pos()).Filename)
+				}
+				got = append(got, s)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("ParseModule() packages =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if _, ok := m.Errors[filepath.Join("testdata/module", "broken")]; !ok || len(m.Errors) != 1 {
+				t.Errorf("ParseModule() errors = %v, want one for broken", m.Errors)
+			}
+		})
+	}
+}
+
+func TestAnalyzePackageDedupe(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{
+			// The field races are not reported again by lockset
+			dir: "testdata/lockset",
+			want: []string{
+				"field-race (Server).hits server.go:17",
+				"field-race (Cache).size server.go:34",
+				"lockset total worker.go:22",
+				"lockset sum worker.go:41",
+				"lockset out worker.go:92",
+				"lockset arr worker.go:103",
+				"lockset counts worker.go:113",
+			},
+		},
+		{
+			// The loop variables shared by all iterations are not reported
+			// again by lockset
+			dir: "testdata/loopvars",
+			want: []string{
+				"loop-capture item worker.go:13",
+				"loop-capture i worker.go:25",
+			},
+		},
+		{
+			// The map write is not reported again by lockset and field-race
+			dir: "testdata/maps",
+			want: []string{
+				"concurrent-map (cache).entries cache.go:15",
+				"concurrent-map ix.m fields.go:15",
+				"concurrent-map registry registry.go:15",
+			},
+		},
+		{
+			// The header writes are not reported again by lockset
+			dir: "testdata/slices",
+			want: []string{
+				"slice-append (collector).results collector.go:17",
+				"slice-append parts collector.go:40",
+			},
+		},
+		{
+			// The lazy initialization of instance is not reported again by
+			// lockset
+			dir: "testdata/lazyinit",
+			want: []string{
+				"lazy-init instance instance.go:6",
+				"lazy-init (registry).items registry.go:18",
+				"lazy-init (registry).ready registry.go:25",
+				"field-race (registry).conf registry.go:37",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			pkgs, err := ParseDir(tt.dir, ParseOptions{})
+			if err != nil {
+				t.Fatalf("ParseDir() error = %v", err)
+			}
+			var got []string
+			for _, f := range AnalyzePackage(pkgs[0]).Findings {
+				got = append(got, fmt.Sprintf("%s %s %s:%d", f.Check, f.Var, filepath.Base(f.File), f.Line))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("AnalyzePackage() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	pkgs, err := ParseDir("testdata/suppress", ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseDir() error = %v", err)
+	}
+	result := AnalyzePackage(pkgs[0])
+	var got []string
+	for _, f := range result.Findings {
+		got = append(got, fmt.Sprintf("%s %s:%d", f.Var, f.Check, f.Line))
+	}
+	want := []string{
+		// A directive needs a reason, and only suppresses its check
+		"drops lockset:21",
+		"errs lockset:26",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") || result.Suppressed != 3 {
+		t.Errorf("AnalyzePackage() = %d suppressed\n%s\nwant 3 suppressed\n%s", result.Suppressed, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	analyze := func(dir string) []*PackageResult {
+		pkgs, err := ParseDir(dir, ParseOptions{})
+		if err != nil {
+			t.Fatalf("ParseDir() error = %v", err)
+		}
+		return []*PackageResult{AnalyzePackage(pkgs[0])}
+	}
+	results := analyze("testdata/lockset")
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := NewBaseline(results).Write(path); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	b, err := ReadBaseline(path)
+	if err != nil {
+		t.Fatalf("ReadBaseline() error = %v", err)
+	}
+	if len(b.Findings) == 0 || len(b.Findings) != len(results[0].Findings) {
+		t.Fatalf("ReadBaseline() = %d findings, want %d", len(b.Findings), len(results[0].Findings))
+	}
+
+	// Shift the lines of the files, and add a race, in a checkout of the
+	// module elsewhere
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "go.mod"), []byte("module github.com/uber/data-race-skeletons\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "internal", "analyzer", "testdata", "lockset")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"server.go", "worker.go"} {
+		src, err := os.ReadFile(filepath.Join("testdata/lockset", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		shifted := strings.Replace(string(src), "\n", "\n\n// Shifted\n", 1)
+		if name == "server.go" {
+			shifted += "\nvar extra int\n\nfunc bump() {\n\tgo func() {\n\t\textra++\n\t}()\n\textra = 0\n}\n"
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(shifted), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shifted := analyze(dir)
+	if left := b.Apply(shifted); left != 1 || shifted[0].Findings[0].Var != "extra" {
+		t.Errorf("Apply() = %d findings %v, want the race on extra", left, shifted[0].Findings)
+	}
+	if shifted[0].Baselined != len(b.Findings) {
+		t.Errorf("Apply() baselined %d findings, want %d", shifted[0].Baselined, len(b.Findings))
+	}
+
+	// The same file of two packages of one name in a module
+	src, err := os.ReadFile("testdata/lockset/worker.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fingerprints []string
+	for _, pkg := range []string{"a", "b"} {
+		dir := filepath.Join(root, pkg, "lockset")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "worker.go"), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range analyze(dir)[0].Findings {
+			fingerprints = append(fingerprints, f.Fingerprint)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, fp := range fingerprints {
+		if seen[fp] {
+			t.Errorf("Fingerprint %s of a/lockset/worker.go is also one of b/lockset/worker.go", fp)
+		}
+		seen[fp] = true
+	}
+}
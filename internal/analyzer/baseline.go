@@ -0,0 +1,143 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Baseline is the findings accepted when it was written, so that only new
+// findings are reported
+type Baseline struct {
+	Findings []BaselineFinding `json:"findings"`
+}
+
+// BaselineFinding is a finding of a baseline. Its check, variable, file and
+// message are for readers; findings are matched by fingerprint.
+type BaselineFinding struct {
+	Fingerprint string `json:"fingerprint"`
+	Check       string `json:"check"`
+	Var         string `json:"var"`
+	File        string `json:"file"`
+	Message     string `json:"message"`
+}
+
+// closureName matches the names of function literals, which hold their
+// position
+var closureName = regexp.MustCompile(`func@\d+:\d+`)
+
+// fingerprint identifies a finding across changes that shift its lines: it
+// hashes the check, the path of the file, the function, variable and
+// message with the positions of closures left out, and the text of the line
+// the finding is at
+func fingerprint(f Finding, path, line string) string {
+	h := sha256.New()
+	for _, s := range []string{f.Check, path, f.Func, f.Var, f.Message, strings.TrimSpace(line)} {
+		h.Write([]byte(closureName.ReplaceAllString(s, "func")))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// modulePath returns the path of a file of a package that does not depend
+// on where its module is: the module path followed by the path of the file
+// in the module, as example.com/shop/store/store.go, or, outside a module,
+// the import path or name of the package followed by the name of the file
+func modulePath(pkg *Package, file string) string {
+	if gomod := findGoMod(filepath.Dir(file)); gomod != "" {
+		if data, err := os.ReadFile(gomod); err == nil {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				abs = file
+			}
+			if rel, err := filepath.Rel(filepath.Dir(gomod), abs); err == nil {
+				if module := directive(data, "module"); module != "" {
+					return module + "/" + filepath.ToSlash(rel)
+				}
+			}
+		}
+	}
+	path := pkg.ImportPath
+	if path == "" {
+		path = pkg.Name
+	}
+	return path + "/" + filepath.Base(file)
+}
+
+// NewBaseline returns the baseline accepting the findings of results, in
+// order of file, check, variable and fingerprint so that it changes little
+// when lines shift
+func NewBaseline(results []*PackageResult) *Baseline {
+	b := &Baseline{Findings: []BaselineFinding{}}
+	for _, r := range results {
+		for _, f := range r.Findings {
+			b.Findings = append(b.Findings, BaselineFinding{Fingerprint: f.Fingerprint, Check: f.Check, Var: f.Var, File: f.File, Message: f.Message})
+		}
+	}
+	sort.Slice(b.Findings, func(i, j int) bool {
+		x, y := b.Findings[i], b.Findings[j]
+		if x.File != y.File {
+			return x.File < y.File
+		}
+		if x.Check != y.Check {
+			return x.Check < y.Check
+		}
+		if x.Var != y.Var {
+			return x.Var < y.Var
+		}
+		return x.Fingerprint < y.Fingerprint
+	})
+	return b
+}
+
+// ReadBaseline reads a baseline written by Write
+func ReadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &Baseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Write writes a baseline as JSON
+func (b *Baseline) Write(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Apply removes the findings of results that the baseline accepts, counting
+// them in Baselined, and returns the number of findings left. Each finding
+// of the baseline accepts one finding with its fingerprint.
+func (b *Baseline) Apply(results []*PackageResult) int {
+	accepted := make(map[string]int)
+	for _, f := range b.Findings {
+		accepted[f.Fingerprint]++
+	}
+	left := 0
+	for _, r := range results {
+		findings := []Finding{}
+		for _, f := range r.Findings {
+			if accepted[f.Fingerprint] > 0 {
+				accepted[f.Fingerprint]--
+				r.Baselined++
+				continue
+			}
+			findings = append(findings, f)
+		}
+		r.Findings = findings
+		left += len(findings)
+	}
+	return left
+}
@@ -0,0 +1,253 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Kinds of goroutines
+const (
+	// GoStatement is a goroutine started by a go statement
+	GoStatement = "go"
+	// SpawnerCall is a closure passed to a spawner such as errgroup Go
+	SpawnerCall = "spawner"
+)
+
+// Where a captured variable is written
+const (
+	WrittenNone    = "none"
+	WrittenInside  = "inside"
+	WrittenOutside = "outside"
+	WrittenBoth    = "both"
+)
+
+// Goroutine is a go statement or spawner call with the variables its closure
+// captures by reference. Positions are those of the go statement or call.
+type Goroutine struct {
+	Kind   string `json:"kind"`
+	Call   string `json:"call"` // Function called by go, or spawner, such as Wrapper1.Go
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+	// Func names the closure as cfg does, or is the function a go statement
+	// calls, which captures nothing
+	Func     string    `json:"func"`
+	Captures []Capture `json:"captures"`
+}
+
+// Capture is a variable of an enclosing function used by a closure.
+// Positions are those of its declaration.
+type Capture struct {
+	Var    string `json:"var"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+	// Written tells whether the variable, or memory reached through it such
+	// as a map element or field, is written inside the closure, outside it
+	// in the enclosing function, both or neither
+	Written string `json:"written"`
+	// Refs are the uses of the variable in the closure and its writes
+	// outside, in source order
+	Refs []Ref `json:"refs"`
+}
+
+// Ref is a use of a captured variable
+type Ref struct {
+	Line   int  `json:"line"`
+	Column int  `json:"column"`
+	Offset int  `json:"offset"`
+	Write  bool `json:"write"`
+	Inside bool `json:"inside"` // In the closure
+}
+
+// Goroutines returns the go statements and spawner calls of a parsed file in
+// source order, with the variables their closures capture. A variable is
+// captured when it is declared in a function enclosing the closure; package
+// variables and names the parser cannot resolve, such as the undeclared
+// placeholders of skeletons, are not.
+func Goroutines(fset *token.FileSet, file *ast.File) []Goroutine {
+	var goroutines []Goroutine
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		var g Goroutine
+		var lits []*ast.FuncLit
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			g = Goroutine{Kind: GoStatement, Call: types.ExprString(n.Call.Fun)}
+			if lit, ok := n.Call.Fun.(*ast.FuncLit); ok {
+				g.Call = "func"
+				lits = append(lits, lit)
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || (sel.Sel.Name != "Go" && sel.Sel.Name != "TryGo") {
+				return true
+			}
+			g = Goroutine{Kind: SpawnerCall, Call: types.ExprString(sel)}
+			for _, arg := range n.Args {
+				if lit, ok := arg.(*ast.FuncLit); ok {
+					lits = append(lits, lit)
+				}
+			}
+			if len(lits) == 0 {
+				return true
+			}
+		default:
+			return true
+		}
+
+		pos := fset.Position(n.Pos())
+		g.Line, g.Column, g.Offset = pos.Line, pos.Column, pos.Offset
+		g.Func, g.Captures = g.Call, []Capture{}
+		scope := outermostFunc(stack)
+		for _, lit := range lits {
+			lpos := fset.Position(lit.Pos())
+			g.Func = fmt.Sprintf("func@%d:%d", lpos.Line, lpos.Column)
+			if scope != nil {
+				g.Captures = captures(fset, lit, scope)
+			}
+			goroutines = append(goroutines, g)
+		}
+		if len(lits) == 0 {
+			goroutines = append(goroutines, g)
+		}
+		return true
+	})
+	return goroutines
+}
+
+// outermostFunc returns the outermost function declaration or literal of the stack
+func outermostFunc(stack []ast.Node) ast.Node {
+	for _, n := range stack {
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			return n
+		}
+	}
+	return nil
+}
+
+// captures returns the variables declared in scope outside lit that lit
+// uses, in order of first use
+func captures(fset *token.FileSet, lit *ast.FuncLit, scope ast.Node) []Capture {
+	inside := func(pos token.Pos) bool { return pos >= lit.Pos() && pos < lit.End() }
+	var order []*ast.Object
+	byObj := make(map[*ast.Object]*Capture)
+	walkIdents(lit, func(ident *ast.Ident, stack []ast.Node) {
+		obj := ident.Obj
+		if obj == nil || obj.Kind != ast.Var || inside(obj.Pos()) || obj.Pos() < scope.Pos() || obj.Pos() >= scope.End() {
+			return
+		}
+		if ident.Pos() == obj.Pos() {
+			return
+		}
+		c, ok := byObj[obj]
+		if !ok {
+			pos := fset.Position(obj.Pos())
+			c = &Capture{Var: obj.Name, Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+			byObj[obj] = c
+			order = append(order, obj)
+		}
+		pos := fset.Position(ident.Pos())
+		c.Refs = append(c.Refs, Ref{Line: pos.Line, Column: pos.Column, Offset: pos.Offset, Write: isModified(ident, stack), Inside: true})
+	})
+	if len(order) == 0 {
+		return []Capture{}
+	}
+
+	walkIdents(scope, func(ident *ast.Ident, stack []ast.Node) {
+		c, ok := byObj[ident.Obj]
+		if !ok || inside(ident.Pos()) || ident.Pos() == ident.Obj.Pos() || !isModified(ident, stack) {
+			return
+		}
+		pos := fset.Position(ident.Pos())
+		c.Refs = append(c.Refs, Ref{Line: pos.Line, Column: pos.Column, Offset: pos.Offset, Write: true})
+	})
+
+	var out []Capture
+	for _, obj := range order {
+		c := byObj[obj]
+		in, outside := false, false
+		for _, r := range c.Refs {
+			in = in || r.Write && r.Inside
+			outside = outside || r.Write && !r.Inside
+		}
+		switch {
+		case in && outside:
+			c.Written = WrittenBoth
+		case in:
+			c.Written = WrittenInside
+		case outside:
+			c.Written = WrittenOutside
+		default:
+			c.Written = WrittenNone
+		}
+		sort.SliceStable(c.Refs, func(i, j int) bool { return c.Refs[i].Offset < c.Refs[j].Offset })
+		out = append(out, *c)
+	}
+	return out
+}
+
+// walkIdents calls f for each identifier under root with the stack of its
+// ancestors, from root down to the identifier
+func walkIdents(root ast.Node, f func(*ast.Ident, []ast.Node)) {
+	var stack []ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		if ident, ok := n.(*ast.Ident); ok {
+			f(ident, stack)
+		}
+		return true
+	})
+}
+
+// isModified checks if an identifier, the top of the stack, is written, or
+// memory reached through it is: a field, element or pointee assigned,
+// incremented or deleted from. A short variable declaration writes the
+// variables it redeclares.
+func isModified(ident *ast.Ident, stack []ast.Node) bool {
+	var child ast.Expr = ident
+	for i := len(stack) - 2; i >= 0; i-- {
+		switch p := stack[i].(type) {
+		case *ast.SelectorExpr:
+			if p.X != child {
+				return false
+			}
+		case *ast.IndexExpr:
+			if p.X != child {
+				return false
+			}
+		case *ast.StarExpr, *ast.ParenExpr:
+		case *ast.AssignStmt:
+			for _, lhs := range p.Lhs {
+				if lhs == child {
+					return p.Tok != token.DEFINE || ident.Obj == nil || ident.Obj.Pos() != ident.Pos()
+				}
+			}
+			return false
+		case *ast.IncDecStmt:
+			return p.X == child
+		case *ast.RangeStmt:
+			return p.Tok == token.ASSIGN && (p.Key == child || p.Value == child)
+		case *ast.CallExpr:
+			fun, ok := p.Fun.(*ast.Ident)
+			return ok && fun.Name == "delete" && len(p.Args) > 0 && p.Args[0] == child
+		default:
+			return false
+		}
+		child = stack[i].(ast.Expr)
+	}
+	return false
+}
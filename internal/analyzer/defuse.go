@@ -0,0 +1,509 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+
+	"github.com/uber/data-race-skeletons/internal/cfg"
+)
+
+// Kinds of definitions, besides Write
+const (
+	Declaration = "declaration"
+	Parameter   = "parameter"
+)
+
+// How a definition reaches a read
+const (
+	// FlowLocal is a definition in the function of the read that reaches it
+	// along the control flow
+	FlowLocal = "local"
+	// FlowCaptured is a definition of an enclosing function that reaches the
+	// statement creating the closure of the read
+	FlowCaptured = "captured"
+	// FlowClosure is a definition in another function, such as a closure or
+	// the function it captures the variable from, that may run between the
+	// creation of the closure and the read
+	FlowClosure = "closure"
+)
+
+// Relations between a read and its definitions
+const (
+	// RelationSequential is a read whose definitions all precede it in the
+	// same goroutine
+	RelationSequential = "sequential"
+	// RelationSpawnerToGoroutine is a read in a goroutine of a value written
+	// by the spawning function before the goroutine starts
+	RelationSpawnerToGoroutine = "spawner-to-goroutine"
+	// RelationConcurrent is a read that a definition of another goroutine
+	// may reach
+	RelationConcurrent = "concurrent"
+	// RelationConcurrentRMW is a concurrent read of a read-modify-write, such
+	// as racyVar0++
+	RelationConcurrentRMW = "concurrent-read-modify-write"
+)
+
+// DefUse is a read of a racy variable with the definitions that may reach it
+type DefUse struct {
+	Var    string `json:"var"`
+	Expr   string `json:"expr"` // Accessed expression, such as v1.racyVar0
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+	Func   string `json:"func"` // Function of the read, named as by cfg
+	// Goroutine is set when the read runs in a spawned goroutine
+	Goroutine bool `json:"goroutine"`
+	// ReadModifyWrite is set when the statement of the read also writes the
+	// variable, as in racyVar0++ or racyVar0 = racyVar0 + 1
+	ReadModifyWrite bool   `json:"read_modify_write"`
+	Relation        string `json:"relation"`
+	Defs            []Def  `json:"defs"`
+}
+
+// Def is a definition of a racy variable
+type Def struct {
+	Kind   string `json:"kind"` // declaration, parameter or write
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+	Func   string `json:"func"`
+	Flow   string `json:"flow"`
+	// Concurrent is set when the definition may run in another goroutine
+	// than the read, including another instance of a goroutine spawned in
+	// a loop, and no synchronization orders them
+	Concurrent bool `json:"concurrent"`
+	// Sync is the synchronization that orders a definition of another
+	// goroutine with the read, as for Pair
+	Sync string `json:"sync,omitempty"`
+}
+
+// occurrence is a definition or use of a racy variable
+type occurrence struct {
+	ident *ast.Ident
+	expr  ast.Expr
+	key   string // The variable, and the fields selected from it
+	def   string // Kind of definition, or "" for a use only
+	use   bool
+	fn    *function
+	node  *cfg.Node
+}
+
+// function is a function declaration or literal with a body
+type function struct {
+	graph  *cfg.Graph
+	name   string
+	parent *function
+	// creation is the node of the parent at which a literal is created
+	creation *cfg.Node
+	spawned  bool
+	// group is the spawner a literal is passed to, such as Wrapper1 for
+	// Wrapper1.Go, and once the value whose Do method it is passed to
+	group, once string
+	ops         []syncOp
+	// in maps each node to the definitions reaching it
+	in map[*cfg.Node]map[*occurrence]bool
+}
+
+// DefUseChains returns, for each read of a racy variable in a function of a
+// parsed file, the definitions that may reach it. Definitions reach a read
+// along the control flow of its function, killed by later definitions of the
+// same variable or field, and into closures from the statement creating them.
+// Definitions in other functions are added when they may run between the
+// creation of a closure and the read, since closures may run at any time.
+func DefUseChains(fset *token.FileSet, file *ast.File) []DefUse {
+	p := newProgram(fset, []*ast.File{file}, racyVars{})
+	var chains []DefUse
+	for _, u := range p.occs {
+		if u.use {
+			chains = append(chains, p.chain(u))
+		}
+	}
+	return chains
+}
+
+// program holds the functions of the files of a package and the
+// occurrences of the variables it tracks in them, with the definitions
+// reaching each node
+type program struct {
+	fset  *token.FileSet
+	funcs []*function // In source order, parents before the literals they contain
+	occs  []*occurrence
+	// channels maps the channels made in the files to whether they are unbuffered
+	channels map[string]bool
+}
+
+// selection chooses the identifiers a program tracks, and keys the
+// expressions they are accessed through
+type selection interface {
+	selects(ident *ast.Ident, stack []ast.Node) bool
+	key(expr ast.Expr, stack []ast.Node) string
+}
+
+// racyVars selects the racy variables of skeletons
+type racyVars struct{}
+
+func (racyVars) selects(ident *ast.Ident, stack []ast.Node) bool { return isRacyVarWrite(ident) }
+
+func (racyVars) key(expr ast.Expr, stack []ast.Node) string { return occurrenceKey(expr) }
+
+func newProgram(fset *token.FileSet, files []*ast.File, sel selection) *program {
+	p := &program{fset: fset, channels: make(map[string]bool)}
+	lits := make(map[*ast.FuncLit]string)
+	names := make(map[string]bool)
+	onces := make(map[*ast.FuncLit]string)
+	for _, file := range files {
+		for ch, unbuffered := range unbufferedChannels(file) {
+			p.channels[ch] = unbuffered
+		}
+		l, n := spawned(file)
+		for lit, group := range l {
+			lits[lit] = group
+		}
+		for name := range n {
+			names[name] = true
+		}
+		for lit, once := range onceLits(file) {
+			onces[lit] = once
+		}
+	}
+	for _, file := range files {
+		p.add(file, sel, lits, names, onces)
+	}
+
+	// Parents come before the literals they contain, so that the definitions
+	// reaching the creation of a literal are known when it is solved
+	for _, f := range p.funcs {
+		f.solve(p.occs)
+		f.ops = syncOps(f, p.channels)
+	}
+	return p
+}
+
+// add adds the functions of a file and the occurrences sel selects in them
+func (p *program) add(file *ast.File, sel selection, lits map[*ast.FuncLit]string, names map[string]bool, onces map[*ast.FuncLit]string) {
+	fset := p.fset
+	funcs := make(map[ast.Node]*function)
+	var stack []ast.Node
+	var fstack []*function
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			if _, ok := funcs[stack[len(stack)-1]]; ok {
+				fstack = fstack[:len(fstack)-1]
+			}
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		switch n := n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			g := cfg.New(n)
+			if g == nil {
+				break
+			}
+			f := &function{graph: g, name: g.Name(fset)}
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				f.group, f.spawned = lits[n]
+				f.once = onces[n]
+			case *ast.FuncDecl:
+				f.spawned = names[n.Name.Name]
+			}
+			if len(fstack) > 0 {
+				f.parent = fstack[len(fstack)-1]
+				f.creation = enclosingNode(f.parent, stack[:len(stack)-1])
+			}
+			funcs[n] = f
+			p.funcs = append(p.funcs, f)
+			fstack = append(fstack, f)
+		case *ast.Ident:
+			if len(fstack) > 0 && sel.selects(n, stack) {
+				if o := newOccurrence(n, stack, fstack[len(fstack)-1]); o != nil {
+					o.key = sel.key(o.expr, stack)
+					p.occs = append(p.occs, o)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// spawned returns the function literals run as goroutines, by go statements
+// or spawner calls such as errgroup Go, with the spawner they are passed to,
+// and the names of the functions and methods go statements call
+func spawned(file *ast.File) (map[*ast.FuncLit]string, map[string]bool) {
+	lits := make(map[*ast.FuncLit]string)
+	names := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			switch fun := n.Call.Fun.(type) {
+			case *ast.FuncLit:
+				lits[fun] = ""
+			case *ast.Ident:
+				names[fun.Name] = true
+			case *ast.SelectorExpr:
+				names[fun.Sel.Name] = true
+			}
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Go" || sel.Sel.Name == "TryGo") {
+				for _, arg := range n.Args {
+					if lit, ok := arg.(*ast.FuncLit); ok {
+						lits[lit] = types.ExprString(sel.X)
+					}
+				}
+			}
+		}
+		return true
+	})
+	return lits, names
+}
+
+// enclosingNode returns the node of f of the innermost statement of the
+// stack that is one, or the entry of f for its parameters
+func enclosingNode(f *function, stack []ast.Node) *cfg.Node {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == f.graph.Func {
+			break
+		}
+		if s, ok := stack[i].(ast.Stmt); ok {
+			if n := f.graph.Node(s); n != nil {
+				return n
+			}
+		}
+	}
+	return f.graph.Entry
+}
+
+// newOccurrence returns the occurrence of a tracked identifier, the top of
+// the stack, in f, or nil if it declares a struct field. Its key is left to
+// the selection.
+func newOccurrence(ident *ast.Ident, stack []ast.Node, f *function) *occurrence {
+	o := &occurrence{ident: ident, fn: f, node: enclosingNode(f, stack)}
+	o.expr = accessedExpr(ident, stack)
+	parent := stack[len(stack)-2]
+	switch {
+	case isWritten(ident, stack):
+		o.def = Write
+		// Increments and compound assignments also read the variable
+		switch s := statementOf(stack).(type) {
+		case *ast.IncDecStmt:
+			o.use = true
+		case *ast.AssignStmt:
+			o.use = s.Tok != token.ASSIGN && s.Tok != token.DEFINE
+		}
+	case isDeclaration(ident, parent):
+		o.def = Declaration
+		if _, ok := parent.(*ast.Field); ok {
+			if len(stack) < 4 {
+				return nil
+			}
+			if _, ok := stack[len(stack)-4].(*ast.FuncType); !ok {
+				return nil
+			}
+			o.def = Parameter
+		}
+	default:
+		o.use = true
+	}
+	return o
+}
+
+// statementOf returns the innermost node of the stack that is not an expression
+func statementOf(stack []ast.Node) ast.Node {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if _, ok := stack[i].(ast.Expr); !ok {
+			return stack[i]
+		}
+	}
+	return nil
+}
+
+// occurrenceKey identifies the variable an accessed expression is rooted at,
+// by its declaration if the parser resolved it, followed by the selected
+// fields
+func occurrenceKey(expr ast.Expr) string {
+	root := expr
+	for {
+		switch e := root.(type) {
+		case *ast.SelectorExpr:
+			root = e.X
+			continue
+		case *ast.StarExpr:
+			root = e.X
+			continue
+		case *ast.ParenExpr:
+			root = e.X
+			continue
+		}
+		break
+	}
+	text := types.ExprString(expr)
+	if id, ok := root.(*ast.Ident); ok && id.Obj != nil {
+		text += "@" + strconv.Itoa(int(id.Obj.Pos()))
+	}
+	return text
+}
+
+// solve computes the definitions reaching each node of f
+func (f *function) solve(occs []*occurrence) {
+	defs := make(map[*cfg.Node][]*occurrence)
+	for _, o := range occs {
+		if o.fn == f && o.def != "" {
+			defs[o.node] = append(defs[o.node], o)
+		}
+	}
+	var captured map[*occurrence]bool
+	if f.parent != nil {
+		captured = f.parent.in[f.creation]
+	}
+
+	f.in = make(map[*cfg.Node]map[*occurrence]bool)
+	out := make(map[*cfg.Node]map[*occurrence]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range f.graph.Nodes {
+			in := make(map[*occurrence]bool)
+			if n == f.graph.Entry {
+				for d := range captured {
+					in[d] = true
+				}
+			}
+			for _, p := range n.Preds {
+				for d := range out[p] {
+					in[d] = true
+				}
+			}
+			killed := make(map[string]bool)
+			for _, d := range defs[n] {
+				killed[d.key] = true
+			}
+			next := make(map[*occurrence]bool)
+			for d := range in {
+				if !killed[d.key] {
+					next[d] = true
+				}
+			}
+			for _, d := range defs[n] {
+				next[d] = true
+			}
+			if len(in) != len(f.in[n]) || len(next) != len(out[n]) {
+				changed = true
+			}
+			f.in[n], out[n] = in, next
+		}
+	}
+}
+
+// root returns the function whose goroutine f runs in: the innermost
+// spawned function enclosing it, or the outermost function
+func (f *function) root() *function {
+	for !f.spawned && f.parent != nil {
+		f = f.parent
+	}
+	return f
+}
+
+// multiple reports whether several instances of f, a spawned function, may
+// run at once because it is spawned in a loop
+func (f *function) multiple() bool {
+	return f.spawned && f.parent != nil && f.parent.graph.Reaches(f.creation, f.creation)
+}
+
+// childOf returns the child of a that encloses f, or nil if a does not
+func childOf(a, f *function) *function {
+	for ; f != nil; f = f.parent {
+		if f.parent == a {
+			return f
+		}
+	}
+	return nil
+}
+
+// mayFollow reports whether a definition in another function than the read
+// may run after the creation of the closure it is in or the read is in, and
+// so reach the read
+func mayFollow(d, u *occurrence) bool {
+	if c := childOf(d.fn, u.fn); c != nil {
+		// The definition is in an enclosing function of the read
+		return d.fn.graph.Reaches(c.creation, d.node)
+	}
+	if c := childOf(u.fn, d.fn); c != nil {
+		// The read is in an enclosing function of the definition
+		return c.creation == u.node || u.fn.graph.Reaches(c.creation, u.node)
+	}
+	return true
+}
+
+func (p *program) chain(u *occurrence) DefUse {
+	pos := p.fset.Position(u.ident.Pos())
+	root := u.fn.root()
+	c := DefUse{
+		Var:       u.ident.Name,
+		Expr:      types.ExprString(u.expr),
+		Line:      pos.Line,
+		Column:    pos.Column,
+		Offset:    pos.Offset,
+		Func:      u.fn.name,
+		Goroutine: root.spawned,
+		Defs:      []Def{},
+	}
+
+	add := func(d *occurrence, flow string) {
+		dpos := p.fset.Position(d.ident.Pos())
+		droot := d.fn.root()
+		concurrent := droot == root && root.multiple()
+		if flow == FlowClosure && droot != root {
+			concurrent = droot.spawned || root.spawned
+		}
+		sync := ""
+		if concurrent {
+			if sync = p.order(d, u); sync != "" {
+				concurrent = false
+			}
+		}
+		c.Defs = append(c.Defs, Def{
+			Kind:       d.def,
+			Line:       dpos.Line,
+			Column:     dpos.Column,
+			Offset:     dpos.Offset,
+			Func:       d.fn.name,
+			Flow:       flow,
+			Concurrent: concurrent,
+			Sync:       sync,
+		})
+	}
+	reaching := u.fn.in[u.node]
+	for _, d := range p.occs {
+		if d.def == "" || d.key != u.key {
+			continue
+		}
+		if d.fn == u.fn && d.node == u.node {
+			c.ReadModifyWrite = true
+		}
+		switch {
+		case reaching[d] && d.fn == u.fn:
+			add(d, FlowLocal)
+		case reaching[d]:
+			add(d, FlowCaptured)
+		case d.fn.root() == root && root.multiple(), d.fn != u.fn && mayFollow(d, u):
+			add(d, FlowClosure)
+		}
+	}
+	sort.SliceStable(c.Defs, func(i, j int) bool { return c.Defs[i].Offset < c.Defs[j].Offset })
+
+	c.Relation = RelationSequential
+	for _, d := range c.Defs {
+		switch {
+		case d.Concurrent && c.ReadModifyWrite:
+			c.Relation = RelationConcurrentRMW
+		case d.Concurrent && c.Relation != RelationConcurrentRMW:
+			c.Relation = RelationConcurrent
+		case d.Flow == FlowCaptured && c.Goroutine && c.Relation == RelationSequential:
+			c.Relation = RelationSpawnerToGoroutine
+		}
+	}
+	return c
+}
@@ -0,0 +1,226 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// CheckFieldRace reports fields of a type written in one method and
+// accessed in another that may run concurrently
+const CheckFieldRace = "field-race"
+
+// typeInfo is what a struct type and its methods tell about its concurrent use
+type typeInfo struct {
+	// mutexes are the Mutex and RWMutex fields, named as the locks of
+	// functionLocks are
+	mutexes []string
+	// concurrent is set when the type has a mutex, or a method starts a
+	// goroutine or is started as one
+	concurrent bool
+}
+
+// FieldRaces finds the fields of the struct types of a package that are
+// written in one method and read or written in another, when the two
+// methods may run concurrently and no mutex is held at both accesses. The
+// methods of a type may run concurrently when the type is used
+// concurrently: it has a Mutex or RWMutex field, or one of its methods
+// starts a goroutine or is started as one. Accesses in closures count for
+// the method they are in.
+func FieldRaces(pkg *Package) []Finding {
+	return newPass(pkg).fieldRaces()
+}
+
+func (a *pass) fieldRaces() []Finding {
+	p := a.prog
+	types := a.structTypes()
+	keys, byKey := a.accesses()
+	var findings []Finding
+	for _, key := range keys {
+		var methods []*function
+		byMethod := make(map[*function][]*occurrence)
+		var t string
+		for _, o := range byKey[key] {
+			m, recv := method(o.fn)
+			if m == nil || !strings.HasPrefix(key, "("+recv+").") {
+				continue
+			}
+			t = recv
+			if _, ok := byMethod[m]; !ok {
+				methods = append(methods, m)
+			}
+			byMethod[m] = append(byMethod[m], o)
+		}
+		info := types[t]
+		if info == nil || !info.concurrent {
+			continue
+		}
+		for i, mi := range methods {
+			for _, mj := range methods[i+1:] {
+				wm, om := mi, mj
+				w, o := a.unguarded(byMethod[mi], byMethod[mj])
+				if w == nil {
+					wm, om = mj, mi
+					w, o = a.unguarded(byMethod[mj], byMethod[mi])
+				}
+				if w == nil {
+					continue
+				}
+				first, second := p.location(w, Write), p.location(o, accessKind(o))
+				first.Locks, second.Locks = a.locks[w.fn].protecting(w), a.locks[o.fn].protecting(o)
+				verb := "read"
+				if o.def == Write {
+					verb = "written"
+				}
+				findings = append(findings, Finding{
+					Check:  CheckFieldRace,
+					Var:    key,
+					File:   first.File,
+					Line:   first.Line,
+					Column: first.Column,
+					Func:   first.Func,
+					Message: fmt.Sprintf("%s is written in %s and %s in %s, which may run concurrently; %s",
+						key, wm.name, verb, om.name, guard(info, wm.name, om.name, first.Locks, second.Locks)),
+					Related: []Location{first, second},
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// unguarded returns the first write of ws and access of others, in source
+// order, that no lock held at both protects and that no synchronization
+// orders, or nils
+func (a *pass) unguarded(ws, others []*occurrence) (*occurrence, *occurrence) {
+	for _, w := range ws {
+		if w.def != Write {
+			continue
+		}
+		held := make(map[string]bool)
+		for _, l := range a.locks[w.fn].protecting(w) {
+			held[l] = true
+		}
+		for _, o := range others {
+			common := false
+			for _, l := range a.locks[o.fn].protecting(o) {
+				common = common || held[l]
+			}
+			if !common && a.prog.order(w, o) == "" {
+				return w, o
+			}
+		}
+	}
+	return nil, nil
+}
+
+// guard describes the locks held at the two accesses of a field race
+func guard(info *typeInfo, wm, om string, wl, ol []string) string {
+	switch {
+	case len(wl) == 0 && len(ol) == 0 && len(info.mutexes) == 0:
+		return "no mutex field guards them"
+	case len(wl) == 0 && len(ol) == 0:
+		return "neither holds " + strings.Join(info.mutexes, " or ")
+	case len(ol) == 0:
+		return "only " + wm + " holds " + strings.Join(wl, " and ")
+	case len(wl) == 0:
+		return "only " + om + " holds " + strings.Join(ol, " and ")
+	}
+	return "they hold no common lock"
+}
+
+// method returns the method f is, or is a closure in, with the name of its
+// receiver type, or nil
+func method(f *function) (*function, string) {
+	m := methodOf(f)
+	decl, ok := m.graph.Func.(*ast.FuncDecl)
+	if !ok || decl.Recv == nil || len(decl.Recv.List) != 1 {
+		return nil, ""
+	}
+	return m, receiverType(decl.Recv.List[0].Type)
+}
+
+// methodOf returns the outermost function enclosing f, or f
+func methodOf(f *function) *function {
+	for f.parent != nil {
+		f = f.parent
+	}
+	return f
+}
+
+// structTypes returns the struct types of the package by name
+func (a *pass) structTypes() map[string]*typeInfo {
+	types := make(map[string]*typeInfo)
+	for _, file := range a.pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			info := &typeInfo{}
+			for _, field := range st.Fields.List {
+				if !isMutex(field.Type) {
+					continue
+				}
+				if len(field.Names) == 0 {
+					info.mutexes = append(info.mutexes, "("+spec.Name.Name+")")
+				}
+				for _, name := range field.Names {
+					info.mutexes = append(info.mutexes, "("+spec.Name.Name+")."+name.Name)
+				}
+			}
+			info.concurrent = len(info.mutexes) > 0
+			types[spec.Name.Name] = info
+			return true
+		})
+	}
+	for _, f := range a.prog.funcs {
+		m, recv := method(f)
+		if m == nil || types[recv] == nil {
+			continue
+		}
+		if f.spawned {
+			types[recv].concurrent = true
+		}
+		if f == m && startsGoroutine(f.graph.Func) {
+			types[recv].concurrent = true
+		}
+	}
+	return types
+}
+
+// isMutex reports whether a field type is a sync.Mutex or sync.RWMutex, or
+// a pointer to one
+func isMutex(expr ast.Expr) bool {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "sync" && (sel.Sel.Name == "Mutex" || sel.Sel.Name == "RWMutex")
+}
+
+// startsGoroutine reports whether a function contains a go statement or a
+// spawner call
+func startsGoroutine(fn ast.Node) bool {
+	found := false
+	ast.Inspect(fn, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			found = true
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && (sel.Sel.Name == "Go" || sel.Sel.Name == "TryGo") {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
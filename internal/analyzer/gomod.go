@@ -0,0 +1,99 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// goVersion overrides the Go language version read from go.mod files when set
+var goVersion string
+
+// SetGoVersion sets the Go language version the analyzed code is compiled
+// with, such as 1.21, in place of the go directive of the nearest go.mod.
+// An empty version restores reading it from go.mod.
+func SetGoVersion(version string) {
+	goVersion = version
+}
+
+// findGoVersion returns the Go language version of the code in a
+// directory: the one set by SetGoVersion, or else the go directive of the
+// nearest go.mod in it or a parent directory, or "" if there is none
+func findGoVersion(dir string) string {
+	if goVersion != "" {
+		return goVersion
+	}
+	path := findGoMod(dir)
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return directive(data, "go")
+}
+
+// findGoMod returns the path of the nearest go.mod in a directory or its
+// parents, or ""
+func findGoMod(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, "go.mod")
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// directive returns the argument of a directive of a go.mod file, such as
+// the version of go or the path of module, unquoted
+func directive(data []byte, verb string) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != verb {
+			continue
+		}
+		if arg, err := strconv.Unquote(fields[1]); err == nil {
+			return arg
+		}
+		return fields[1]
+	}
+	return ""
+}
+
+// sharesLoopVars reports whether the loops of code compiled with a Go
+// language version declare their variables once for all iterations, as
+// before Go 1.22. An unknown version is assumed to.
+func sharesLoopVars(version string) bool {
+	parts := strings.SplitN(strings.TrimPrefix(version, "go"), ".", 3)
+	if len(parts) < 2 {
+		return true
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return true
+	}
+	// Prereleases such as 1.22rc1 have the semantics of the release
+	minor := parts[1]
+	if i := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minor = minor[:i]
+	}
+	n, err := strconv.Atoi(minor)
+	if err != nil {
+		return true
+	}
+	return major < 1 || major == 1 && n < 22
+}
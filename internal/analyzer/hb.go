@@ -0,0 +1,458 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/uber/data-race-skeletons/internal/cfg"
+)
+
+// Orders of a pair of accesses
+const (
+	Ordered               = "ordered"
+	PotentiallyConcurrent = "potentially-concurrent"
+)
+
+// Synchronizations that order accesses of different goroutines
+const (
+	// SyncGo orders what the spawning function does before a go statement or
+	// spawner call before the goroutine
+	SyncGo = "go"
+	// SyncWait orders a goroutine before the return of a Wait on the
+	// WaitGroup it calls Done on, or on the errgroup it was passed to
+	SyncWait = "wait"
+	// SyncChannel orders a send or close before the receive it completes,
+	// and a receive before the completion of its send on an unbuffered channel
+	SyncChannel = "channel"
+	// SyncOnce orders the function passed to Do of a sync.Once before the
+	// return of every Do on it, and runs it only once
+	SyncOnce = "once"
+)
+
+// Pair is two accesses to a racy variable or field, at least one of them a
+// write, that may run in different goroutines, including two instances of a
+// goroutine spawned in a loop
+type Pair struct {
+	Var    string     `json:"var"`
+	Expr   string     `json:"expr"`
+	First  PairAccess `json:"first"`
+	Second PairAccess `json:"second"`
+	Order  string     `json:"order"`
+	// Sync is the synchronization that orders the accesses, if any
+	Sync string `json:"sync,omitempty"`
+}
+
+// PairAccess is an access of a pair
+type PairAccess struct {
+	Kind   string `json:"kind"` // read or write; an increment is a write
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+	Func   string `json:"func"`
+}
+
+// Kinds of synchronization operations
+const (
+	opDone = iota
+	opWait
+	opDo
+	opSend
+	opClose
+	opRecv
+)
+
+// syncOp is a synchronization operation of a function. Objects are
+// identified by their expression, such as v21 for v21.Wait().
+type syncOp struct {
+	kind     int
+	obj      string
+	node     *cfg.Node
+	deferred bool // Runs at the exit of the function
+}
+
+// Pairs returns the pairs of accesses to racy variables in the functions of
+// a parsed file that may run in different goroutines, in source order,
+// labeled ordered when a happens-before relation exists between them. The
+// model is intraprocedural: goroutines are ordered through the go statements
+// and spawner calls that start them, WaitGroup Done and Wait, errgroup Wait,
+// channel sends, closes and receives, and sync.Once Do, matched by the
+// expression of the object they are called on.
+func Pairs(fset *token.FileSet, file *ast.File) []Pair {
+	p := newProgram(fset, []*ast.File{file}, racyVars{})
+	var accesses []*occurrence
+	for _, o := range p.occs {
+		if o.def == Write || o.use {
+			accesses = append(accesses, o)
+		}
+	}
+	var pairs []Pair
+	for i, a := range accesses {
+		for _, b := range accesses[i:] {
+			if a.key != b.key || a.def != Write && b.def != Write {
+				continue
+			}
+			root := a.fn.root()
+			if root == b.fn.root() && !root.multiple() {
+				continue
+			}
+			pair := Pair{
+				Var:    a.ident.Name,
+				Expr:   types.ExprString(a.expr),
+				First:  p.pairAccess(a),
+				Second: p.pairAccess(b),
+				Order:  PotentiallyConcurrent,
+				Sync:   p.order(a, b),
+			}
+			if pair.Sync != "" {
+				pair.Order = Ordered
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+func (p *program) pairAccess(o *occurrence) PairAccess {
+	pos := p.fset.Position(o.ident.Pos())
+	kind := Read
+	if o.def == Write {
+		kind = Write
+	}
+	return PairAccess{Kind: kind, Line: pos.Line, Column: pos.Column, Offset: pos.Offset, Func: o.fn.name}
+}
+
+// order returns the synchronization by which one of two accesses happens
+// before the other, or ""
+func (p *program) order(x, y *occurrence) string {
+	if sync := p.before(x, y); sync != "" {
+		return sync
+	}
+	return p.before(y, x)
+}
+
+// before returns the synchronization by which x happens before y, or ""
+func (p *program) before(x, y *occurrence) string {
+	if once := x.fn.onceValue(); once != "" {
+		if y.fn.onceValue() == once || mustPass(y.fn, y.node, y.fn.opNodes(opDo, once)) {
+			return SyncOnce
+		}
+	}
+	rx, ry := x.fn.root(), y.fn.root()
+	if rx == ry {
+		return ""
+	}
+
+	// y runs in a goroutine started, directly or not, after x
+	for g := ry; g.spawned && g.parent != nil; g = g.parent.root() {
+		if g.parent.root() != rx {
+			continue
+		}
+		h, nx, s := common(x.fn, x.node, g.parent, g.creation)
+		if h != nil && !h.graph.Reaches(s, nx) && (nx != s || !h.graph.Reaches(s, s)) {
+			return SyncGo
+		}
+	}
+
+	// x runs in a goroutine that y waits for or receives from
+	if rx.spawned && rx.parent != nil && rx.parent.root() == ry {
+		nx := lift(x.fn, x.node, rx)
+		waits := make(map[string]bool)
+		if rx.group != "" {
+			waits[rx.group] = true
+		}
+		chans := make(map[string]bool)
+		for _, op := range rx.ops {
+			switch op.kind {
+			case opDone:
+				waits[op.obj] = waits[op.obj] || rx.follows(nx, op)
+			case opSend, opClose:
+				chans[op.obj] = chans[op.obj] || rx.follows(nx, op)
+			}
+		}
+		h, ny, s := common(y.fn, y.node, rx.parent, rx.creation)
+		if h != nil && (h.graph.Reaches(s, ny) || ny == s) {
+			joins := make(map[*cfg.Node]bool)
+			for _, op := range h.ops {
+				if !op.deferred && op.kind == opWait && waits[op.obj] {
+					joins[op.node] = true
+				}
+			}
+			if len(joins) > 0 && !avoids(h.graph, s, ny, joins) {
+				return SyncWait
+			}
+			recvs := make(map[*cfg.Node]bool)
+			for _, op := range h.ops {
+				if !op.deferred && op.kind == opRecv && chans[op.obj] {
+					recvs[op.node] = true
+				}
+			}
+			for n := range receives(h.graph, recvs, rx.multiple()) {
+				joins[n] = true
+			}
+			if len(joins) > 0 && !avoids(h.graph, s, ny, joins) {
+				return SyncChannel
+			}
+		}
+	}
+
+	// x is followed by a send that y's goroutine receives before y, or by a
+	// receive of an unbuffered channel y's goroutine sends on before y
+	nx, ny := lift(x.fn, x.node, rx), lift(y.fn, y.node, ry)
+	if nx == nil || ny == nil {
+		return ""
+	}
+	for _, op := range rx.ops {
+		var match int
+		switch {
+		case op.kind == opSend || op.kind == opClose:
+			match = opRecv
+		case op.kind == opRecv && p.unbuffered(op.obj):
+			match = opSend
+		default:
+			continue
+		}
+		nodes := ry.opNodes(match, op.obj)
+		if match == opRecv {
+			nodes = receives(ry.graph, nodes, rx.multiple())
+		}
+		if rx.follows(nx, op) && mustPass(ry, ny, nodes) {
+			return SyncChannel
+		}
+	}
+	return ""
+}
+
+// receives returns the nodes through which control must pass to receive
+// from a goroutine: the receives, or, when several instances of the
+// goroutine are spawned in a loop, the loops around the receives, since a
+// single receive completes the send of only one of them
+func receives(g *cfg.Graph, recvs map[*cfg.Node]bool, multiple bool) map[*cfg.Node]bool {
+	if !multiple {
+		return recvs
+	}
+	nodes := make(map[*cfg.Node]bool)
+	for r := range recvs {
+		if !g.Reaches(r, r) {
+			continue
+		}
+		for _, n := range g.Nodes {
+			if g.Reaches(n, r) && g.Reaches(r, n) {
+				nodes[n] = true
+			}
+		}
+	}
+	return nodes
+}
+
+// unbuffered reports whether a channel is made without a buffer in the file
+func (p *program) unbuffered(ch string) bool {
+	return p.channels[ch]
+}
+
+// onceValue returns the sync.Once whose Do runs f, or an enclosing function
+// in the same goroutine, or ""
+func (f *function) onceValue() string {
+	for ; f != nil; f = f.parent {
+		if f.once != "" {
+			return f.once
+		}
+		if f.spawned {
+			break
+		}
+	}
+	return ""
+}
+
+// opNodes returns the nodes of f with an operation of a kind on obj that
+// does not run deferred
+func (f *function) opNodes(kind int, obj string) map[*cfg.Node]bool {
+	nodes := make(map[*cfg.Node]bool)
+	for _, op := range f.ops {
+		if op.kind == kind && op.obj == obj && !op.deferred {
+			nodes[op.node] = true
+		}
+	}
+	return nodes
+}
+
+// follows reports whether op runs after node n of f on every path to the
+// exit, which deferred operations do
+func (f *function) follows(n *cfg.Node, op syncOp) bool {
+	if op.deferred || n == op.node {
+		return true
+	}
+	nodes := f.opNodes(op.kind, op.obj)
+	return nodes[n] || !avoids(f.graph, n, f.graph.Exit, nodes)
+}
+
+// mustPass reports whether every path from the entry of f to n passes
+// through one of the nodes, or n is one of them
+func mustPass(f *function, n *cfg.Node, nodes map[*cfg.Node]bool) bool {
+	return len(nodes) > 0 && (nodes[n] || !avoids(f.graph, f.graph.Entry, n, nodes))
+}
+
+// avoids reports whether control can go from one node to another without
+// passing through the blocked nodes
+func avoids(g *cfg.Graph, from, to *cfg.Node, blocked map[*cfg.Node]bool) bool {
+	seen := make(map[*cfg.Node]bool)
+	work := append([]*cfg.Node(nil), from.Succs...)
+	for len(work) > 0 {
+		n := work[len(work)-1]
+		work = work[:len(work)-1]
+		if seen[n] || blocked[n] {
+			continue
+		}
+		if n == to {
+			return true
+		}
+		seen[n] = true
+		work = append(work, n.Succs...)
+	}
+	return false
+}
+
+// lift returns the node of target at which node n of f runs: n itself, or
+// the node creating the closure of target that encloses f. It returns nil if
+// f is not target or a closure in it.
+func lift(f *function, n *cfg.Node, target *function) *cfg.Node {
+	for f != target {
+		if f == nil || f.parent == nil {
+			return nil
+		}
+		f, n = f.parent, f.creation
+	}
+	return n
+}
+
+// common returns the innermost function enclosing both f1 and f2, with the
+// nodes of it at which n1 and n2 run, or a nil function if there is none
+func common(f1 *function, n1 *cfg.Node, f2 *function, n2 *cfg.Node) (*function, *cfg.Node, *cfg.Node) {
+	for h := f1; h != nil; h = h.parent {
+		if m2 := lift(f2, n2, h); m2 != nil {
+			return h, lift(f1, n1, h), m2
+		}
+	}
+	return nil, nil, nil
+}
+
+// onceLits returns the function literals passed to a Do method, with the
+// value it is called on
+func onceLits(file *ast.File) map[*ast.FuncLit]string {
+	lits := make(map[*ast.FuncLit]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Do" && len(call.Args) == 1 {
+			if lit, ok := call.Args[0].(*ast.FuncLit); ok {
+				lits[lit] = types.ExprString(sel.X)
+			}
+		}
+		return true
+	})
+	return lits
+}
+
+// unbufferedChannels returns the variables and fields of a file assigned a
+// channel made without a buffer, mapped to true, and those made with one,
+// mapped to false
+func unbufferedChannels(file *ast.File) map[string]bool {
+	chans := make(map[string]bool)
+	assign := func(lhs, rhs ast.Expr) {
+		call, ok := rhs.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return
+		}
+		if fun, ok := call.Fun.(*ast.Ident); !ok || fun.Name != "make" {
+			return
+		}
+		if _, ok := call.Args[0].(*ast.ChanType); !ok {
+			return
+		}
+		unbuffered := len(call.Args) == 1
+		if len(call.Args) > 1 {
+			if lit, ok := call.Args[1].(*ast.BasicLit); ok && lit.Value == "0" {
+				unbuffered = true
+			}
+		}
+		chans[types.ExprString(lhs)] = unbuffered
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) == len(n.Rhs) {
+				for i := range n.Lhs {
+					assign(n.Lhs[i], n.Rhs[i])
+				}
+			}
+		case *ast.ValueSpec:
+			if len(n.Names) == len(n.Values) {
+				for i := range n.Names {
+					assign(n.Names[i], n.Values[i])
+				}
+			}
+		}
+		return true
+	})
+	return chans
+}
+
+// syncOps returns the synchronization operations of f, leaving out those of
+// the closures it contains. A range over a channel made in the file receives.
+func syncOps(f *function, chans map[string]bool) []syncOp {
+	var ops []syncOp
+	var stack []ast.Node
+	ast.Inspect(f.graph.Func, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if lit, ok := n.(*ast.FuncLit); ok && lit != f.graph.Func {
+			return false
+		}
+		stack = append(stack, n)
+		op := syncOp{kind: -1}
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			switch fun := n.Fun.(type) {
+			case *ast.SelectorExpr:
+				switch fun.Sel.Name {
+				case "Done":
+					op = syncOp{kind: opDone, obj: types.ExprString(fun.X)}
+				case "Wait":
+					op = syncOp{kind: opWait, obj: types.ExprString(fun.X)}
+				case "Do":
+					op = syncOp{kind: opDo, obj: types.ExprString(fun.X)}
+				}
+			case *ast.Ident:
+				if fun.Name == "close" && len(n.Args) == 1 {
+					op = syncOp{kind: opClose, obj: types.ExprString(n.Args[0])}
+				}
+			}
+		case *ast.SendStmt:
+			op = syncOp{kind: opSend, obj: types.ExprString(n.Chan)}
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				op = syncOp{kind: opRecv, obj: types.ExprString(n.X)}
+			}
+		case *ast.RangeStmt:
+			if _, ok := chans[types.ExprString(n.X)]; ok {
+				op = syncOp{kind: opRecv, obj: types.ExprString(n.X)}
+			}
+		}
+		if op.kind < 0 {
+			return true
+		}
+		op.node = enclosingNode(f, stack)
+		for _, s := range stack {
+			if _, ok := s.(*ast.DeferStmt); ok {
+				op.deferred = true
+			}
+		}
+		ops = append(ops, op)
+		return true
+	})
+	return ops
+}
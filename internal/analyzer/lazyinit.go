@@ -0,0 +1,170 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// CheckLazyInit reports shared variables and fields checked for being unset
+// and then set without synchronization
+const CheckLazyInit = "lazy-init"
+
+// Roles of the sites of a lazy initialization
+const (
+	roleCheck = "check"
+	roleSet   = "set"
+)
+
+// LazyInits finds the check-then-set idioms of a package, such as
+// if x == nil { x = make(...) } or if !initialized { ...; initialized = true },
+// on shared variables and fields that may run concurrently: in a method of a
+// type used concurrently (see FieldRaces), in a goroutine, or while another
+// access of the variable may run concurrently with the set. An idiom is
+// synchronized when it runs in the function passed to a sync.Once, or a lock
+// is held at both the check and the set; double-checked locking, where only
+// the set is locked, is reported.
+func LazyInits(pkg *Package) []Finding {
+	return newPass(pkg).lazyInits()
+}
+
+func (a *pass) lazyInits() []Finding {
+	p := a.prog
+	types := a.structTypes()
+	_, byKey := a.accesses()
+	byIdent := make(map[*ast.Ident]*occurrence)
+	for _, o := range p.occs {
+		byIdent[o.ident] = o
+	}
+
+	var findings []Finding
+	for _, file := range a.pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			stmt, ok := n.(*ast.IfStmt)
+			if !ok {
+				return true
+			}
+			for _, x := range unsetTests(stmt.Cond) {
+				check := byIdent[accessedIdent(x)]
+				if check == nil || check.expr != x {
+					continue
+				}
+				var set *occurrence
+				for _, o := range byKey[check.key] {
+					if o.def == Write && o.ident.Pos() >= stmt.Body.Pos() && o.ident.End() <= stmt.Body.End() {
+						set = o
+						break
+					}
+				}
+				if set == nil || check.fn.onceValue() != "" {
+					continue
+				}
+				checkLocks := a.locks[check.fn].protectingAs(check, false)
+				setLocks := a.locks[set.fn].protecting(set)
+				if sharesLock(checkLocks, setLocks) {
+					continue
+				}
+
+				var conflicting *occurrence
+				for _, o := range byKey[check.key] {
+					if a.conflict(set, o, true, o.def == Write) {
+						conflicting = o
+						break
+					}
+				}
+				m, recv := method(check.fn)
+				concurrentMethod := m != nil && types[recv] != nil && types[recv].concurrent
+				if !concurrentMethod && !check.fn.root().spawned && conflicting == nil {
+					continue
+				}
+
+				first, second := p.location(check, roleCheck), p.location(set, roleSet)
+				first.Locks, second.Locks = checkLocks, setLocks
+				related := []Location{first, second}
+				if conflicting != nil {
+					loc := p.location(conflicting, accessKind(conflicting))
+					loc.Locks = a.locks[conflicting.fn].protecting(conflicting)
+					related = append(related, loc)
+				}
+				name, _ := a.vars.name(check.expr)
+				message := fmt.Sprintf("%s is checked and set in %s without synchronization; use sync.Once, or hold a lock across the check and the set", name, check.fn.name)
+				if len(setLocks) > 0 {
+					message = fmt.Sprintf("%s is checked in %s outside the lock held where it is set; use sync.Once, or hold %s across the check and the set",
+						name, check.fn.name, strings.Join(setLocks, " and "))
+				}
+				findings = append(findings, Finding{
+					Check:   CheckLazyInit,
+					Var:     name,
+					File:    first.File,
+					Line:    first.Line,
+					Column:  first.Column,
+					Func:    first.Func,
+					Message: message,
+					Related: related,
+				})
+			}
+			return true
+		})
+	}
+	return findings
+}
+
+// sharesLock reports whether two sets of locks have one in common
+func sharesLock(x, y []string) bool {
+	for _, l := range x {
+		for _, m := range y {
+			if l == m {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accessedIdent returns the identifier an accessed expression ends with:
+// the variable, or the selected field
+func accessedIdent(x ast.Expr) *ast.Ident {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x
+	case *ast.SelectorExpr:
+		return x.Sel
+	}
+	return nil
+}
+
+// unsetTests returns the expressions a condition tests for being nil, zero,
+// empty or false
+func unsetTests(cond ast.Expr) []ast.Expr {
+	var xs []ast.Expr
+	ast.Inspect(cond, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.BinaryExpr:
+			if e.Op != token.EQL {
+				return true
+			}
+			if isUnset(e.Y) {
+				xs = append(xs, e.X)
+			} else if isUnset(e.X) {
+				xs = append(xs, e.Y)
+			}
+		case *ast.UnaryExpr:
+			if e.Op == token.NOT {
+				xs = append(xs, e.X)
+			}
+		case *ast.FuncLit:
+			return false
+		}
+		return true
+	})
+	return xs
+}
+
+func isUnset(e ast.Expr) bool {
+	if id, ok := e.(*ast.Ident); ok && (id.Name == "nil" || id.Name == "false") {
+		return true
+	}
+	lit, ok := e.(*ast.BasicLit)
+	return ok && (lit.Value == "0" || lit.Value == `""`)
+}
@@ -0,0 +1,369 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+
+	"github.com/uber/data-race-skeletons/internal/cfg"
+)
+
+// CheckLockset reports shared variables and fields whose accesses from
+// potentially concurrent goroutines hold no common lock
+const CheckLockset = "lockset"
+
+// lockset is the set of locks held at a point, mapped to whether they are
+// held for writing
+type lockset map[string]bool
+
+// lockOp is a Lock, RLock, Unlock or RUnlock call of a function
+type lockOp struct {
+	lock    string
+	pos     token.Pos
+	acquire bool
+	write   bool // Lock or Unlock
+}
+
+// functionLocks are the lock operations of a function at each node, and
+// the locks held on entry to each node
+type functionLocks struct {
+	ops map[*cfg.Node][]lockOp
+	in  map[*cfg.Node]lockset
+}
+
+// Lockset runs an Eraser-style lockset analysis on a package. For each
+// shared variable or field, the locks held at every access that may run
+// concurrently with a write are intersected, and the variable is reported
+// when no lock is common to all of them. A lock is held at an access when
+// it is acquired on every path to it in its function, or, for a closure
+// that is not spawned, held where the closure is created. A read lock only
+// protects reads. Deferred unlocks release the lock at the exit of the
+// function. Writing a slice or array element at an index that differs in
+// each goroutine, such as a parameter of the goroutine, does not conflict;
+// at any other index it conflicts with the other element accesses. From Go
+// 1.22, the accesses of loop variables in the header of their loop are
+// left out.
+func Lockset(pkg *Package) []Finding {
+	return newPass(pkg).lockset()
+}
+
+func (a *pass) lockset() []Finding {
+	p, s, locks := a.prog, a.vars, a.locks
+	ops := a.elementOps()
+	headers := a.loopHeaders()
+	elements, lengths := a.elementWrites(ops, headers)
+	isWrite := func(o *occurrence) bool {
+		if distinct, ok := elements[o]; ok {
+			return !distinct
+		}
+		return ops[o] == Write || o.def == Write
+	}
+	conflict := func(x, y *occurrence) bool {
+		if !isWrite(x) && !isWrite(y) {
+			return false
+		}
+		// Reading the length of a slice or array does not read its elements
+		_, ex := elements[x]
+		_, ey := elements[y]
+		return !(ex && lengths[y.ident]) && !(ey && lengths[x.ident])
+	}
+	// Since Go 1.22 the header of a loop accesses the copy of its variables
+	// for the next iteration
+	perIteration := !sharesLoopVars(a.pkg.GoVersion)
+	keys, byKey := a.accesses()
+	var findings []Finding
+	for _, key := range keys {
+		var accesses []*occurrence
+		for _, o := range byKey[key] {
+			if !perIteration || !headers[o.ident] {
+				accesses = append(accesses, o)
+			}
+		}
+		concurrent := make([]bool, len(accesses))
+		for i, x := range accesses {
+			for j := i; j < len(accesses); j++ {
+				y := accesses[j]
+				if conflict(x, y) && p.concurrent(x, y) {
+					concurrent[i], concurrent[j] = true, true
+				}
+			}
+		}
+
+		// common counts, for each lock, the accesses it protects
+		common := make(map[string]int)
+		var related []Location
+		for i, o := range accesses {
+			if !concurrent[i] {
+				continue
+			}
+			role := Read
+			if isWrite(o) {
+				role = Write
+			}
+			loc := p.location(o, role)
+			loc.Locks = locks[o.fn].protectingAs(o, isWrite(o))
+			for _, l := range loc.Locks {
+				common[l]++
+			}
+			related = append(related, loc)
+		}
+		if len(related) == 0 || protectsAll(common, len(related)) {
+			continue
+		}
+		name, _ := s.name(accesses[0].expr)
+		first := firstUnlocked(related)
+		findings = append(findings, Finding{
+			Check:   CheckLockset,
+			Var:     name,
+			File:    first.File,
+			Line:    first.Line,
+			Column:  first.Column,
+			Func:    first.Func,
+			Message: fmt.Sprintf("%s is accessed by concurrent goroutines without a common lock", name),
+			Related: related,
+		})
+	}
+	return findings
+}
+
+// elementWrites returns the index assignments and increments of slice and
+// array elements, mapped to whether their index differs in each goroutine:
+// a parameter of the goroutine or a value it defines, or a loop variable
+// declared for each iteration. It also returns the occurrences whose length
+// or capacity is read.
+func (a *pass) elementWrites(ops map[*occurrence]string, headers map[*ast.Ident]bool) (map[*occurrence]bool, map[*ast.Ident]bool) {
+	kinds := a.kinds()
+	loopObjs := make(map[*ast.Object]bool)
+	for id := range headers {
+		loopObjs[id.Obj] = true
+	}
+	perIteration := !sharesLoopVars(a.pkg.GoVersion)
+	indexes := make(map[*ast.Ident]ast.Expr)
+	lengths := make(map[*ast.Ident]bool)
+	for _, file := range a.pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.IndexExpr:
+				if id := operandIdent(n.X); id != nil {
+					indexes[id] = n.Index
+				}
+			case *ast.CallExpr:
+				if fun, ok := n.Fun.(*ast.Ident); ok && fun.Obj == nil && len(n.Args) == 1 && (fun.Name == "len" || fun.Name == "cap") {
+					if id := operandIdent(n.Args[0]); id != nil {
+						lengths[id] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	elements := make(map[*occurrence]bool)
+	for o, role := range ops {
+		if kind := kindOf(kinds, o); role != Write || kind != kindSlice && kind != kindArray {
+			continue
+		}
+		id, ok := indexes[o.ident].(*ast.Ident)
+		if !ok || id.Obj == nil {
+			elements[o] = false
+			continue
+		}
+		fn := o.fn.root().graph.Func
+		elements[o] = perIteration && loopObjs[id.Obj] || fn.Pos() <= id.Obj.Pos() && id.Obj.Pos() < fn.End()
+	}
+	return elements, lengths
+}
+
+// protectsAll reports whether a lock protects all n accesses
+func protectsAll(common map[string]int, n int) bool {
+	for _, count := range common {
+		if count == n {
+			return true
+		}
+	}
+	return false
+}
+
+// firstUnlocked returns the first access holding no lock that is a write,
+// or else that is a read, or else the first access
+func firstUnlocked(accesses []Location) Location {
+	for _, role := range []string{Write, Read} {
+		for _, a := range accesses {
+			if a.Role == role && len(a.Locks) == 0 {
+				return a
+			}
+		}
+	}
+	return accesses[0]
+}
+
+// protecting returns the locks that protect an occurrence, in order of name:
+// those held for writing for a write, and all held ones for a read
+func (l *functionLocks) protecting(o *occurrence) []string {
+	return l.protectingAs(o, o.def == Write)
+}
+
+// protectingAs returns the locks that protect an occurrence as a write or
+// a read, such as a delete from a map that reads the variable
+func (l *functionLocks) protectingAs(o *occurrence, write bool) []string {
+	held := l.at(o.node, o.ident.Pos())
+	names := []string{}
+	for lock, w := range held {
+		if w || !write {
+			names = append(names, lock)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// at returns the locks held at a position in a node
+func (l *functionLocks) at(n *cfg.Node, pos token.Pos) lockset {
+	held := l.in[n].copy()
+	for _, op := range l.ops[n] {
+		if op.pos < pos {
+			held.apply(op)
+		}
+	}
+	return held
+}
+
+func (ls lockset) copy() lockset {
+	c := make(lockset, len(ls))
+	for l, w := range ls {
+		c[l] = w
+	}
+	return c
+}
+
+func (ls lockset) apply(op lockOp) {
+	if op.acquire {
+		ls[op.lock] = ls[op.lock] || op.write
+	} else {
+		delete(ls, op.lock)
+	}
+}
+
+// meet returns the locks held in both sets, held for writing if they are in both
+func (ls lockset) meet(other lockset) lockset {
+	m := make(lockset)
+	for l, w := range ls {
+		if ow, ok := other[l]; ok {
+			m[l] = w && ow
+		}
+	}
+	return m
+}
+
+func (ls lockset) equal(other lockset) bool {
+	if len(ls) != len(other) {
+		return false
+	}
+	for l, w := range ls {
+		if ow, ok := other[l]; !ok || ow != w {
+			return false
+		}
+	}
+	return true
+}
+
+// locks computes the locks held in the functions of a program. Parents come
+// before the literals they contain, so that the locks held where a closure
+// is created are known when it is solved.
+func (p *program) locks(s *sharedVars) map[*function]*functionLocks {
+	locks := make(map[*function]*functionLocks)
+	for _, f := range p.funcs {
+		entry := make(lockset)
+		if f.parent != nil && !f.spawned {
+			entry = locks[f.parent].at(f.creation, f.graph.Func.Pos())
+		}
+		l := &functionLocks{ops: lockOps(f, s)}
+		l.in = solveLocks(f, l.ops, entry)
+		locks[f] = l
+	}
+	return locks
+}
+
+// lockOps returns the lock operations of f that do not run deferred,
+// leaving out those of the closures it contains, by node in source order
+func lockOps(f *function, s *sharedVars) map[*cfg.Node][]lockOp {
+	ops := make(map[*cfg.Node][]lockOp)
+	var stack []ast.Node
+	ast.Inspect(f.graph.Func, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		if lit, ok := n.(*ast.FuncLit); ok && lit != f.graph.Func {
+			return false
+		}
+		if _, ok := n.(*ast.DeferStmt); ok {
+			return false
+		}
+		stack = append(stack, n)
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		op := lockOp{pos: call.Pos()}
+		switch sel.Sel.Name {
+		case "Lock":
+			op.acquire, op.write = true, true
+		case "RLock":
+			op.acquire = true
+		case "Unlock":
+			op.write = true
+		case "RUnlock":
+		default:
+			return true
+		}
+		op.lock, _ = s.name(sel.X)
+		node := enclosingNode(f, stack)
+		ops[node] = append(ops[node], op)
+		return true
+	})
+	return ops
+}
+
+// solveLocks computes the locks held on entry to each node of f: those held
+// on every path to it from the entry, where entry are held
+func solveLocks(f *function, ops map[*cfg.Node][]lockOp, entry lockset) map[*cfg.Node]lockset {
+	in := make(map[*cfg.Node]lockset)
+	out := make(map[*cfg.Node]lockset)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range f.graph.Nodes {
+			var held lockset
+			if n == f.graph.Entry {
+				held = entry.copy()
+			}
+			for _, p := range n.Preds {
+				if o, ok := out[p]; ok {
+					if held == nil {
+						held = o.copy()
+					} else {
+						held = held.meet(o)
+					}
+				}
+			}
+			if held == nil {
+				// Not reached yet
+				continue
+			}
+			next := held.copy()
+			for _, op := range ops[n] {
+				next.apply(op)
+			}
+			if prev, ok := out[n]; !ok || !prev.equal(next) {
+				changed = true
+			}
+			in[n], out[n] = held, next
+		}
+	}
+	return in
+}
@@ -0,0 +1,222 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// CheckLoopCapture reports loop variables used by goroutines started in the
+// loop when all iterations share them
+const CheckLoopCapture = "loop-capture"
+
+// roleLoop is the role of the declaration of a loop variable
+const roleLoop = "loop"
+
+// LoopCaptures finds the goroutines and spawner closures, such as those
+// passed to errgroup Go, started in the body of a for or range loop that
+// use a variable the loop declares instead of receiving it as an argument.
+// Before Go 1.22 a loop declares its variables once and each iteration
+// assigns them, so the loop writes them while the goroutines read them.
+// Nothing is reported for packages whose Go version is 1.22 or later, which
+// declare them for each iteration. Each variable is reported once for each
+// closure, at its first use, with the spawn site, the declaration and the
+// uses.
+func LoopCaptures(pkg *Package) []Finding {
+	return newPass(pkg).loopCaptures()
+}
+
+func (a *pass) loopCaptures() []Finding {
+	if !sharesLoopVars(a.pkg.GoVersion) {
+		return nil
+	}
+	p := a.prog
+	funcs := make(map[ast.Node]*function)
+	for _, f := range p.funcs {
+		funcs[f.graph.Func] = f
+	}
+	byIdent := make(map[*ast.Ident]*occurrence)
+	for _, o := range p.occs {
+		byIdent[o.ident] = o
+	}
+	version := "an unknown Go version"
+	if a.pkg.GoVersion != "" {
+		version = "go " + a.pkg.GoVersion
+	}
+
+	var findings []Finding
+	for _, file := range a.pkg.Files {
+		var stack []ast.Node
+		ast.Inspect(file, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			stack = append(stack, n)
+			lit, ok := n.(*ast.FuncLit)
+			if !ok || funcs[lit] == nil || !funcs[lit].spawned {
+				return true
+			}
+			f := funcs[lit]
+			decls := loopVars(stack)
+			if len(decls) == 0 {
+				return true
+			}
+
+			// Uses in spawned closures nested in this one are reported
+			// for those
+			var objs []*ast.Object
+			uses := make(map[*ast.Object][]*ast.Ident)
+			ast.Inspect(lit.Body, func(n ast.Node) bool {
+				if nested, ok := n.(*ast.FuncLit); ok && funcs[nested] != nil && funcs[nested].spawned {
+					return false
+				}
+				id, ok := n.(*ast.Ident)
+				if !ok || id.Obj == nil {
+					return true
+				}
+				if _, ok := decls[id.Obj]; !ok {
+					return true
+				}
+				if _, ok := uses[id.Obj]; !ok {
+					objs = append(objs, id.Obj)
+				}
+				uses[id.Obj] = append(uses[id.Obj], id)
+				return true
+			})
+
+			for _, obj := range objs {
+				decl := decls[obj]
+				loopFunc := ""
+				if g := funcs[decl.fn]; g != nil {
+					loopFunc = g.name
+				}
+				related := []Location{}
+				if spawn, ok := p.spawnSite(f); ok {
+					related = append(related, spawn)
+				}
+				related = append(related, a.nodeLocation(decl.ident, roleLoop, loopFunc))
+				for _, id := range uses[obj] {
+					role, name := Read, f.name
+					if o, ok := byIdent[id]; ok {
+						role, name = accessKind(o), o.fn.name
+					}
+					related = append(related, a.nodeLocation(id, role, name))
+				}
+				first := related[len(related)-len(uses[obj])]
+				findings = append(findings, Finding{
+					Check:  CheckLoopCapture,
+					Var:    obj.Name,
+					File:   first.File,
+					Line:   first.Line,
+					Column: first.Column,
+					Func:   first.Func,
+					Message: fmt.Sprintf("loop variable %s of %s is used by a goroutine started in the loop; with %s all iterations share it, so the loop assigns it while the goroutine runs; pass it as an argument or copy it in the loop body",
+						obj.Name, loopFunc, version),
+					Related: related,
+				})
+			}
+			return true
+		})
+	}
+	return findings
+}
+
+// loopDecl is the declaration of a loop variable, in the function with the loop
+type loopDecl struct {
+	ident *ast.Ident
+	fn    ast.Node
+}
+
+// loopVars returns the variables declared by the for and range loops
+// enclosing the last node of a stack in their body
+func loopVars(stack []ast.Node) map[*ast.Object]loopDecl {
+	vars := make(map[*ast.Object]loopDecl)
+	for i := len(stack) - 2; i >= 0; i-- {
+		var idents []ast.Expr
+		switch loop := stack[i].(type) {
+		case *ast.RangeStmt:
+			if loop.Tok == token.DEFINE && stack[i+1] == loop.Body {
+				idents = []ast.Expr{loop.Key, loop.Value}
+			}
+		case *ast.ForStmt:
+			if init, ok := loop.Init.(*ast.AssignStmt); ok && init.Tok == token.DEFINE && stack[i+1] == loop.Body {
+				idents = init.Lhs
+			}
+		}
+		for _, e := range idents {
+			if id, ok := e.(*ast.Ident); ok && id.Name != "_" && id.Obj != nil {
+				vars[id.Obj] = loopDecl{ident: id, fn: enclosingFunc(stack[:i])}
+			}
+		}
+	}
+	return vars
+}
+
+// loopHeaders returns the uses and definitions of loop variables in the
+// headers of the loops declaring them: the range or init statement, the
+// condition and the post statement
+func (a *pass) loopHeaders() map[*ast.Ident]bool {
+	idents := make(map[*ast.Ident]bool)
+	add := func(n ast.Node, objs map[*ast.Object]bool) {
+		if n == nil {
+			return
+		}
+		ast.Inspect(n, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Obj != nil && objs[id.Obj] {
+				idents[id] = true
+			}
+			return true
+		})
+	}
+	for _, file := range a.pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			objs := make(map[*ast.Object]bool)
+			switch loop := n.(type) {
+			case *ast.RangeStmt:
+				if loop.Tok != token.DEFINE {
+					break
+				}
+				for _, e := range []ast.Expr{loop.Key, loop.Value} {
+					if id, ok := e.(*ast.Ident); ok && id.Obj != nil {
+						objs[id.Obj] = true
+						idents[id] = true
+					}
+				}
+			case *ast.ForStmt:
+				init, ok := loop.Init.(*ast.AssignStmt)
+				if !ok || init.Tok != token.DEFINE {
+					break
+				}
+				for _, e := range init.Lhs {
+					if id, ok := e.(*ast.Ident); ok && id.Obj != nil {
+						objs[id.Obj] = true
+					}
+				}
+				add(init, objs)
+				add(loop.Cond, objs)
+				add(loop.Post, objs)
+			}
+			return true
+		})
+	}
+	return idents
+}
+
+// enclosingFunc returns the innermost function declaration or literal of a
+// stack
+func enclosingFunc(stack []ast.Node) ast.Node {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch stack[i].(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			return stack[i]
+		}
+	}
+	return nil
+}
+
+// nodeLocation returns the location of a node in a function
+func (a *pass) nodeLocation(n ast.Node, role, fn string) Location {
+	pos := a.pkg.Fset.Position(n.Pos())
+	return Location{Role: role, File: pos.Filename, Line: pos.Line, Column: pos.Column, Func: fn}
+}
@@ -0,0 +1,369 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// CheckConcurrentMap reports maps whose elements a goroutine writes while
+// the map is accessed concurrently elsewhere
+const CheckConcurrentMap = "concurrent-map"
+
+// Kinds of values, as far as declarations tell
+const (
+	kindUnknown = iota
+	kindMap
+	kindSlice
+	kindArray
+)
+
+// Roles of element writes, besides Write for an index assignment
+const (
+	roleDelete = "delete"
+	roleClear  = "clear"
+)
+
+// ConcurrentMaps finds the maps of a package, in variables or in fields,
+// whose elements a goroutine or spawner closure writes, by index
+// assignment, delete or clear, while another access of the map may run
+// concurrently with no lock held at both and no synchronization ordering
+// them. The Go runtime stops the program when it detects such accesses, so
+// each map is reported once, at its first conflicting element write, with
+// the goroutine's spawn site and all conflicting accesses.
+func ConcurrentMaps(pkg *Package) []Finding {
+	return newPass(pkg).concurrentMaps()
+}
+
+func (a *pass) concurrentMaps() []Finding {
+	p := a.prog
+	kinds := a.kinds()
+	ops := a.elementOps()
+	keys, byKey := a.accesses()
+	var findings []Finding
+	for _, key := range keys {
+		accesses := byKey[key]
+		isMap := false
+		for _, o := range accesses {
+			isMap = isMap || kindOf(kinds, o) == kindMap || ops[o] == roleDelete
+		}
+		if !isMap {
+			continue
+		}
+
+		var first, other *occurrence
+		involved := make(map[*occurrence]bool)
+		for _, w := range accesses {
+			if _, ok := ops[w]; !ok || !w.fn.root().spawned {
+				continue
+			}
+			for _, o := range accesses {
+				if _, write := ops[o]; !a.conflict(w, o, true, write || o.def == Write) {
+					continue
+				}
+				// Describe the first write with a conflict in another
+				// goroutine if it has one
+				if first == nil || first == w && other.fn.root() == w.fn.root() {
+					first, other = w, o
+				}
+				involved[w], involved[o] = true, true
+			}
+		}
+		if first == nil {
+			continue
+		}
+
+		var related []Location
+		if spawn, ok := p.spawnSite(first.fn); ok {
+			related = append(related, spawn)
+		}
+		for _, o := range accesses {
+			if !involved[o] {
+				continue
+			}
+			role, ok := ops[o]
+			if !ok {
+				role = accessKind(o)
+			}
+			loc := p.location(o, role)
+			loc.Locks = a.locks[o.fn].protectingAs(o, ok || o.def == Write)
+			related = append(related, loc)
+		}
+		name, _ := a.vars.name(first.expr)
+		at := p.location(first, ops[first])
+		message := fmt.Sprintf("map %s is %s by goroutines started in a loop without a common lock", name, mapVerb(ops[first], first))
+		if other.fn.root() != first.fn.root() {
+			message = fmt.Sprintf("map %s is %s by a goroutine and %s in %s without a common lock",
+				name, mapVerb(ops[first], first), mapVerb(ops[other], other), other.fn.name)
+		}
+		findings = append(findings, Finding{
+			Check:   CheckConcurrentMap,
+			Var:     name,
+			File:    at.File,
+			Line:    at.Line,
+			Column:  at.Column,
+			Func:    at.Func,
+			Message: message,
+			Related: related,
+		})
+	}
+	return findings
+}
+
+// mapVerb describes an access of a map
+func mapVerb(role string, o *occurrence) string {
+	switch {
+	case role == roleDelete:
+		return "deleted from"
+	case role == roleClear:
+		return "cleared"
+	case role == Write:
+		return "written"
+	case o.def == Write:
+		return "assigned"
+	}
+	return "read"
+}
+
+// elementOps returns the occurrences of variables and fields whose elements
+// are written, by index assignment, increment, delete or clear, with the
+// role of the write
+func (a *pass) elementOps() map[*occurrence]string {
+	byIdent := make(map[*ast.Ident]*occurrence)
+	for _, o := range a.prog.occs {
+		byIdent[o.ident] = o
+	}
+	ops := make(map[*occurrence]string)
+	mark := func(x ast.Expr, role string) {
+		if o, ok := byIdent[operandIdent(x)]; ok {
+			ops[o] = role
+		}
+	}
+	for _, file := range a.pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				if n.Tok == token.DEFINE {
+					break
+				}
+				for _, lhs := range n.Lhs {
+					if index, ok := lhs.(*ast.IndexExpr); ok {
+						mark(index.X, Write)
+					}
+				}
+			case *ast.IncDecStmt:
+				if index, ok := n.X.(*ast.IndexExpr); ok {
+					mark(index.X, Write)
+				}
+			case *ast.CallExpr:
+				if fun, ok := n.Fun.(*ast.Ident); ok && fun.Obj == nil && len(n.Args) > 0 {
+					switch fun.Name {
+					case "delete":
+						mark(n.Args[0], roleDelete)
+					case "clear":
+						mark(n.Args[0], roleClear)
+					}
+				}
+			}
+			return true
+		})
+	}
+	return ops
+}
+
+// operandIdent returns the identifier of the variable or field an operand
+// of an index expression or builtin call names, or nil
+func operandIdent(x ast.Expr) *ast.Ident {
+	for {
+		paren, ok := x.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		x = paren.X
+	}
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x
+	case *ast.SelectorExpr:
+		return x.Sel
+	}
+	return nil
+}
+
+// kinds infers which variables and fields hold maps, slices or arrays from
+// their declared types, the named types of the package, composite literals,
+// make and append, keyed as sharedVars keys them. Fields are keyed by their
+// struct type, as (cache).entries, and also by their name after a dot when
+// all fields of that name have the same kind, for those accessed through an
+// operand whose type is not known.
+func (a *pass) kinds() map[string]int {
+	named := make(map[string]ast.Expr)
+	for _, file := range a.pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if spec, ok := n.(*ast.TypeSpec); ok {
+				named[spec.Name.Name] = spec.Type
+			}
+			return true
+		})
+	}
+	var typeKind func(t ast.Expr, depth int) int
+	typeKind = func(t ast.Expr, depth int) int {
+		switch t := t.(type) {
+		case *ast.MapType:
+			return kindMap
+		case *ast.ArrayType:
+			if t.Len == nil {
+				return kindSlice
+			}
+			return kindArray
+		case *ast.Ident:
+			if u, ok := named[t.Name]; ok && depth < 8 {
+				return typeKind(u, depth+1)
+			}
+		}
+		return kindUnknown
+	}
+	valueKind := func(e ast.Expr) int {
+		switch v := e.(type) {
+		case *ast.CompositeLit:
+			return typeKind(v.Type, 0)
+		case *ast.CallExpr:
+			if fun, ok := v.Fun.(*ast.Ident); ok && fun.Name == "make" && len(v.Args) > 0 {
+				return typeKind(v.Args[0], 0)
+			}
+			if fun, ok := v.Fun.(*ast.Ident); ok && fun.Name == "append" {
+				return kindSlice
+			}
+		case *ast.SliceExpr:
+			return kindSlice
+		}
+		return kindUnknown
+	}
+
+	kinds := make(map[string]int)
+	// fields maps the name of each field to its kind, or to -1 when fields
+	// of that name have different kinds
+	fields := make(map[string]int)
+	set := func(expr ast.Expr, kind int) {
+		if kind != kindUnknown {
+			kinds[a.vars.key(expr, nil)] = kind
+		}
+	}
+	for _, file := range a.pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.TypeSpec:
+				st, ok := n.Type.(*ast.StructType)
+				if !ok {
+					break
+				}
+				for _, field := range st.Fields.List {
+					kind := typeKind(field.Type, 0)
+					for _, name := range field.Names {
+						if kind != kindUnknown {
+							kinds["("+n.Name.Name+")."+name.Name] = kind
+						}
+						if k, ok := fields[name.Name]; ok && k != kind {
+							kind = -1
+						}
+						fields[name.Name] = kind
+					}
+				}
+			case *ast.FuncType:
+				for _, list := range []*ast.FieldList{n.Params, n.Results} {
+					if list == nil {
+						continue
+					}
+					for _, field := range list.List {
+						for _, name := range field.Names {
+							set(name, typeKind(field.Type, 0))
+						}
+					}
+				}
+			case *ast.ValueSpec:
+				for i, name := range n.Names {
+					if n.Type != nil {
+						set(name, typeKind(n.Type, 0))
+					} else if i < len(n.Values) {
+						set(name, valueKind(n.Values[i]))
+					}
+				}
+			case *ast.AssignStmt:
+				if len(n.Lhs) == len(n.Rhs) {
+					for i, lhs := range n.Lhs {
+						set(lhs, valueKind(n.Rhs[i]))
+					}
+				}
+			}
+			return true
+		})
+	}
+	for name, kind := range fields {
+		if kind > kindUnknown {
+			kinds["."+name] = kind
+		}
+	}
+	return kinds
+}
+
+// kindOf returns the kind of the variable or field an occurrence accesses
+func kindOf(kinds map[string]int, o *occurrence) int {
+	if kind, ok := kinds[o.key]; ok {
+		return kind
+	}
+	if sel, ok := o.expr.(*ast.SelectorExpr); ok {
+		if t := typeName(sel.X); t != "" {
+			if kind, ok := kinds["("+t+")."+sel.Sel.Name]; ok {
+				return kind
+			}
+		}
+		return kinds["."+sel.Sel.Name]
+	}
+	return kindUnknown
+}
+
+// typeName returns the name of the type of a variable as its declaration
+// tells, with pointers dereferenced, or "" if it is not known
+func typeName(x ast.Expr) string {
+	id, ok := x.(*ast.Ident)
+	if !ok || id.Obj == nil {
+		return ""
+	}
+	var t ast.Expr
+	switch decl := id.Obj.Decl.(type) {
+	case *ast.Field:
+		t = decl.Type
+	case *ast.ValueSpec:
+		t = decl.Type
+		for i, name := range decl.Names {
+			if t == nil && name.Obj == id.Obj && i < len(decl.Values) {
+				t = literalType(decl.Values[i])
+			}
+		}
+	case *ast.AssignStmt:
+		for i, lhs := range decl.Lhs {
+			if name, ok := lhs.(*ast.Ident); ok && name.Obj == id.Obj && len(decl.Lhs) == len(decl.Rhs) {
+				t = literalType(decl.Rhs[i])
+			}
+		}
+	}
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if name, ok := t.(*ast.Ident); ok {
+		return name.Name
+	}
+	return ""
+}
+
+// literalType returns the type of a composite literal or of the pointer to
+// one, or nil
+func literalType(e ast.Expr) ast.Expr {
+	if u, ok := e.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		e = u.X
+	}
+	if lit, ok := e.(*ast.CompositeLit); ok {
+		return lit.Type
+	}
+	return nil
+}
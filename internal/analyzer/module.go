@@ -0,0 +1,106 @@
+package analyzer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Module is the packages of a Go module
+type Module struct {
+	Path      string // Module path of go.mod
+	Dir       string
+	GoVersion string
+	Packages  []*Package
+	// Errors are the errors of the directories whose files could not be
+	// read or parsed, by directory
+	Errors map[string]error
+}
+
+// ParseModule parses the packages of the module whose go.mod is in root. It
+// reads go.mod rather than running go list, and walks the directories under
+// root as the go command does, leaving out testdata and vendor directories,
+// those whose name starts with . or _, and nested modules. The files of
+// each directory are selected and grouped into packages as ParseDir does,
+// and a directory that fails to parse is recorded in Errors rather than
+// stopping the walk.
+func ParseModule(root string, opts ParseOptions) (*Module, error) {
+	path := filepath.Join(root, "go.mod")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Module{Path: directive(data, "module"), Dir: root, GoVersion: directive(data, "go"), Errors: make(map[string]error)}
+	if m.Path == "" {
+		return nil, fmt.Errorf("%s: no module directive", path)
+	}
+	err = filepath.WalkDir(root, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if dir == root {
+				return err
+			}
+			m.Errors[dir] = err
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if dir != root {
+			name := d.Name()
+			if name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		pkgs, err := ParseDir(dir, opts)
+		if err != nil {
+			m.Errors[dir] = err
+			return nil
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			pkg.ImportPath = m.Path
+			if rel != "." {
+				pkg.ImportPath += "/" + filepath.ToSlash(rel)
+			}
+			if strings.HasSuffix(pkg.Name, "_test") {
+				pkg.ImportPath += "_test"
+			}
+		}
+		m.Packages = append(m.Packages, pkgs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AnalyzeModule analyzes each package of a module, and returns their
+// results, with one carrying the error of each directory that failed to
+// parse, in order of directory and package name
+func AnalyzeModule(m *Module) []*PackageResult {
+	results := []*PackageResult{}
+	for _, pkg := range m.Packages {
+		results = append(results, AnalyzePackage(pkg))
+	}
+	for dir, err := range m.Errors {
+		results = append(results, &PackageResult{Dir: dir, Files: []string{}, Findings: []Finding{}, Error: err.Error()})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Dir != b.Dir {
+			return a.Dir < b.Dir
+		}
+		return a.Package < b.Package
+	})
+	return results
+}
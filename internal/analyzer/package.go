@@ -0,0 +1,485 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Package is the parsed files of a Go package, analyzed together so that
+// accesses and methods spread across files are seen
+type Package struct {
+	Name       string
+	ImportPath string // Set for the packages of a module
+	Dir        string
+	Fset       *token.FileSet
+	Files      []*ast.File
+	// GoVersion is the Go language version the package is compiled with,
+	// or "" if unknown
+	GoVersion string
+}
+
+// Finding is a candidate race reported by a check on a package. Its
+// position is that of the access, or other site, it is reported at.
+type Finding struct {
+	Check   string `json:"check"`
+	Var     string `json:"var"` // Variable or field, such as counter or (Server).count
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Func    string `json:"func"` // Function of the position, named as by cfg
+	Message string `json:"message"`
+	// Related are the sites that make up the race, such as the accesses
+	// and the go statements starting their goroutines
+	Related []Location `json:"related"`
+	// Fingerprint identifies the finding in a baseline across line shifts
+	Fingerprint string `json:"fingerprint"`
+}
+
+// roleSpawn is the role of the go statement or spawner call starting a
+// goroutine of a finding
+const roleSpawn = "spawn"
+
+// Location is a site of a finding
+type Location struct {
+	Role   string `json:"role"` // read, write, spawn, ...
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Func   string `json:"func"`
+	// Locks are the locks held at the site, named as the variables and
+	// fields they are
+	Locks []string `json:"locks,omitempty"`
+}
+
+// PackageResult is the result of analyzing a package
+type PackageResult struct {
+	Package    string    `json:"package"`
+	ImportPath string    `json:"import_path,omitempty"`
+	Dir        string    `json:"dir"`
+	Files      []string  `json:"files"`
+	Findings   []Finding `json:"findings"`
+	Suppressed int       `json:"suppressed,omitempty"` // Findings left out by drfix:ignore directives
+	Baselined  int       `json:"baselined,omitempty"`  // Findings left out by a baseline
+	Error      string    `json:"error,omitempty"`
+}
+
+// ParseOptions select the files of a directory to parse
+type ParseOptions struct {
+	Tests bool // Include _test.go files
+	// Tags are the build tags to satisfy, as with go build -tags, besides
+	// those of the operating system, architecture and Go release
+	Tags []string
+}
+
+// context returns the build context that selects files for opts
+func (opts ParseOptions) context() build.Context {
+	ctxt := build.Default
+	ctxt.BuildTags = opts.Tags
+	return ctxt
+}
+
+// ParseDir parses the Go files of a directory, leaving out tests unless
+// opts includes them and files whose name or build constraints exclude them
+// from the build, and groups them by package, in order of package name.
+// External test packages, such as foo_test, are packages of their own.
+// Their Go version is that of the nearest go.mod unless SetGoVersion sets it.
+func ParseDir(dir string, opts ParseOptions) ([]*Package, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	ctxt := opts.context()
+	fset := token.NewFileSet()
+	byName := make(map[string]*Package)
+	var pkgs []*Package
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || !opts.Tests && strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := ctxt.MatchFile(dir, name); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		pkg, ok := byName[file.Name.Name]
+		if !ok {
+			pkg = &Package{Name: file.Name.Name, Dir: dir, Fset: fset, GoVersion: findGoVersion(dir)}
+			byName[pkg.Name] = pkg
+			pkgs = append(pkgs, pkg)
+		}
+		pkg.Files = append(pkg.Files, file)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs, nil
+}
+
+// AnalyzePackage runs the checks on a package and returns their findings in
+// order of position, one for each race, leaving out those suppressed by
+// drfix:ignore directives
+func AnalyzePackage(pkg *Package) *PackageResult {
+	result := &PackageResult{Package: pkg.Name, ImportPath: pkg.ImportPath, Dir: pkg.Dir, Files: []string{}, Findings: []Finding{}}
+	for _, file := range pkg.Files {
+		result.Files = append(result.Files, pkg.Fset.Position(file.Pos()).Filename)
+	}
+	a := newPass(pkg)
+	result.Findings = append(result.Findings, a.lockset()...)
+	result.Findings = append(result.Findings, a.fieldRaces()...)
+	result.Findings = append(result.Findings, a.concurrentMaps()...)
+	result.Findings = append(result.Findings, a.sliceAppends()...)
+	result.Findings = append(result.Findings, a.lazyInits()...)
+	result.Findings = append(result.Findings, a.loopCaptures()...)
+	result.Findings = append(result.Findings, a.parallelSubtests()...)
+	result.Findings = dedupe(result.Findings)
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		a, b := result.Findings[i], result.Findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	ignores := a.ignores()
+	lines := make(map[string][]string)
+	paths := make(map[string]string)
+	findings := []Finding{}
+	for _, f := range result.Findings {
+		suppressed := false
+		for _, ig := range ignores {
+			suppressed = suppressed || ig.covers(f)
+		}
+		if suppressed {
+			result.Suppressed++
+			continue
+		}
+		if _, ok := lines[f.File]; !ok {
+			src, _ := os.ReadFile(f.File)
+			lines[f.File] = strings.Split(string(src), "\n")
+			paths[f.File] = modulePath(pkg, f.File)
+		}
+		line := ""
+		if f.Line-1 < len(lines[f.File]) {
+			line = lines[f.File][f.Line-1]
+		}
+		f.Fingerprint = fingerprint(f, paths[f.File], line)
+		findings = append(findings, f)
+	}
+	result.Findings = findings
+	return result
+}
+
+// specificity ranks the checks by how specific their findings are: those
+// of the dedicated checks describe a race better than a field race, and a
+// field race better than a lockset violation
+var specificity = map[string]int{
+	CheckLockset:   0,
+	CheckFieldRace: 1,
+}
+
+// dedupe keeps one finding of each race that several checks report: of the
+// findings of a variable sharing an access, those of less specific checks
+// are left out
+func dedupe(findings []Finding) []Finding {
+	sites := make([]map[token.Position]bool, len(findings))
+	for i, f := range findings {
+		sites[i] = make(map[token.Position]bool)
+		for _, r := range f.Related {
+			if r.Role != roleSpawn {
+				sites[i][token.Position{Filename: r.File, Line: r.Line, Column: r.Column}] = true
+			}
+		}
+	}
+	rank := func(f Finding) int {
+		if r, ok := specificity[f.Check]; ok {
+			return r
+		}
+		return len(specificity)
+	}
+	kept := []Finding{}
+	for i, f := range findings {
+		covered := false
+		for j, g := range findings {
+			if g.Var != f.Var || rank(g) <= rank(f) {
+				continue
+			}
+			for site := range sites[i] {
+				covered = covered || sites[j][site]
+			}
+		}
+		if !covered {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// pass is the analysis of a package its checks share: the occurrences of
+// its shared variables and the locks held in its functions
+type pass struct {
+	pkg   *Package
+	vars  *sharedVars
+	prog  *program
+	locks map[*function]*functionLocks
+}
+
+func newPass(pkg *Package) *pass {
+	a := &pass{pkg: pkg, vars: newSharedVars(pkg.Files)}
+	a.prog = newProgram(pkg.Fset, pkg.Files, a.vars)
+	a.locks = a.prog.locks(a.vars)
+	return a
+}
+
+// accesses returns the reads and writes of shared variables grouped by
+// key, with the keys in order of first access
+func (a *pass) accesses() ([]string, map[string][]*occurrence) {
+	var keys []string
+	byKey := make(map[string][]*occurrence)
+	for _, o := range a.prog.occs {
+		if o.def != Write && !o.use {
+			continue
+		}
+		if _, ok := byKey[o.key]; !ok {
+			keys = append(keys, o.key)
+		}
+		byKey[o.key] = append(byKey[o.key], o)
+	}
+	return keys, byKey
+}
+
+// sharedVars selects the variables of a package that goroutines may share:
+// package variables, fields of the struct types it declares, and local
+// variables used by closures. Fields accessed through a method receiver are
+// keyed by the receiver type, so that the methods of a type share them.
+type sharedVars struct {
+	globals map[string]bool      // Names of package variables
+	objects map[*ast.Object]bool // Package variables and captured locals
+	locals  map[*ast.Object]bool // Captured locals
+	fields  map[string]bool      // Names of fields of struct types
+	imports map[string]bool      // Names of imported packages
+	// receivers maps the receivers of methods to the names of their types
+	receivers map[*ast.Object]string
+}
+
+func newSharedVars(files []*ast.File) *sharedVars {
+	s := &sharedVars{
+		globals:   make(map[string]bool),
+		objects:   make(map[*ast.Object]bool),
+		locals:    make(map[*ast.Object]bool),
+		fields:    make(map[string]bool),
+		imports:   make(map[string]bool),
+		receivers: make(map[*ast.Object]string),
+	}
+	for _, file := range files {
+		for _, imp := range file.Imports {
+			path, _ := strconv.Unquote(imp.Path.Value)
+			name := path[strings.LastIndex(path, "/")+1:]
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			s.imports[name] = true
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range d.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						if name.Name != "_" {
+							s.globals[name.Name] = true
+							s.objects[name.Obj] = true
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv != nil && len(d.Recv.List) == 1 && len(d.Recv.List[0].Names) == 1 {
+					if t := receiverType(d.Recv.List[0].Type); t != "" {
+						s.receivers[d.Recv.List[0].Names[0].Obj] = t
+					}
+				}
+			}
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.StructType:
+				for _, field := range n.Fields.List {
+					for _, name := range field.Names {
+						s.fields[name.Name] = true
+					}
+				}
+			case *ast.FuncLit:
+				walkIdents(n, func(ident *ast.Ident, stack []ast.Node) {
+					obj := ident.Obj
+					if obj != nil && obj.Kind == ast.Var && !s.objects[obj] && (obj.Pos() < n.Pos() || obj.Pos() >= n.End()) {
+						s.objects[obj] = true
+						s.locals[obj] = true
+					}
+				})
+			}
+			return true
+		})
+	}
+	return s
+}
+
+// receiverType returns the name of the type of a receiver, or ""
+func receiverType(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+func (s *sharedVars) selects(ident *ast.Ident, stack []ast.Node) bool {
+	if len(stack) < 2 {
+		return false
+	}
+	switch parent := stack[len(stack)-2].(type) {
+	case *ast.SelectorExpr:
+		if parent.Sel == ident {
+			if !s.fields[ident.Name] || isCalled(parent, stack[:len(stack)-1]) {
+				return false
+			}
+			// A selector of an imported package is not a field
+			root, ok := parent.X.(*ast.Ident)
+			return !ok || root.Obj != nil || !s.imports[root.Name]
+		}
+	case *ast.KeyValueExpr:
+		if parent.Key == ident {
+			return false
+		}
+	}
+	if ident.Obj == nil {
+		return s.globals[ident.Name]
+	}
+	return s.objects[ident.Obj]
+}
+
+// isCalled reports whether an expression, the top of the stack, is the
+// function of a call
+func isCalled(expr ast.Expr, stack []ast.Node) bool {
+	if len(stack) < 2 {
+		return false
+	}
+	call, ok := stack[len(stack)-2].(*ast.CallExpr)
+	return ok && call.Fun == expr
+}
+
+// key keys package variables and fields of receivers by their name, and
+// other variables by their declaration as well
+func (s *sharedVars) key(expr ast.Expr, stack []ast.Node) string {
+	name, local := s.name(expr)
+	if local {
+		return occurrenceKey(expr)
+	}
+	return name
+}
+
+// name returns the name of an accessed expression, with a method receiver
+// replaced by its type in parentheses, and whether it is rooted at a local
+// variable
+func (s *sharedVars) name(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if t, ok := s.receivers[e.Obj]; ok {
+			return "(" + t + ")", false
+		}
+		return e.Name, e.Obj != nil && (s.locals[e.Obj] || !s.objects[e.Obj])
+	case *ast.SelectorExpr:
+		x, local := s.name(e.X)
+		return x + "." + e.Sel.Name, local
+	case *ast.StarExpr:
+		x, local := s.name(e.X)
+		return "*" + x, local
+	case *ast.ParenExpr:
+		x, local := s.name(e.X)
+		return "(" + x + ")", local
+	}
+	return types.ExprString(expr), true
+}
+
+// location returns the location of an occurrence
+func (p *program) location(o *occurrence, role string) Location {
+	pos := p.fset.Position(o.ident.Pos())
+	return Location{Role: role, File: pos.Filename, Line: pos.Line, Column: pos.Column, Func: o.fn.name}
+}
+
+// conflict reports whether two accesses may run concurrently, as writes
+// or reads, with no lock held at both that protects them
+func (a *pass) conflict(x, y *occurrence, xWrite, yWrite bool) bool {
+	if !a.prog.concurrent(x, y) {
+		return false
+	}
+	held := make(map[string]bool)
+	for _, l := range a.locks[x.fn].protectingAs(x, xWrite) {
+		held[l] = true
+	}
+	for _, l := range a.locks[y.fn].protectingAs(y, yWrite) {
+		if held[l] {
+			return false
+		}
+	}
+	return true
+}
+
+// spawnSite returns the location of the go statement or spawner call
+// starting the goroutine f runs in, when it is a closure
+func (p *program) spawnSite(f *function) (Location, bool) {
+	r := f.root()
+	if !r.spawned || r.parent == nil {
+		return Location{}, false
+	}
+	pos := p.fset.Position(r.graph.Func.Pos())
+	if s := r.creation.Stmt; s != nil {
+		pos = p.fset.Position(s.Pos())
+	}
+	return Location{Role: roleSpawn, File: pos.Filename, Line: pos.Line, Column: pos.Column, Func: r.parent.name}, true
+}
+
+// accessKind returns whether an occurrence is a read or write
+func accessKind(o *occurrence) string {
+	if o.def == Write {
+		return Write
+	}
+	return Read
+}
+
+// concurrent reports whether two accesses may run at once in a package:
+// one of them runs in a spawned goroutine, they run in different goroutines
+// or in instances of one spawned in a loop, and no synchronization orders
+// them
+func (p *program) concurrent(a, b *occurrence) bool {
+	ra, rb := a.fn.root(), b.fn.root()
+	if !ra.spawned && !rb.spawned || ra == rb && !ra.multiple() {
+		return false
+	}
+	return p.order(a, b) == ""
+}
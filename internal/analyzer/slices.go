@@ -0,0 +1,178 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// CheckSliceAppend reports slices whose header a goroutine writes, by
+// append or reassignment, while the slice is accessed concurrently elsewhere
+const CheckSliceAppend = "slice-append"
+
+// Roles of writes of a slice header
+const (
+	roleAppend   = "append"   // s = append(s, x)
+	roleReassign = "reassign" // s = t, or s = s[1:]
+)
+
+// SliceAppends finds the slices of a package, in captured variables,
+// package variables or fields, whose header is written by an append or a
+// reassignment while another access may run concurrently in another
+// goroutine, with no lock held at both and no synchronization ordering
+// them. This covers goroutines appending to one slice, and elements written
+// while the header is replaced, as when a slice is resliced. Each slice is
+// reported once, at the first such write in a goroutine, preferring
+// appends, with the goroutine's spawn site and all conflicting accesses.
+func SliceAppends(pkg *Package) []Finding {
+	return newPass(pkg).sliceAppends()
+}
+
+func (a *pass) sliceAppends() []Finding {
+	p := a.prog
+	kinds := a.kinds()
+	ops := a.elementOps()
+	for o, role := range a.headerWrites() {
+		ops[o] = role
+	}
+	isHeader := func(o *occurrence) bool {
+		role := ops[o]
+		return role == roleAppend || role == roleReassign
+	}
+	isWrite := func(o *occurrence) bool {
+		_, ok := ops[o]
+		return ok || o.def == Write
+	}
+
+	keys, byKey := a.accesses()
+	var findings []Finding
+	for _, key := range keys {
+		accesses := byKey[key]
+		isSlice := false
+		for _, o := range accesses {
+			isSlice = isSlice || kindOf(kinds, o) == kindSlice || ops[o] == roleAppend
+		}
+		if !isSlice {
+			continue
+		}
+
+		// g is the goroutine side of the first conflict, preferring an
+		// append in a goroutine, and other the access it conflicts with
+		var g, other *occurrence
+		involved := make(map[*occurrence]bool)
+		for i, x := range accesses {
+			for _, y := range accesses[i:] {
+				if !isHeader(x) && !isHeader(y) || !a.conflict(x, y, isWrite(x), isWrite(y)) {
+					continue
+				}
+				involved[x], involved[y] = true, true
+				side, rest := x, y
+				if !x.fn.root().spawned || y.fn.root().spawned && isHeader(y) && !isHeader(x) {
+					side, rest = y, x
+				}
+				if g == nil || ops[g] != roleAppend && ops[side] == roleAppend {
+					g, other = side, rest
+				}
+			}
+		}
+		if g == nil {
+			continue
+		}
+
+		var related []Location
+		if spawn, ok := p.spawnSite(g.fn); ok {
+			related = append(related, spawn)
+		}
+		for _, o := range accesses {
+			if !involved[o] {
+				continue
+			}
+			role, ok := ops[o]
+			if !ok {
+				role = accessKind(o)
+			}
+			loc := p.location(o, role)
+			loc.Locks = a.locks[o.fn].protectingAs(o, isWrite(o))
+			related = append(related, loc)
+		}
+		name, _ := a.vars.name(g.expr)
+		at := p.location(g, ops[g])
+		message := fmt.Sprintf("slice %s is %s by goroutines started in a loop without a common lock", name, sliceVerb(ops[g], g))
+		if other.fn.root() != g.fn.root() {
+			message = fmt.Sprintf("slice %s is %s by a goroutine and %s in %s without a common lock",
+				name, sliceVerb(ops[g], g), sliceVerb(ops[other], other), other.fn.name)
+		}
+		findings = append(findings, Finding{
+			Check:   CheckSliceAppend,
+			Var:     name,
+			File:    at.File,
+			Line:    at.Line,
+			Column:  at.Column,
+			Func:    at.Func,
+			Message: message,
+			Related: related,
+		})
+	}
+	return findings
+}
+
+// sliceVerb describes an access of a slice
+func sliceVerb(role string, o *occurrence) string {
+	switch role {
+	case roleAppend:
+		return "appended to"
+	case roleReassign:
+		return "reassigned"
+	case Write:
+		return "written at an index"
+	case roleDelete, roleClear:
+		return mapVerb(role, o)
+	}
+	return "read"
+}
+
+// headerWrites returns the occurrences that assign a variable or field as a
+// whole, with whether they append to it or reassign it
+func (a *pass) headerWrites() map[*occurrence]string {
+	writes := make(map[*occurrence]string)
+	byIdent := make(map[*ast.Ident]*occurrence)
+	for _, o := range a.prog.occs {
+		if o.def == Write {
+			byIdent[o.ident] = o
+		}
+	}
+	for _, file := range a.pkg.Files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			as, ok := n.(*ast.AssignStmt)
+			if !ok || as.Tok != token.ASSIGN && as.Tok != token.DEFINE {
+				return true
+			}
+			for i, lhs := range as.Lhs {
+				var ident *ast.Ident
+				switch lhs := lhs.(type) {
+				case *ast.Ident:
+					ident = lhs
+				case *ast.SelectorExpr:
+					ident = lhs.Sel
+				}
+				o, ok := byIdent[ident]
+				if !ok {
+					continue
+				}
+				writes[o] = roleReassign
+				if len(as.Lhs) != len(as.Rhs) {
+					continue
+				}
+				call, ok := as.Rhs[i].(*ast.CallExpr)
+				if !ok || len(call.Args) == 0 {
+					continue
+				}
+				if fun, ok := call.Fun.(*ast.Ident); ok && fun.Name == "append" && a.vars.key(call.Args[0], nil) == o.key {
+					writes[o] = roleAppend
+				}
+			}
+			return true
+		})
+	}
+	return writes
+}
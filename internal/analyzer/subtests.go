@@ -0,0 +1,303 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+)
+
+// CheckParallelSubtest reports variables of a test that its parallel
+// subtests share
+const CheckParallelSubtest = "parallel-subtest"
+
+// Roles of the sites of a parallel subtest
+const (
+	roleSubtest  = "subtest"  // t.Run
+	roleParallel = "parallel" // t.Parallel
+)
+
+// subtest is a t.Run call of a test whose function calls t.Parallel
+type subtest struct {
+	call     *ast.CallExpr
+	lit      *ast.FuncLit
+	parallel *ast.CallExpr
+	name     string
+	// repeated is set when the subtest is run in a loop
+	repeated bool
+	loopVars map[*ast.Object]loopDecl
+	accesses []subtestAccess
+}
+
+// subtestAccess is a use, after t.Parallel, of a variable a subtest
+// captures from its test
+type subtestAccess struct {
+	ident  *ast.Ident
+	write  bool
+	locks  []string
+	fnName string
+}
+
+// ParallelSubtests finds the subtests, run by t.Run with a function that
+// calls t.Parallel, that use variables captured from the enclosing test
+// after t.Parallel. Parallel subtests run together once the test function
+// returns, so a captured variable is reported when a parallel subtest
+// writes it, or memory reached through it such as a field or element,
+// without holding a lock, and the subtest runs in a loop or another
+// parallel subtest of the test uses the variable: shared counters, and
+// fixtures mutated in place. Before Go 1.22 the variables of a table loop,
+// such as the entry tt, are shared by all iterations, so every use of them
+// is reported: the subtests run after the loop ends and see its last entry.
+// Each variable is reported once for each subtest, at its first use.
+func ParallelSubtests(pkg *Package) []Finding {
+	return newPass(pkg).parallelSubtests()
+}
+
+func (a *pass) parallelSubtests() []Finding {
+	funcs := make(map[ast.Node]*function)
+	for _, f := range a.prog.funcs {
+		funcs[f.graph.Func] = f
+	}
+	byIdent := make(map[*ast.Ident]*occurrence)
+	for _, o := range a.prog.occs {
+		byIdent[o.ident] = o
+	}
+	version := "an unknown Go version"
+	if a.pkg.GoVersion != "" {
+		version = "go " + a.pkg.GoVersion
+	}
+	sharedLoops := sharesLoopVars(a.pkg.GoVersion)
+
+	var findings []Finding
+	for _, file := range a.pkg.Files {
+		for _, decl := range file.Decls {
+			test, ok := decl.(*ast.FuncDecl)
+			if !ok || test.Body == nil || funcs[test] == nil {
+				continue
+			}
+			subtests := a.subtests(test, funcs, byIdent)
+
+			// Accesses of variables other than shared loop variables, by
+			// variable
+			byObj := make(map[*ast.Object][]subtestUse)
+			for _, st := range subtests {
+				for _, x := range st.accesses {
+					if _, ok := st.loopVars[x.ident.Obj]; !ok {
+						byObj[x.ident.Obj] = append(byObj[x.ident.Obj], subtestUse{st, x})
+					}
+				}
+			}
+
+			for _, st := range subtests {
+				reported := make(map[*ast.Object]bool)
+				for _, x := range st.accesses {
+					obj := x.ident.Obj
+					if reported[obj] {
+						continue
+					}
+					decl, loopVar := st.loopVars[obj]
+					var message string
+					var other *subtestUse
+					switch {
+					case loopVar && sharedLoops:
+						message = fmt.Sprintf("parallel subtest %s uses loop variable %s of %s after t.Parallel; with %s all iterations share it, so the subtests run after the loop ends and see its last value; copy it in the loop body before t.Run",
+							st.name, obj.Name, funcs[test].name, version)
+					case loopVar:
+						continue
+					default:
+						other = conflictingUse(st, x, byObj[obj])
+						if other == nil {
+							continue
+						}
+						verb := "reads"
+						if x.write {
+							verb = "writes"
+						}
+						message = fmt.Sprintf("parallel subtest %s %s %s, captured from %s, after t.Parallel while other parallel subtests use it; copy it into the subtest or guard it with a lock",
+							st.name, verb, obj.Name, funcs[test].name)
+						if other.st == st {
+							other = nil
+						}
+					}
+					reported[obj] = true
+
+					related := []Location{
+						a.nodeLocation(st.call, roleSubtest, funcs[test].name),
+						a.nodeLocation(st.parallel, roleParallel, funcs[st.lit].name),
+					}
+					if loopVar {
+						related = append(related, a.nodeLocation(decl.ident, roleLoop, funcs[test].name))
+					}
+					for _, y := range st.accesses {
+						if y.ident.Obj == obj {
+							related = append(related, y.location(a))
+						}
+					}
+					if other != nil {
+						related = append(related, other.x.location(a))
+					}
+					first := x.location(a)
+					findings = append(findings, Finding{
+						Check:   CheckParallelSubtest,
+						Var:     obj.Name,
+						File:    first.File,
+						Line:    first.Line,
+						Column:  first.Column,
+						Func:    first.Func,
+						Message: message,
+						Related: related,
+					})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// subtests returns the parallel subtests of a test, with the accesses of
+// the variables they capture from it after t.Parallel, in source order
+func (a *pass) subtests(test *ast.FuncDecl, funcs map[ast.Node]*function, byIdent map[*ast.Ident]*occurrence) []*subtest {
+	var subtests []*subtest
+	var stack []ast.Node
+	ast.Inspect(test, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		lit := subtestFunc(call)
+		if lit == nil || funcs[lit] == nil {
+			return true
+		}
+		st := &subtest{call: call, lit: lit, name: types.ExprString(call.Args[0])}
+		st.parallel = parallelCall(lit)
+		if st.parallel == nil {
+			return true
+		}
+		for _, n := range stack {
+			switch n.(type) {
+			case *ast.ForStmt, *ast.RangeStmt:
+				st.repeated = true
+			}
+		}
+		st.loopVars = loopVars(append(stack, lit))
+
+		// Nested subtests are subtests of their own
+		walkIdents(lit.Body, func(ident *ast.Ident, inner []ast.Node) {
+			obj := ident.Obj
+			if obj == nil || obj.Kind != ast.Var || ident.Pos() < st.parallel.End() || isTestingT(obj) {
+				return
+			}
+			if obj.Pos() >= lit.Pos() && obj.Pos() < lit.End() || obj.Pos() < test.Pos() || obj.Pos() >= test.End() {
+				return
+			}
+			for _, n := range inner {
+				if c, ok := n.(*ast.CallExpr); ok && c != call && subtestFunc(c) != nil && parallelCall(subtestFunc(c)) != nil {
+					return
+				}
+			}
+			x := subtestAccess{ident: ident, write: isModified(ident, inner), fnName: funcs[lit].name}
+			if o, ok := byIdent[ident]; ok {
+				x.locks = a.locks[o.fn].protectingAs(o, x.write)
+				x.fnName = o.fn.name
+			}
+			st.accesses = append(st.accesses, x)
+		})
+		subtests = append(subtests, st)
+		return true
+	})
+	return subtests
+}
+
+// subtestUse is an access of a variable by a parallel subtest
+type subtestUse struct {
+	st *subtest
+	x  subtestAccess
+}
+
+// conflictingUse returns the first use of a variable by the parallel
+// subtests of a test that may run concurrently with an access x of st,
+// one of them a write and with no lock held at both, or nil. Other
+// instances of st run concurrently when it runs in a loop.
+func conflictingUse(st *subtest, x subtestAccess, uses []subtestUse) *subtestUse {
+	for i, u := range uses {
+		if u.st == st && !st.repeated || !x.write && !u.x.write || sharesLock(x.locks, u.x.locks) {
+			continue
+		}
+		return &uses[i]
+	}
+	return nil
+}
+
+// location returns the location of an access of a subtest
+func (x subtestAccess) location(a *pass) Location {
+	role := Read
+	if x.write {
+		role = Write
+	}
+	loc := a.nodeLocation(x.ident, role, x.fnName)
+	loc.Locks = x.locks
+	return loc
+}
+
+// subtestFunc returns the function a t.Run call runs, or nil
+func subtestFunc(call *ast.CallExpr) *ast.FuncLit {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Run" || len(call.Args) != 2 {
+		return nil
+	}
+	lit, ok := call.Args[1].(*ast.FuncLit)
+	if !ok || len(lit.Type.Params.List) != 1 || !isTestingTType(lit.Type.Params.List[0].Type) {
+		return nil
+	}
+	return lit
+}
+
+// parallelCall returns the t.Parallel call of a subtest function, or nil
+func parallelCall(lit *ast.FuncLit) *ast.CallExpr {
+	names := lit.Type.Params.List[0].Names
+	if len(names) != 1 || names[0].Obj == nil {
+		return nil
+	}
+	var parallel *ast.CallExpr
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok || parallel != nil {
+			return false
+		}
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Parallel" {
+			return true
+		}
+		if t, ok := sel.X.(*ast.Ident); ok && t.Obj == names[0].Obj {
+			parallel = call
+		}
+		return true
+	})
+	return parallel
+}
+
+// isTestingT reports whether a variable is declared as a *testing.T
+func isTestingT(obj *ast.Object) bool {
+	field, ok := obj.Decl.(*ast.Field)
+	return ok && isTestingTType(field.Type)
+}
+
+func isTestingTType(expr ast.Expr) bool {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "testing" && sel.Sel.Name == "T"
+}
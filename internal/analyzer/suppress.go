@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// ignoreDirective starts a comment that suppresses the findings of a check,
+// as //drfix:ignore lockset the counter is only read for logging
+const ignoreDirective = "//drfix:ignore"
+
+// ignore is a drfix:ignore directive with the statement or declaration it
+// covers
+type ignore struct {
+	check      string
+	start, end token.Position
+}
+
+// ignores returns the drfix:ignore directives of the files of a package. A
+// directive covers the outermost statement or declaration whose first line
+// it ends, or else the one starting on the line after its comment group,
+// such as a function it documents. Directives without a check and a reason
+// are not honored.
+func (a *pass) ignores() []ignore {
+	fset := a.pkg.Fset
+	var ignores []ignore
+	for _, file := range a.pkg.Files {
+		for _, group := range file.Comments {
+			for _, c := range group.List {
+				check, ok := parseIgnore(c.Text)
+				if !ok {
+					continue
+				}
+				n := coveredNode(fset, file, c.Slash, fset.Position(group.End()).Line+1)
+				if n == nil {
+					continue
+				}
+				ignores = append(ignores, ignore{check: check, start: fset.Position(n.Pos()), end: fset.Position(n.End())})
+			}
+		}
+	}
+	return ignores
+}
+
+// parseIgnore returns the check of a drfix:ignore directive, and whether
+// the comment is one with a reason
+func parseIgnore(text string) (string, bool) {
+	if !strings.HasPrefix(text, ignoreDirective+" ") {
+		return "", false
+	}
+	fields := strings.Fields(strings.TrimPrefix(text, ignoreDirective))
+	if len(fields) < 2 {
+		return "", false
+	}
+	return fields[0], true
+}
+
+// coveredNode returns the outermost statement or declaration starting on
+// the line of a comment, before it, or else the outermost one starting on
+// the next line, or nil
+func coveredNode(fset *token.FileSet, file *ast.File, comment token.Pos, next int) ast.Node {
+	line := fset.Position(comment).Line
+	var trailing, following ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n.(type) {
+		case ast.Stmt, ast.Decl, ast.Spec:
+		default:
+			return true
+		}
+		switch start := fset.Position(n.Pos()).Line; {
+		case trailing == nil && start == line && n.Pos() < comment:
+			trailing = n
+		case following == nil && start == next:
+			following = n
+		}
+		return true
+	})
+	if trailing != nil {
+		return trailing
+	}
+	return following
+}
+
+// covers reports whether a directive suppresses a finding
+func (ig ignore) covers(f Finding) bool {
+	if ig.check != f.Check || ig.start.Filename != f.File {
+		return false
+	}
+	after := f.Line > ig.start.Line || f.Line == ig.start.Line && f.Column >= ig.start.Column
+	before := f.Line < ig.end.Line || f.Line == ig.end.Line && f.Column < ig.end.Column
+	return after && before
+}
@@ -0,0 +1,11 @@
+package main
+
+func main() {
+	var racyVar0 error
+	for _, v1 := range v2 {
+		Wrapper1.Go(func() error {
+			racyVar0 = v1.Func1()
+			return racyVar0
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package fields
+
+func (q *asyncWorkerQueue) Dequeue() int {
+	return <-q.taskChan
+}
+
+func (s *store) Get(k string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.items[k]
+}
+
+func (s *store) Len() int {
+	return s.n
+}
@@ -0,0 +1,47 @@
+package fields
+
+import "sync"
+
+type asyncWorkerQueue struct {
+	queue    []int
+	taskChan chan int
+}
+
+func (q *asyncWorkerQueue) Run(stopChan chan struct{}) {
+	q.taskChan = make(chan int)
+
+	go func() {
+		for _, item := range q.queue {
+			select {
+			case q.taskChan <- item:
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+type store struct {
+	mu    sync.Mutex
+	items map[string]int
+	n     int
+}
+
+func (s *store) Put(k string, v int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[k] = v
+	s.n++
+}
+
+type plain struct {
+	x int
+}
+
+func (p *plain) Set(x int) {
+	p.x = x
+}
+
+func (p *plain) Get() int {
+	return p.x
+}
@@ -0,0 +1,25 @@
+package lazyinit
+
+var instance *config
+
+func Instance() *config {
+	if instance == nil {
+		instance = &config{}
+	}
+	return instance
+}
+
+func Reset() {
+	go func() {
+		instance = nil
+	}()
+}
+
+var defaults map[string]int
+
+func Defaults() map[string]int {
+	if defaults == nil {
+		defaults = map[string]int{}
+	}
+	return defaults
+}
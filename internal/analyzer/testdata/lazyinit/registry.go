@@ -0,0 +1,49 @@
+package lazyinit
+
+import "sync"
+
+type registry struct {
+	mu    sync.Mutex
+	once  sync.Once
+	items map[string]int
+	ready bool
+	conf  *config
+}
+
+type config struct {
+	name string
+}
+
+func (r *registry) get(k string) int {
+	if r.items == nil {
+		r.items = make(map[string]int)
+	}
+	return r.items[k]
+}
+
+func (r *registry) init() {
+	if !r.ready {
+		r.mu.Lock()
+		if !r.ready {
+			r.ready = true
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *registry) config() *config {
+	r.once.Do(func() {
+		if r.conf == nil {
+			r.conf = &config{}
+		}
+	})
+	return r.conf
+}
+
+func (r *registry) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conf == nil {
+		r.conf = &config{name: "default"}
+	}
+}
@@ -0,0 +1,36 @@
+package lockset
+
+import "sync"
+
+type Server struct {
+	mu    sync.Mutex
+	count int
+	hits  int
+}
+
+var total int
+
+func (s *Server) Inc() {
+	s.mu.Lock()
+	s.count++
+	s.mu.Unlock()
+	s.hits++
+}
+
+type Cache struct {
+	mu   sync.RWMutex
+	data map[string]int
+	size int
+}
+
+func (c *Cache) Get(k string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.data[k]
+}
+
+func (c *Cache) Resize() {
+	c.mu.RLock()
+	c.size = 2
+	c.mu.RUnlock()
+}
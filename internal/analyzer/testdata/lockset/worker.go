@@ -0,0 +1,119 @@
+package lockset
+
+import "sync"
+
+func (s *Server) Start() {
+	go s.loop()
+	for i := 0; i < 2; i++ {
+		go func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.count++
+			total++
+		}()
+	}
+}
+
+func (s *Server) loop() {
+	s.mu.Lock()
+	s.count = 0
+	s.mu.Unlock()
+	s.hits = 0
+	total--
+}
+
+func (c *Cache) Run() {
+	go func() {
+		c.mu.Lock()
+		c.data = nil
+		c.size = 1
+		c.mu.Unlock()
+	}()
+}
+
+func Sum(xs []int) int {
+	var wg sync.WaitGroup
+	sum := 0
+	for _, x := range xs {
+		wg.Add(1)
+		go func(x int) {
+			defer wg.Done()
+			sum += x
+		}(x)
+	}
+	wg.Wait()
+	return sum
+}
+
+func Count(xs []int) int {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	n := 0
+	for range xs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			n++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return n
+}
+
+// Squares fans out one goroutine per element, each writing its own index
+func Squares(xs []int) ([]int, [4]int) {
+	var wg sync.WaitGroup
+	results := make([]int, len(xs))
+	var firsts [4]int
+	for i, x := range xs {
+		wg.Add(1)
+		go func(i, x int) {
+			defer wg.Done()
+			results[i] = x * x
+			if i < len(firsts) {
+				firsts[i] = x
+			}
+		}(i, x)
+	}
+	wg.Wait()
+	return results, firsts
+}
+
+// Last keeps the value of whichever goroutine writes out[0] last
+func Last(n int) []int {
+	var wg sync.WaitGroup
+	out := make([]int, 1)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			out[0] = i
+		}(i)
+	}
+	wg.Wait()
+	return out
+}
+
+// Second reads the element a goroutine writes
+func Second() int {
+	var arr [2]int
+	go func() {
+		arr[1] = 5
+	}()
+	return arr[1]
+}
+
+// Tally increments the same element in a goroutine and in its parent
+func Tally() int {
+	counts := make([]int, 1)
+	done := make(chan bool)
+	go func() {
+		counts[0]++
+		done <- true
+	}()
+	counts[0]++
+	<-done
+	return counts[0]
+}
@@ -0,0 +1,9 @@
+package modern
+
+func start(n int, work func(int)) {
+	for i := 0; i < n; i++ {
+		go func() {
+			work(i)
+		}()
+	}
+}
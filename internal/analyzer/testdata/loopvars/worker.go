@@ -0,0 +1,39 @@
+package loopvars
+
+import (
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+func process(items []string, handle func(string) error) error {
+	var g errgroup.Group
+	for _, item := range items {
+		g.Go(func() error {
+			return handle(item)
+		})
+	}
+	return g.Wait()
+}
+
+func start(n int, work func(int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// The goroutines receive the index and use a copy of the item
+func startCopies(items []string, handle func(int, string)) {
+	for i, item := range items {
+		item := item
+		go func(i int) {
+			handle(i, item)
+		}(i)
+	}
+}
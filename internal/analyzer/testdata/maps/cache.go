@@ -0,0 +1,39 @@
+package maps
+
+import "sync"
+
+type cache struct {
+	mu      sync.RWMutex
+	entries map[string]int
+	seen    map[string]bool
+}
+
+func (c *cache) Refresh(keys []string) {
+	for _, k := range keys {
+		go func(k string) {
+			c.mu.RLock()
+			c.entries[k] = len(k)
+			c.mu.RUnlock()
+		}(k)
+	}
+}
+
+func (c *cache) Lookup(k string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.entries[k]
+}
+
+func (c *cache) Mark(k string) {
+	go func() {
+		c.mu.Lock()
+		c.seen[k] = true
+		c.mu.Unlock()
+	}()
+}
+
+func (c *cache) Seen(k string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.seen[k]
+}
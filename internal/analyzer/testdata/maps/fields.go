@@ -0,0 +1,19 @@
+package maps
+
+// index and journal both have a field m, of different kinds
+type index struct {
+	m map[string]int
+}
+
+type journal struct {
+	m []string
+}
+
+func Fill(ix *index, j *journal, keys []string) {
+	for i, k := range keys {
+		go func(i int, k string) {
+			ix.m[k] = i
+			j.m[i] = k
+		}(i, k)
+	}
+}
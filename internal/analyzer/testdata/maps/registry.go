@@ -0,0 +1,32 @@
+package maps
+
+import "sync"
+
+type names map[string]int
+
+var registry = names{}
+
+func Unregister(all []string) {
+	var wg sync.WaitGroup
+	for _, n := range all {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			delete(registry, n)
+		}(n)
+	}
+	wg.Wait()
+	registry["x"] = 1
+}
+
+func Local() map[int]int {
+	m := make(map[int]int)
+	done := make(chan bool)
+	go func() {
+		m[1] = 1
+		done <- true
+	}()
+	<-done
+	m[2] = 2
+	return m
+}
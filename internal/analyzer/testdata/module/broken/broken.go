@@ -0,0 +1,4 @@
+package broken
+
+func broken( {
+}
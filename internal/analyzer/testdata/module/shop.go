@@ -0,0 +1,2 @@
+// Package shop sells from a store
+package shop
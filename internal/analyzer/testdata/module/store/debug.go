@@ -0,0 +1,10 @@
+//go:build debug
+
+package store
+
+// Dump clears the orders in debug builds
+func (s *Store) Dump() {
+	go func() {
+		s.orders = -1
+	}()
+}
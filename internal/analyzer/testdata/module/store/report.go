@@ -0,0 +1,11 @@
+package store
+
+// Report returns the number of orders, without the lock Take holds
+func (s *Store) Report() int {
+	return s.orders
+}
+
+// Reset clears the orders, which Take writes in another file
+func (s *Store) Reset() {
+	s.orders = 0
+}
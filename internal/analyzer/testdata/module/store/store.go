@@ -0,0 +1,16 @@
+package store
+
+import "sync"
+
+// Store counts the orders it takes
+type Store struct {
+	mu     sync.Mutex
+	orders int
+}
+
+// Take records an order
+func (s *Store) Take() {
+	s.mu.Lock()
+	s.orders++
+	s.mu.Unlock()
+}
@@ -0,0 +1,11 @@
+package store
+
+import "testing"
+
+func TestTake(t *testing.T) {
+	s := &Store{}
+	s.Take()
+	if s.Report() != 1 {
+		t.Error("want 1 order")
+	}
+}
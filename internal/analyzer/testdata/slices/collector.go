@@ -0,0 +1,43 @@
+package slices
+
+import "sync"
+
+type collector struct {
+	mu      sync.Mutex
+	results []string
+	errs    []error
+}
+
+func (c *collector) Collect(items []string) {
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		go func(item string) {
+			defer wg.Done()
+			c.results = append(c.results, item)
+		}(item)
+	}
+	wg.Wait()
+}
+
+func (c *collector) Fail(err error) {
+	go func() {
+		c.mu.Lock()
+		c.errs = append(c.errs, err)
+		c.mu.Unlock()
+	}()
+}
+
+func (c *collector) Errors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.errs
+}
+
+func Shift(parts []int) {
+	go func() {
+		rest := parts[1:]
+		parts = rest
+	}()
+	parts[0] = 1
+}
@@ -0,0 +1,62 @@
+package subtests
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCollectAll(t *testing.T) {
+	scenarioSet := []struct {
+		name   string
+		values []int
+		want   int
+	}{
+		{name: "empty"},
+		{name: "one value", values: []int{1}, want: 1},
+	}
+	for _, tt := range scenarioSet {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := sum(tt.values); got != tt.want {
+				t.Errorf("sum() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCounters(t *testing.T) {
+	var mu sync.Mutex
+	runs, locked := 0, 0
+	seen := make(map[string]bool)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			runs++
+			t.Parallel()
+			seen[name] = true
+			mu.Lock()
+			locked++
+			mu.Unlock()
+		})
+	}
+	t.Run("report", func(t *testing.T) {
+		t.Parallel()
+		if locked > runs {
+			t.Error("more locked runs than runs")
+		}
+	})
+}
+
+// Each subtest copies the entry, and the fixture is only read
+func TestCopies(t *testing.T) {
+	fixture := []int{1, 2}
+	for _, want := range []int{3} {
+		want := want
+		t.Run("sum", func(t *testing.T) {
+			t.Parallel()
+			if got := sum(fixture); got != want {
+				t.Errorf("sum() = %d, want %d", got, want)
+			}
+		})
+	}
+}
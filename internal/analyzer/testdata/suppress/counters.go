@@ -0,0 +1,41 @@
+package suppress
+
+import "sync"
+
+var hits, misses, drops, errs, total int
+
+func record(wg *sync.WaitGroup) {
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		//drfix:ignore lockset hits is only approximate for metrics
+		hits++
+	}()
+	go func() {
+		defer wg.Done()
+		misses++ //drfix:ignore lockset misses is only approximate for metrics
+	}()
+	go func() {
+		defer wg.Done()
+		//drfix:ignore lockset
+		drops++
+	}()
+	go func() {
+		defer wg.Done()
+		//drfix:ignore field-race errs is not a field
+		errs++
+	}()
+}
+
+// count counts in the background
+//
+//drfix:ignore lockset total is reset before counting starts
+func count() {
+	go func() {
+		total++
+	}()
+}
+
+func reset() {
+	hits, misses, drops, errs, total = 0, 0, 0, 0, 0
+}
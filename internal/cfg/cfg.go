@@ -0,0 +1,350 @@
+package cfg
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// Graph is the intraprocedural control flow graph of a function. Its nodes
+// are the statements of the body; compound statements stand for their
+// header, such as the condition of an if or the case expressions of a case
+// clause, and blocks are not nodes.
+type Graph struct {
+	Func ast.Node // *ast.FuncDecl or *ast.FuncLit
+	// Entry precedes the first statements of the body, and Exit follows the
+	// statements control leaves the function from: returns, panics and the
+	// end of the body
+	Entry *Node
+	Exit  *Node
+	// Nodes lists Entry, the statements in the order they are built, which
+	// is source order except for the post statement of a for loop, and Exit
+	Nodes []*Node
+	// Defers are the defer statements of the body, in source order. A defer
+	// statement is a node where its call is registered; the deferred calls
+	// run when control reaches Exit, in reverse order.
+	Defers []*ast.DeferStmt
+
+	stmts map[ast.Stmt]*Node
+	reach map[*Node]map[*Node]bool
+}
+
+// Node is a statement, or the entry or exit of a function
+type Node struct {
+	Index int
+	Stmt  ast.Stmt // nil for Entry and Exit
+	Succs []*Node
+	Preds []*Node
+}
+
+// File builds the graphs of the function declarations and function literals
+// of a file with a body, in source order
+func File(file *ast.File) []*Graph {
+	var graphs []*Graph
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			if g := New(n); g != nil {
+				graphs = append(graphs, g)
+			}
+		}
+		return true
+	})
+	return graphs
+}
+
+// New builds the graph of a function declaration or literal. It returns nil
+// for other nodes and for declarations without a body. Statements of
+// function literals in the body belong to the graphs of the literals.
+func New(fn ast.Node) *Graph {
+	var body *ast.BlockStmt
+	switch fn := fn.(type) {
+	case *ast.FuncDecl:
+		body = fn.Body
+	case *ast.FuncLit:
+		body = fn.Body
+	}
+	if body == nil {
+		return nil
+	}
+
+	g := &Graph{Func: fn, stmts: make(map[ast.Stmt]*Node)}
+	g.Entry = g.add(nil)
+	b := &builder{g: g, exit: &Node{}, labels: make(map[string]*Node)}
+	b.jump(b.list(body.List, []*Node{g.Entry}), b.exit)
+	for _, s := range b.gotos {
+		if l, ok := b.labels[s.Label.Name]; ok {
+			b.edge(g.stmts[s], l)
+		}
+	}
+	b.exit.Index = len(g.Nodes)
+	g.Exit = b.exit
+	g.Nodes = append(g.Nodes, g.Exit)
+	return g
+}
+
+// Node returns the node of a statement, or nil if the statement is not a
+// node, such as a block or the communication of a select case
+func (g *Graph) Node(s ast.Stmt) *Node {
+	return g.stmts[s]
+}
+
+// Reaches reports whether control can go from one node to another by
+// following one or more edges. A node in a loop reaches itself.
+func (g *Graph) Reaches(from, to *Node) bool {
+	if g.reach == nil {
+		g.reach = make(map[*Node]map[*Node]bool)
+	}
+	seen, ok := g.reach[from]
+	if !ok {
+		seen = make(map[*Node]bool)
+		work := append([]*Node(nil), from.Succs...)
+		for len(work) > 0 {
+			n := work[len(work)-1]
+			work = work[:len(work)-1]
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			work = append(work, n.Succs...)
+		}
+		g.reach[from] = seen
+	}
+	return seen[to]
+}
+
+func (g *Graph) add(s ast.Stmt) *Node {
+	n := &Node{Index: len(g.Nodes), Stmt: s}
+	g.Nodes = append(g.Nodes, n)
+	if s != nil {
+		g.stmts[s] = n
+	}
+	return n
+}
+
+// target is a statement that break or continue can leave or repeat
+type target struct {
+	label     string
+	loop      bool
+	breaks    []*Node
+	continues []*Node
+}
+
+type builder struct {
+	g       *Graph
+	exit    *Node
+	targets []*target
+	label   string // Label of the statement being built, if any
+	labels  map[string]*Node
+	gotos   []*ast.BranchStmt
+}
+
+func (b *builder) edge(p, n *Node) {
+	for _, s := range p.Succs {
+		if s == n {
+			return
+		}
+	}
+	p.Succs = append(p.Succs, n)
+	n.Preds = append(n.Preds, p)
+}
+
+// jump adds edges from preds to n
+func (b *builder) jump(preds []*Node, n *Node) {
+	for _, p := range preds {
+		b.edge(p, n)
+	}
+}
+
+// node adds the node of s, entered from preds
+func (b *builder) node(s ast.Stmt, preds []*Node) *Node {
+	n := b.g.add(s)
+	b.jump(preds, n)
+	return n
+}
+
+// list builds a statement list and returns the nodes control leaves it from
+func (b *builder) list(stmts []ast.Stmt, preds []*Node) []*Node {
+	for _, s := range stmts {
+		preds = b.stmt(s, preds)
+	}
+	return preds
+}
+
+// stmt builds a statement entered from preds and returns the nodes control
+// continues after it from
+func (b *builder) stmt(s ast.Stmt, preds []*Node) []*Node {
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		return b.list(s.List, preds)
+
+	case *ast.LabeledStmt:
+		n := b.node(s, preds)
+		b.labels[s.Label.Name] = n
+		switch s.Stmt.(type) {
+		case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			b.label = s.Label.Name
+		}
+		return b.stmt(s.Stmt, []*Node{n})
+
+	case *ast.IfStmt:
+		if s.Init != nil {
+			preds = b.stmt(s.Init, preds)
+		}
+		n := b.node(s, preds)
+		exits := b.list(s.Body.List, []*Node{n})
+		if s.Else != nil {
+			return append(exits, b.stmt(s.Else, []*Node{n})...)
+		}
+		return append(exits, n)
+
+	case *ast.ForStmt:
+		t := b.push(true)
+		if s.Init != nil {
+			preds = b.stmt(s.Init, preds)
+		}
+		n := b.node(s, preds)
+		next := b.list(s.Body.List, []*Node{n})
+		next = append(next, t.continues...)
+		if s.Post != nil {
+			next = []*Node{b.node(s.Post, next)}
+		}
+		b.jump(next, n)
+		b.pop()
+		if s.Cond != nil {
+			return append(t.breaks, n)
+		}
+		return t.breaks
+
+	case *ast.RangeStmt:
+		t := b.push(true)
+		n := b.node(s, preds)
+		next := b.list(s.Body.List, []*Node{n})
+		b.jump(next, n)
+		b.jump(t.continues, n)
+		b.pop()
+		return append(t.breaks, n)
+
+	case *ast.SwitchStmt:
+		t := b.push(false)
+		if s.Init != nil {
+			preds = b.stmt(s.Init, preds)
+		}
+		exits := b.clauses(b.node(s, preds), s.Body)
+		b.pop()
+		return append(exits, t.breaks...)
+
+	case *ast.TypeSwitchStmt:
+		t := b.push(false)
+		if s.Init != nil {
+			preds = b.stmt(s.Init, preds)
+		}
+		exits := b.clauses(b.node(s, preds), s.Body)
+		b.pop()
+		return append(exits, t.breaks...)
+
+	case *ast.SelectStmt:
+		t := b.push(false)
+		exits := b.clauses(b.node(s, preds), s.Body)
+		b.pop()
+		return append(exits, t.breaks...)
+
+	case *ast.BranchStmt:
+		n := b.node(s, preds)
+		switch s.Tok {
+		case token.BREAK:
+			if t := b.find(s.Label, false); t != nil {
+				t.breaks = append(t.breaks, n)
+			}
+		case token.CONTINUE:
+			if t := b.find(s.Label, true); t != nil {
+				t.continues = append(t.continues, n)
+			}
+		case token.GOTO:
+			b.gotos = append(b.gotos, s)
+		case token.FALLTHROUGH:
+			return []*Node{n}
+		}
+		return nil
+
+	case *ast.ReturnStmt:
+		b.edge(b.node(s, preds), b.exit)
+		return nil
+
+	case *ast.DeferStmt:
+		b.g.Defers = append(b.g.Defers, s)
+
+	case *ast.ExprStmt:
+		if call, ok := s.X.(*ast.CallExpr); ok {
+			if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "panic" {
+				b.edge(b.node(s, preds), b.exit)
+				return nil
+			}
+		}
+	}
+
+	// Assignments, declarations, sends, increments, go and defer statements
+	return []*Node{b.node(s, preds)}
+}
+
+// clauses builds the clauses of the switch or select statement of node n.
+// Control leaves from the end of each clause body, and from n when a switch
+// has no default clause; a fallthrough enters the next clause body.
+func (b *builder) clauses(n *Node, body *ast.BlockStmt) []*Node {
+	var exits, fall []*Node
+	hasDefault := false
+	for _, c := range body.List {
+		var stmts []ast.Stmt
+		switch c := c.(type) {
+		case *ast.CaseClause:
+			hasDefault = hasDefault || c.List == nil
+			stmts = c.Body
+		case *ast.CommClause:
+			hasDefault = hasDefault || c.Comm == nil
+			stmts = c.Body
+		}
+		cn := b.node(c, []*Node{n})
+		out := b.list(stmts, append([]*Node{cn}, fall...))
+		fall = nil
+		if k := len(stmts); k > 0 {
+			if br, ok := stmts[k-1].(*ast.BranchStmt); ok && br.Tok == token.FALLTHROUGH {
+				fall = out
+				continue
+			}
+		}
+		exits = append(exits, out...)
+	}
+	if _, ok := n.Stmt.(*ast.SelectStmt); !ok && !hasDefault {
+		exits = append(exits, n)
+	}
+	return exits
+}
+
+// push enters a breakable statement, taking the label being built
+func (b *builder) push(loop bool) *target {
+	t := &target{label: b.label, loop: loop}
+	b.label = ""
+	b.targets = append(b.targets, t)
+	return t
+}
+
+func (b *builder) pop() {
+	b.targets = b.targets[:len(b.targets)-1]
+}
+
+// find returns the statement a break or continue refers to: the labeled one,
+// or the innermost one, which must be a loop for continue
+func (b *builder) find(label *ast.Ident, loop bool) *target {
+	for i := len(b.targets) - 1; i >= 0; i-- {
+		t := b.targets[i]
+		if label != nil {
+			if t.label == label.Name {
+				return t
+			}
+			continue
+		}
+		if t.loop || !loop {
+			return t
+		}
+	}
+	return nil
+}
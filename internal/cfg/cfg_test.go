@@ -0,0 +1,327 @@
+package cfg
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, src string) (*token.FileSet, *ast.File) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "write1.go", src, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	return fset, file
+}
+
+// edges returns the edges of a graph as "source -> target", each node given
+// by its label without the line
+func edges(fset *token.FileSet, g *Graph) []string {
+	label := func(n *Node) string {
+		l := n.Label(fset, g)
+		if i := strings.Index(l, ": "); i >= 0 && n.Stmt != nil {
+			l = l[i+2:]
+		}
+		return l
+	}
+	var out []string
+	for _, n := range g.Nodes {
+		for _, s := range n.Succs {
+			out = append(out, label(n)+" -> "+label(s))
+		}
+	}
+	return out
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "if and return",
+			src: `package skeleton
+
+func func1(v0 int) int {
+	if v0 > 0 {
+		return v0
+	} else if v0 < 0 {
+		v0 = -v0
+	}
+	return 0
+}`,
+			want: []string{
+				"entry -> if v0 > 0",
+				"if v0 > 0 -> return v0",
+				"return v0 -> exit",
+				"if v0 > 0 -> if v0 < 0",
+				"if v0 < 0 -> v0 = -v0",
+				"if v0 < 0 -> return 0",
+				"v0 = -v0 -> return 0",
+				"return 0 -> exit",
+			},
+			notWant: []string{"return v0 -> return 0"},
+		},
+		{
+			name: "for with break and continue",
+			src: `package skeleton
+
+func func1() {
+	for v0 := 0; v0 < 10; v0++ {
+		if v0 == 2 {
+			continue
+		}
+		if v0 == 5 {
+			break
+		}
+		func2(v0)
+	}
+	func3()
+}`,
+			want: []string{
+				"entry -> v0 := 0",
+				"v0 := 0 -> for v0 < 10",
+				"continue -> v0++",
+				"func2(v0) -> v0++",
+				"v0++ -> for v0 < 10",
+				"break -> func3()",
+				"for v0 < 10 -> func3()",
+				"func3() -> exit",
+			},
+			notWant: []string{"continue -> func2(v0)", "break -> v0++"},
+		},
+		{
+			name: "infinite loop and labeled break",
+			src: `package skeleton
+
+func func1(v0 chan int) {
+L:
+	for {
+		for range v0 {
+			break L
+		}
+	}
+	func2()
+}`,
+			want: []string{
+				"entry -> L:",
+				"L: -> for",
+				"for -> range v0",
+				"range v0 -> break L",
+				"break L -> func2()",
+				"range v0 -> for",
+			},
+			notWant: []string{"for -> func2()", "break L -> range v0"},
+		},
+		{
+			name: "range",
+			src: `package skeleton
+
+func func1(v0 []int) {
+	for v1, v2 := range v0 {
+		func2(v1, v2)
+	}
+}`,
+			want: []string{
+				"entry -> v1, v2 := range v0",
+				"v1, v2 := range v0 -> func2(v1, v2)",
+				"func2(v1, v2) -> v1, v2 := range v0",
+				"v1, v2 := range v0 -> exit",
+			},
+		},
+		{
+			name: "switch with fallthrough",
+			src: `package skeleton
+
+func func1(v0 int) {
+	switch v0 {
+	case 1:
+		v0 = 2
+		fallthrough
+	case 2, 3:
+		v0 = 4
+	}
+	func2(v0)
+}`,
+			want: []string{
+				"switch v0 -> case 1",
+				"switch v0 -> case 2, 3",
+				"fallthrough -> v0 = 4",
+				"v0 = 4 -> func2(v0)",
+				"switch v0 -> func2(v0)",
+			},
+			notWant: []string{"fallthrough -> func2(v0)"},
+		},
+		{
+			name: "type switch with default",
+			src: `package skeleton
+
+func func1(v0 interface{}) {
+	switch v1 := v0.(type) {
+	case int:
+		func2(v1)
+	default:
+	}
+	func3()
+}`,
+			want: []string{
+				"switch v1 := v0.(type) -> case int",
+				"switch v1 := v0.(type) -> default",
+				"default -> func3()",
+			},
+			notWant: []string{"switch v1 := v0.(type) -> func3()"},
+		},
+		{
+			name: "select",
+			src: `package skeleton
+
+func func1(v0, v1 chan int) {
+	select {
+	case v2 := <-v0:
+		func2(v2)
+	case v1 <- 1:
+	}
+}`,
+			want: []string{
+				"select -> case v2 := <-v0",
+				"select -> case v1 <- 1",
+				"case v2 := <-v0 -> func2(v2)",
+				"func2(v2) -> exit",
+				"case v1 <- 1 -> exit",
+			},
+			notWant: []string{"select -> exit"},
+		},
+		{
+			name: "go, defer and panic",
+			src: `package skeleton
+
+func func1(v0 *sync.WaitGroup) {
+	defer v0.Done()
+	go func() {
+		func2()
+	}()
+	panic("StringConst0")
+	func3()
+}`,
+			want: []string{
+				"entry -> defer v0.Done()",
+				"defer v0.Done() -> go func() { ...",
+				"go func() { ... -> panic(\"StringConst0\")",
+				"panic(\"StringConst0\") -> exit",
+			},
+			notWant: []string{"go func() { ... -> func2()", "panic(\"StringConst0\") -> func3()"},
+		},
+		{
+			name: "goto",
+			src: `package skeleton
+
+func func1() {
+L:
+	func2()
+	goto L
+}`,
+			want:    []string{"goto L -> L:", "L: -> func2()"},
+			notWant: []string{"goto L -> exit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset, file := parse(t, tt.src)
+			g := New(file.Decls[0])
+			if g == nil {
+				t.Fatalf("New returned nil")
+			}
+			got := edges(fset, g)
+			for _, want := range tt.want {
+				if !contains(got, want) {
+					t.Errorf("Missing edge %q in %q", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if contains(got, notWant) {
+					t.Errorf("Unexpected edge %q", notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	fset, file := parse(t, `package skeleton
+
+func func1(v0 *sync.WaitGroup) {
+	defer v0.Done()
+	go func() {
+		func2()
+	}()
+}
+
+func (v1 *type0) func3() {
+	return
+}
+
+func func4()
+`)
+	graphs := File(file)
+	var names []string
+	for _, g := range graphs {
+		names = append(names, g.Name(fset))
+	}
+	want := []string{"func1", "func@5:5", "(type0).func3"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("Graphs = %q, want %q", names, want)
+	}
+
+	g := graphs[0]
+	if len(g.Defers) != 1 {
+		t.Errorf("Got %d defers, want 1", len(g.Defers))
+	}
+	// The literal's statements belong to its own graph
+	if n := len(g.Nodes); n != 4 {
+		t.Errorf("Got %d nodes in func1, want entry, defer, go and exit", n)
+	}
+	lit := graphs[1]
+	if !g.Reaches(g.Entry, g.Exit) || !lit.Reaches(lit.Entry, lit.Exit) {
+		t.Errorf("Exit is not reachable from entry")
+	}
+	if g.Reaches(g.Exit, g.Entry) {
+		t.Errorf("Entry is reachable from exit")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, fset, graphs); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	dot := buf.String()
+	for _, want := range []string{
+		`digraph "func1" {`,
+		`digraph "(type0).func3" {`,
+		`n0 [label="entry", shape=ellipse];`,
+		`n1 [label="4: defer v0.Done()"];`,
+		`n0 -> n1;`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT output missing %q:\n%s", want, dot)
+		}
+	}
+	if n := strings.Count(dot, "digraph"); n != 3 {
+		t.Errorf("Got %d digraphs, want 3", n)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package cfg
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLabel is the number of characters of a statement kept in a DOT label
+const maxLabel = 60
+
+// Name returns the name of the function of a graph: the name of a function
+// declaration, qualified by its receiver type for methods, or func@LINE:COL
+// for a function literal
+func (g *Graph) Name(fset *token.FileSet) string {
+	switch fn := g.Func.(type) {
+	case *ast.FuncDecl:
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			return fmt.Sprintf("(%s).%s", oneLine(fset, recv), fn.Name.Name)
+		}
+		return fn.Name.Name
+	}
+	pos := fset.Position(g.Func.Pos())
+	return fmt.Sprintf("func@%d:%d", pos.Line, pos.Column)
+}
+
+// Label returns the text of a node: entry, exit, or the line of its
+// statement followed by the statement's header
+func (n *Node) Label(fset *token.FileSet, g *Graph) string {
+	switch n {
+	case g.Entry:
+		return "entry"
+	case g.Exit:
+		return "exit"
+	}
+	return fmt.Sprintf("%d: %s", fset.Position(n.Stmt.Pos()).Line, header(fset, n.Stmt))
+}
+
+// header returns the part of a statement its node stands for
+func header(fset *token.FileSet, s ast.Stmt) string {
+	var text string
+	switch s := s.(type) {
+	case *ast.LabeledStmt:
+		return s.Label.Name + ":"
+	case *ast.IfStmt:
+		text = "if " + oneLine(fset, s.Cond)
+	case *ast.ForStmt:
+		text = "for"
+		if s.Cond != nil {
+			text += " " + oneLine(fset, s.Cond)
+		}
+	case *ast.RangeStmt:
+		text = "range " + oneLine(fset, s.X)
+		if s.Key != nil {
+			vars := oneLine(fset, s.Key)
+			if s.Value != nil {
+				vars += ", " + oneLine(fset, s.Value)
+			}
+			text = vars + " " + s.Tok.String() + " " + text
+		}
+	case *ast.SwitchStmt:
+		text = "switch"
+		if s.Tag != nil {
+			text += " " + oneLine(fset, s.Tag)
+		}
+	case *ast.TypeSwitchStmt:
+		text = "switch " + oneLine(fset, s.Assign)
+	case *ast.SelectStmt:
+		text = "select"
+	case *ast.CaseClause:
+		if s.List == nil {
+			return "default"
+		}
+		var list []string
+		for _, e := range s.List {
+			list = append(list, oneLine(fset, e))
+		}
+		text = "case " + strings.Join(list, ", ")
+	case *ast.CommClause:
+		if s.Comm == nil {
+			return "default"
+		}
+		text = "case " + oneLine(fset, s.Comm)
+	default:
+		text = oneLine(fset, s)
+	}
+	return text
+}
+
+// oneLine prints a node, cut after its first line or maxLabel characters
+func oneLine(fset *token.FileSet, n ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, n); err != nil {
+		return fmt.Sprintf("%T", n)
+	}
+	text := buf.String()
+	cut := false
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text, cut = text[:i], true
+	}
+	if utf8.RuneCountInString(text) > maxLabel {
+		text, cut = string([]rune(text)[:maxLabel]), true
+	}
+	if cut {
+		text += " ..."
+	}
+	return text
+}
+
+// WriteDOT writes the graphs as one DOT digraph each, named after their
+// function
+func WriteDOT(w io.Writer, fset *token.FileSet, graphs []*Graph) error {
+	for _, g := range graphs {
+		if _, err := fmt.Fprintf(w, "digraph %s {\n\tnode [shape=box];\n", strconv.Quote(g.Name(fset))); err != nil {
+			return err
+		}
+		for _, n := range g.Nodes {
+			attrs := ""
+			if n == g.Entry || n == g.Exit {
+				attrs = ", shape=ellipse"
+			}
+			if _, err := fmt.Fprintf(w, "\tn%d [label=%s%s];\n", n.Index, strconv.Quote(n.Label(fset, g)), attrs); err != nil {
+				return err
+			}
+		}
+		for _, n := range g.Nodes {
+			for _, s := range n.Succs {
+				if _, err := fmt.Fprintf(w, "\tn%d -> n%d;\n", n.Index, s.Index); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := fmt.Fprintf(w, "}\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
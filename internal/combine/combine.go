@@ -0,0 +1,323 @@
+package combine
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/corpus"
+	"github.com/uber/data-race-skeletons/internal/stubgen"
+)
+
+// Marker starts the declarations of one skeleton file in the combined file,
+// followed by the case and file name
+const Marker = "//combine:case"
+
+const defaultPackage = "skeleton"
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Entry locates one skeleton file in the combined file
+type Entry struct {
+	Case   string `json:"case"`
+	File   string `json:"file"`
+	Suffix string `json:"suffix"`
+	// Names maps the package-level names of the file to their mangled names
+	Names map[string]string `json:"names,omitempty"`
+	// Line is the line of the file's marker and EndLine its last line
+	Line    int `json:"line,omitempty"`
+	EndLine int `json:"end_line,omitempty"`
+	// Skipped is why the file was left out
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// Options controls how skeletons are combined
+type Options struct {
+	// Package is the package name of the combined file, skeleton if empty
+	Package string
+	// Stubs adds the declarations synthesized by stubgen so that the combined
+	// file compiles. Files whose module does not type-check are skipped.
+	Stubs bool
+}
+
+// Result is a combined file and its case index
+type Result struct {
+	Src   []byte
+	Index []Entry
+}
+
+// part is a mangled skeleton file before it is placed in the combined file
+type part struct {
+	body    []byte
+	imports []string
+}
+
+// Dir combines the skeleton cases found in dir
+func Dir(dir string, opts Options) (*Result, error) {
+	cases, err := corpus.FindCases(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no skeletons found in %s", dir)
+	}
+	return Combine(cases, opts)
+}
+
+// Combine merges the files of every case into one package. Package-level names
+// are mangled with a suffix made of the case and file name, so that the many
+// func1 and type0 declarations of the dataset do not collide.
+func Combine(cases []corpus.Case, opts Options) (*Result, error) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = defaultPackage
+	}
+
+	var index []Entry
+	var parts []part
+	imports := make(map[string]bool)
+	for _, c := range cases {
+		for _, filename := range c.Files {
+			name := filepath.Base(filename)
+			e := Entry{Case: c.Name, File: name, Suffix: suffix(c.Name, name)}
+			p, err := mangleFile(filename, e.Suffix, opts.Stubs, &e)
+			if err != nil {
+				e.Skipped = err.Error()
+				index = append(index, e)
+				continue
+			}
+			for _, path := range p.imports {
+				imports[path] = true
+			}
+			index = append(index, e)
+			parts = append(parts, p)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by combine. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	var paths []string
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if len(paths) > 0 {
+		b.WriteString("import (\n")
+		for _, path := range paths {
+			fmt.Fprintf(&b, "%q\n", path)
+		}
+		b.WriteString(")\n")
+	}
+	i := 0
+	for _, e := range index {
+		if e.Skipped != "" {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s %s %s\n", Marker, e.Case, e.File)
+		b.Write(parts[i].body)
+		b.WriteString("\n")
+		i++
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error formatting combined file: %v", err)
+	}
+	locate(src, index)
+	return &Result{Src: src, Index: index}, nil
+}
+
+// suffix names the mangling of a file, for example _D10447847_read1
+func suffix(caseName, filename string) string {
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	return "_" + nonIdentifier.ReplaceAllString(caseName, "_") + "_" + nonIdentifier.ReplaceAllString(stem, "_")
+}
+
+// mangleFile renames the package-level names of a skeleton file, and of its
+// stubs if requested, and returns its declarations without package clause and imports
+func mangleFile(filename, suffix string, stubs bool, e *Entry) (part, error) {
+	var srcs []stubgen.Source
+	if stubs {
+		m, err := stubgen.GenerateFiles([]string{filename}, stubgen.Options{})
+		if err != nil {
+			return part{}, err
+		}
+		if errs := m.Check(); len(errs) > 0 {
+			return part{}, fmt.Errorf("does not compile: %v", errs[0])
+		}
+		name := filepath.Base(filename)
+		srcs = []stubgen.Source{{Name: name, Src: m.Files[name]}, {Name: stubgen.StubFile, Src: m.Files[stubgen.StubFile]}}
+	} else {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return part{}, err
+		}
+		srcs = []stubgen.Source{{Name: filepath.Base(filename), Src: src}}
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, src := range srcs {
+		file, err := parser.ParseFile(fset, src.Name, src.Src, parser.ParseComments)
+		if err != nil {
+			return part{}, fmt.Errorf("error parsing file: %v", err)
+		}
+		files = append(files, file)
+	}
+
+	e.Names = make(map[string]string)
+	for _, file := range files {
+		for _, name := range packageNames(file) {
+			e.Names[name] = name + suffix
+		}
+	}
+
+	var p part
+	for i, file := range files {
+		imported := make(map[string]bool)
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			p.imports = append(p.imports, path)
+			if spec.Name != nil {
+				imported[spec.Name.Name] = true
+			} else {
+				imported[path[strings.LastIndex(path, "/")+1:]] = true
+			}
+		}
+		body, err := rename(fset, file, srcs[i].Src, e.Names, imported)
+		if err != nil {
+			return part{}, fmt.Errorf("%s: %v", srcs[i].Name, err)
+		}
+		p.body = append(p.body, body...)
+		p.body = append(p.body, '\n')
+	}
+	return p, nil
+}
+
+// packageNames returns the names a file declares at package level, and the
+// receiver types of its methods, which skeletons usually do not declare
+func packageNames(file *ast.File) []string {
+	var names []string
+	add := func(id *ast.Ident) {
+		switch id.Name {
+		case "_", "init", "main":
+			return
+		}
+		names = append(names, id.Name)
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				add(d.Name)
+				continue
+			}
+			t := d.Recv.List[0].Type
+			if star, ok := t.(*ast.StarExpr); ok {
+				t = star.X
+			}
+			switch r := t.(type) {
+			case *ast.Ident:
+				add(r)
+			case *ast.IndexExpr:
+				if id, ok := r.X.(*ast.Ident); ok {
+					add(id)
+				}
+			case *ast.IndexListExpr:
+				if id, ok := r.X.(*ast.Ident); ok {
+					add(id)
+				}
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name)
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						add(name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// rename replaces every identifier named in names, except members selected
+// from imported packages, and returns the source after the imports
+func rename(fset *token.FileSet, file *ast.File, src []byte, names map[string]string, imported map[string]bool) ([]byte, error) {
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok && imported[x.Name] {
+				return false
+			}
+		case *ast.Ident:
+			if mangled, ok := names[n.Name]; ok {
+				start := fset.Position(n.Pos()).Offset
+				edits = append(edits, edit{start, start + len(n.Name), mangled})
+			}
+		}
+		return true
+	})
+
+	start := fset.Position(file.Name.End()).Offset
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			start = fset.Position(d.End()).Offset
+		}
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	out := append([]byte(nil), src...)
+	for _, e := range edits {
+		if e.start < start {
+			return nil, fmt.Errorf("name %q before the declarations", e.text)
+		}
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+	}
+	return bytes.TrimSpace(out[start:]), nil
+}
+
+// locate records the lines of each included file in the combined source
+func locate(src []byte, index []Entry) {
+	lines := strings.Split(string(src), "\n")
+	var last *Entry
+	i := 0
+	for n, line := range lines {
+		if !strings.HasPrefix(line, Marker+" ") {
+			continue
+		}
+		for i < len(index) && index[i].Skipped != "" {
+			i++
+		}
+		if i == len(index) {
+			break
+		}
+		if last != nil {
+			last.EndLine = n - 1
+		}
+		last = &index[i]
+		last.Line = n + 1
+		i++
+	}
+	if last != nil {
+		last.EndLine = len(lines)
+		if lines[len(lines)-1] == "" {
+			last.EndLine--
+		}
+	}
+}
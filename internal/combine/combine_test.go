@@ -0,0 +1,120 @@
+package combine
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// typeErrors type-checks a combined file and returns its errors
+func typeErrors(t *testing.T, src []byte) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "combined.go", src, 0)
+	if err != nil {
+		t.Fatalf("combined file does not parse: %v", err)
+	}
+	var errs []string
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(err error) { errs = append(errs, err.Error()) },
+	}
+	// Errors are collected by conf.Error
+	conf.Check("skeleton", fset, []*ast.File{file}, nil)
+	return errs
+}
+
+func TestDir(t *testing.T) {
+	result, err := Dir("testdata", Options{})
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	src := string(result.Src)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "header", want: "// Code generated by combine. DO NOT EDIT.\n\npackage skeleton\n"},
+		{name: "marker", want: Marker + " D1 read1.go\n"},
+		{name: "receiver mangled", want: "func (v0 *type0_D1_read1) func1("},
+		{name: "receiver mangled in second file", want: "func (v0 *type0_D1_write1) func2("},
+		{name: "identical files kept apart", want: "func (v1 *type0_D2_write1) func1("},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(src, tt.want) {
+				t.Errorf("missing %q in:\n%s", tt.want, src)
+			}
+		})
+	}
+
+	if n := strings.Count(src, "\npackage "); n != 1 {
+		t.Errorf("combined file has %d package clauses", n)
+	}
+	for _, err := range typeErrors(t, result.Src) {
+		if strings.Contains(err, "redeclared") || strings.Contains(err, "already declared") {
+			t.Errorf("declarations collide: %s", err)
+		}
+	}
+
+	lines := strings.Split(src, "\n")
+	if len(result.Index) != 5 {
+		t.Fatalf("Index has %d entries, want 5", len(result.Index))
+	}
+	for _, e := range result.Index {
+		if e.Case == "D3" {
+			if e.Skipped == "" {
+				t.Errorf("unparsable file was not skipped")
+			}
+			continue
+		}
+		if want := Marker + " " + e.Case + " " + e.File; e.Line == 0 || lines[e.Line-1] != want {
+			t.Errorf("%s/%s: line %d is not %q", e.Case, e.File, e.Line, want)
+		}
+		if e.EndLine <= e.Line || strings.TrimSpace(lines[e.EndLine-1]) != "}" {
+			t.Errorf("%s/%s: end line %d is not the end of a declaration", e.Case, e.File, e.EndLine)
+		}
+	}
+	if got := result.Index[0].Names["type0"]; got != "type0_D1_read1" {
+		t.Errorf("Names[type0] = %q", got)
+	}
+}
+
+func TestDirStubs(t *testing.T) {
+	result, err := Dir("testdata", Options{Stubs: true, Package: "combined"})
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	if errs := typeErrors(t, result.Src); len(errs) > 0 {
+		t.Errorf("combined file does not compile: %v\n%s", errs, result.Src)
+	}
+	src := string(result.Src)
+	for _, want := range []string{"package combined", "\"sync/atomic\"", "var Wrapper1_D2_read1 = &", "atomic.AddInt64(&v1.v14, IntConst0_D2_read1)"} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q in:\n%s", want, src)
+		}
+	}
+}
+
+func TestSuffix(t *testing.T) {
+	if got := suffix("D10447847", "read1.go"); got != "_D10447847_read1" {
+		t.Errorf("suffix() = %q", got)
+	}
+	if got := suffix("case-1", "write.v2.go"); got != "_case_1_write_v2" {
+		t.Errorf("suffix() = %q", got)
+	}
+}
+
+func TestDirErrors(t *testing.T) {
+	if _, err := Dir("nonexistent", Options{}); err == nil {
+		t.Errorf("Dir() expected error for a missing directory")
+	}
+	if _, err := Dir(t.TempDir(), Options{}); err == nil {
+		t.Errorf("Dir() expected error for a directory without skeletons")
+	}
+}
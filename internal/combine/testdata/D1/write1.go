@@ -0,0 +1,11 @@
+package skeleton
+
+func (v0 *type0) func2(v2 pkg0.v3, v1 []int) {
+	for _, v4 := range v2.Func5() {
+		Wrapper1.Go(func() error {
+			v0.racyVar0 += v4
+			return nil
+		})
+	}
+	Wrapper1.Wait()
+}
@@ -0,0 +1,24 @@
+package skeleton
+
+func (v1 *type0) func1(v2 pkg0.v3, v4 []pkg1.v5) (map[string]*pkg1.v5, type1) {
+	var v6 sync.Mutex
+	racyVar0 := make(map[string]*pkg1.v5, len(v4))
+	v7, v2 := errgroup.WithContext(v2)
+	for _, v8 := range v4 {
+		Wrapper1.Go(func() type1 {
+			v9, v10 := v1.v11.Func2(v2, v8.v12)
+			if v10 != nil {
+				return v10
+			}
+			v6.Lock()
+			racyVar0[v8.v13] = v9
+			v6.Unlock()
+			return nil
+		})
+	}
+	if v10 := Wrapper1.Wait(); v10 != nil {
+		return nil, pkg2.Func3(v10, "StringConst0")
+	}
+	atomic.AddInt64(&v1.v14, IntConst0)
+	return racyVar0, nil
+}
@@ -0,0 +1,62 @@
+// Package corpus finds the skeleton cases of a corpus directory
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ModuleSuffix is appended to a skeleton's path to name the module
+// directory generated for it, which is not a case
+const ModuleSuffix = ".module"
+
+// Case is a skeleton pair, or a single skeleton run against itself
+type Case struct {
+	Name  string
+	Files []string
+}
+
+// FindCases returns the case dir holds if it has Go files, or else the cases in its subdirectories
+func FindCases(dir string) ([]Case, error) {
+	files, err := goFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		return []Case{{Name: filepath.Base(dir), Files: files}}, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasSuffix(entry.Name(), ModuleSuffix) {
+			continue
+		}
+		files, err := goFiles(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 {
+			cases = append(cases, Case{Name: entry.Name(), Files: files})
+		}
+	}
+	return cases, nil
+}
+
+func goFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,40 @@
+package corpus
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindCases(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want []Case
+	}{
+		{
+			dir: "testdata",
+			want: []Case{
+				{Name: "pair", Files: []string{filepath.Join("testdata", "pair", "read1.go"), filepath.Join("testdata", "pair", "write1.go")}},
+				{Name: "single", Files: []string{filepath.Join("testdata", "single", "write1.go")}},
+			},
+		},
+		{
+			dir:  "testdata/single",
+			want: []Case{{Name: "single", Files: []string{filepath.Join("testdata", "single", "write1.go")}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			got, err := FindCases(tt.dir)
+			if err != nil {
+				t.Fatalf("FindCases() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindCases() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := FindCases("testdata/missing"); err == nil {
+		t.Error("FindCases() of a missing directory succeeded")
+	}
+}
@@ -0,0 +1,5 @@
+package skeleton
+
+import "testing"
+
+func TestSkeleton(t *testing.T) {}
@@ -0,0 +1,7 @@
+package skeleton
+
+var racyVar0 int
+
+func func0() {
+	racyVar0 = 1
+}
@@ -0,0 +1,8 @@
+package skeleton
+
+var racyVar0 int
+
+func func0() {
+	go func() { racyVar0++ }()
+	racyVar0++
+}
@@ -0,0 +1,411 @@
+package cpg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/analyzer"
+	"github.com/uber/data-race-skeletons/internal/cfg"
+	"github.com/uber/data-race-skeletons/internal/corpus"
+)
+
+// Edge kinds
+const (
+	// EdgeAST links a node to its children
+	EdgeAST = "ast"
+	// EdgeCFG links a statement to the statements control may continue at,
+	// and a function to the statements its body starts at
+	EdgeCFG = "cfg"
+	// EdgeDefUse links an assignment of a variable to the uses it may reach
+	EdgeDefUse = "def-use"
+	// EdgeSpawn links a go statement or spawner call to the function it runs
+	EdgeSpawn = "spawn"
+)
+
+// Node is an AST node. Positions are in the skeleton file.
+type Node struct {
+	ID   int    `json:"id"`
+	Kind string `json:"kind"` // AST node type, such as AssignStmt
+	// Label is the name of an identifier, the value of a literal or the
+	// token of an operator, assignment or branch
+	Label  string `json:"label,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+	End    int    `json:"end"`
+	// Racy is set on racy variable identifiers, and Access on those that the
+	// analyzer reports as a read or write
+	Racy   bool   `json:"racy,omitempty"`
+	Access string `json:"access,omitempty"`
+}
+
+// Edge is a directed edge between nodes
+type Edge struct {
+	Source int    `json:"source"`
+	Target int    `json:"target"`
+	Kind   string `json:"kind"`
+}
+
+// Graph is the code property graph of a skeleton file
+type Graph struct {
+	Case  string `json:"case,omitempty"`
+	File  string `json:"file"`
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+	Error string `json:"error,omitempty"`
+}
+
+// Dir builds the graphs of the files of the skeleton cases found in dir.
+// Files that do not parse get an empty graph with their error.
+func Dir(dir string) ([]*Graph, error) {
+	cases, err := corpus.FindCases(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no skeletons found in %s", dir)
+	}
+	var graphs []*Graph
+	for _, c := range cases {
+		for _, filename := range c.Files {
+			g, err := File(filename)
+			if err != nil {
+				g = &Graph{File: filepath.Base(filename), Nodes: []Node{}, Edges: []Edge{}, Error: err.Error()}
+			}
+			g.Case = c.Name
+			graphs = append(graphs, g)
+		}
+	}
+	return graphs, nil
+}
+
+// File builds the graph of a skeleton file
+func File(filename string) (*Graph, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filepath.Base(filename), src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing file: %v", err)
+	}
+	return Build(fset, file), nil
+}
+
+// builder holds the state of Build
+type builder struct {
+	fset  *token.FileSet
+	g     *Graph
+	ids   map[ast.Node]int
+	seen  map[Edge]bool
+	funcs []ast.Node // FuncDecl and FuncLit nodes, in source order
+	// graphs are the control flow graphs of the functions with a body
+	graphs map[ast.Node]*cfg.Graph
+	// refs are the variable references, in source order
+	refs []*ref
+}
+
+// ref is an occurrence of a variable or of a field selected from one
+type ref struct {
+	node ast.Expr
+	key  string
+	def  bool // Assigned, or declared as a parameter
+	use  bool // Read; an increment or compound assignment is both
+	fn   ast.Node
+	stmt ast.Stmt // nil for parameters, which are defined at entry
+}
+
+// Build builds the graph of a parsed file
+func Build(fset *token.FileSet, file *ast.File) *Graph {
+	b := &builder{
+		fset:   fset,
+		g:      &Graph{File: fset.Position(file.Pos()).Filename, Nodes: []Node{}, Edges: []Edge{}},
+		ids:    make(map[ast.Node]int),
+		seen:   make(map[Edge]bool),
+		graphs: make(map[ast.Node]*cfg.Graph),
+	}
+	accesses := make(map[int]string)
+	for _, a := range analyzer.Accesses(fset, file) {
+		accesses[a.Offset] = a.Kind
+	}
+
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		id := b.node(n, accesses)
+		if len(stack) > 0 {
+			b.edge(b.ids[stack[len(stack)-1]], id, EdgeAST)
+		}
+		stack = append(stack, n)
+		switch n := n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			b.funcs = append(b.funcs, n)
+		case *ast.Ident, *ast.SelectorExpr:
+			b.reference(n.(ast.Expr), stack)
+		}
+		return true
+	})
+
+	for _, fn := range b.funcs {
+		if g := cfg.New(fn); g != nil {
+			b.graphs[fn] = g
+			b.flowEdges(g)
+		}
+	}
+	b.defUseEdges()
+	b.spawnEdges(file)
+	return b.g
+}
+
+func (b *builder) node(n ast.Node, accesses map[int]string) int {
+	pos, end := b.fset.Position(n.Pos()), b.fset.Position(n.End())
+	node := Node{
+		ID:     len(b.g.Nodes),
+		Kind:   strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."),
+		Line:   pos.Line,
+		Column: pos.Column,
+		Offset: pos.Offset,
+		End:    end.Offset,
+	}
+	switch n := n.(type) {
+	case *ast.Ident:
+		node.Label = n.Name
+		if strings.HasPrefix(n.Name, "racyVar") {
+			node.Racy = true
+			node.Access = accesses[pos.Offset]
+		}
+	case *ast.BasicLit:
+		node.Label = n.Value
+	case *ast.BinaryExpr:
+		node.Label = n.Op.String()
+	case *ast.UnaryExpr:
+		node.Label = n.Op.String()
+	case *ast.AssignStmt:
+		node.Label = n.Tok.String()
+	case *ast.IncDecStmt:
+		node.Label = n.Tok.String()
+	case *ast.BranchStmt:
+		node.Label = n.Tok.String()
+	}
+	b.ids[n] = node.ID
+	b.g.Nodes = append(b.g.Nodes, node)
+	return node.ID
+}
+
+func (b *builder) edge(source, target int, kind string) {
+	e := Edge{Source: source, Target: target, Kind: kind}
+	if source != target && !b.seen[e] {
+		b.seen[e] = true
+		b.g.Edges = append(b.g.Edges, e)
+	}
+}
+
+// flowEdges adds the control flow of a function. Edges from the entry start
+// at the function node, and edges to the exit are left out.
+func (b *builder) flowEdges(g *cfg.Graph) {
+	for _, n := range g.Nodes {
+		if n == g.Exit {
+			continue
+		}
+		source := b.ids[g.Func]
+		if n != g.Entry {
+			source = b.ids[n.Stmt]
+		}
+		for _, s := range n.Succs {
+			if s != g.Exit {
+				b.edge(source, b.ids[s.Stmt], EdgeCFG)
+			}
+		}
+	}
+}
+
+// reference records n, the top of the stack, if it refers to a variable
+func (b *builder) reference(n ast.Expr, stack []ast.Node) {
+	parent := stack[len(stack)-2]
+	if sel, ok := parent.(*ast.SelectorExpr); ok && sel.Sel == n {
+		// The field name is part of the selector's reference
+		return
+	}
+	key := refKey(n)
+	if key == "" {
+		return
+	}
+
+	r := &ref{node: n, key: key, use: true}
+	switch p := parent.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range p.Lhs {
+			if lhs == n {
+				r.def = true
+				r.use = p.Tok != token.ASSIGN && p.Tok != token.DEFINE
+			}
+		}
+	case *ast.IncDecStmt:
+		r.def = true
+	case *ast.RangeStmt:
+		if p.Key == n || p.Value == n {
+			r.def, r.use = true, false
+		}
+	case *ast.ValueSpec:
+		for _, name := range p.Names {
+			if name == n {
+				r.def, r.use = true, false
+			}
+		}
+	case *ast.Field:
+		// Parameters and results are defined at entry; struct fields are not variables
+		if len(stack) < 4 {
+			return
+		}
+		if _, ok := stack[len(stack)-4].(*ast.FuncType); !ok {
+			return
+		}
+		r.def, r.use = true, false
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch s := stack[i].(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			r.fn = s
+		case *ast.CommClause:
+			// The communication of a case is part of the clause's node
+			if r.stmt == s.Comm {
+				r.stmt = s
+			}
+		case *ast.TypeSwitchStmt:
+			if r.stmt == s.Assign {
+				r.stmt = s
+			}
+		case *ast.BlockStmt:
+		case ast.Stmt:
+			if r.stmt == nil {
+				r.stmt = s
+			}
+		}
+		if r.fn != nil {
+			break
+		}
+	}
+	if r.fn == nil {
+		// Package-level declarations have no control flow
+		return
+	}
+	if _, ok := parent.(*ast.Field); ok {
+		r.stmt = nil
+	}
+	b.refs = append(b.refs, r)
+}
+
+// refKey identifies the variable an identifier or selector refers to: the
+// declaration of a resolved identifier, or its name, followed by the
+// selected fields. It returns "" for names that are not variables.
+func refKey(n ast.Expr) string {
+	switch n := n.(type) {
+	case *ast.Ident:
+		if n.Name == "_" {
+			return ""
+		}
+		if n.Obj == nil {
+			return n.Name
+		}
+		if n.Obj.Kind != ast.Var {
+			return ""
+		}
+		return fmt.Sprintf("%s@%d", n.Name, n.Obj.Pos())
+	case *ast.SelectorExpr:
+		root := n.X
+		for {
+			if sel, ok := root.(*ast.SelectorExpr); ok {
+				root = sel.X
+				continue
+			}
+			break
+		}
+		id, ok := root.(*ast.Ident)
+		if !ok {
+			return ""
+		}
+		key := refKey(id)
+		if key == "" {
+			return ""
+		}
+		return key + strings.TrimPrefix(types.ExprString(n), id.Name)
+	}
+	return ""
+}
+
+// defUseEdges links each definition to the uses of the same variable that
+// control may reach from it. Definitions and uses in different functions,
+// such as a variable captured by a closure, are always linked; definitions
+// are not killed by later assignments.
+func (b *builder) defUseEdges() {
+	for _, d := range b.refs {
+		if !d.def {
+			continue
+		}
+		for _, u := range b.refs {
+			if !u.use || u.key != d.key || u.node == d.node {
+				continue
+			}
+			if g := b.graphs[d.fn]; u.fn == d.fn && d.stmt != nil && !g.Reaches(g.Node(d.stmt), g.Node(u.stmt)) {
+				continue
+			}
+			b.edge(b.ids[d.node], b.ids[u.node], EdgeDefUse)
+		}
+	}
+}
+
+// spawnEdges links go statements to the function literal or the function
+// declared in the file they run, and spawner calls such as errgroup Go to
+// the function literals they are passed
+func (b *builder) spawnEdges(file *ast.File) {
+	funcs := make(map[string]*ast.FuncDecl)
+	methods := make(map[string]*ast.FuncDecl)
+	for _, d := range file.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok {
+			if fd.Recv == nil {
+				funcs[fd.Name.Name] = fd
+			} else {
+				methods[fd.Name.Name] = fd
+			}
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			switch fun := n.Call.Fun.(type) {
+			case *ast.FuncLit:
+				b.edge(b.ids[n], b.ids[fun], EdgeSpawn)
+			case *ast.Ident:
+				if fd, ok := funcs[fun.Name]; ok {
+					b.edge(b.ids[n], b.ids[fd], EdgeSpawn)
+				}
+			case *ast.SelectorExpr:
+				if fd, ok := methods[fun.Sel.Name]; ok {
+					b.edge(b.ids[n], b.ids[fd], EdgeSpawn)
+				}
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || (sel.Sel.Name != "Go" && sel.Sel.Name != "TryGo") {
+				return true
+			}
+			for _, arg := range n.Args {
+				if lit, ok := arg.(*ast.FuncLit); ok {
+					b.edge(b.ids[n], b.ids[lit], EdgeSpawn)
+				}
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,311 @@
+package cpg
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"go/parser"
+	"go/token"
+	"io"
+	"strings"
+	"testing"
+)
+
+// edges returns the edges of a kind as "source -> target", each node given
+// by the first line of its text
+func edges(g *Graph, src, kind string) []string {
+	text := func(id int) string {
+		n := g.Nodes[id]
+		return strings.SplitN(src[n.Offset:n.End], "\n", 2)[0]
+	}
+	var out []string
+	for _, e := range g.Edges {
+		if e.Kind == kind {
+			out = append(out, text(e.Source)+" -> "+text(e.Target))
+		}
+	}
+	return out
+}
+
+func build(t *testing.T, src string) *Graph {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "write1.go", src, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	return Build(fset, file)
+}
+
+func TestBuildEdges(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		kind    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "if and loop flow",
+			src: `package skeleton
+
+func func1(v0 []int) {
+	v1 := 0
+	for v2 := range v0 {
+		if v2 > 0 {
+			continue
+		}
+		v1++
+	}
+	return
+}`,
+			kind: EdgeCFG,
+			want: []string{
+				"func func1(v0 []int) { -> v1 := 0",
+				"v1 := 0 -> for v2 := range v0 {",
+				"for v2 := range v0 { -> if v2 > 0 {",
+				"if v2 > 0 { -> continue",
+				"continue -> for v2 := range v0 {",
+				"if v2 > 0 { -> v1++",
+				"v1++ -> for v2 := range v0 {",
+				"for v2 := range v0 { -> return",
+			},
+			notWant: []string{"continue -> v1++"},
+		},
+		{
+			name: "switch break and select",
+			src: `package skeleton
+
+func func1(v0 int, v1 chan int) {
+	switch v0 {
+	case 1:
+		break
+	default:
+		v0 = 2
+	}
+	select {
+	case v2 := <-v1:
+		v0 = v2
+	}
+	v0 = 3
+}`,
+			kind: EdgeCFG,
+			want: []string{
+				"switch v0 { -> case 1:",
+				"case 1: -> break",
+				"break -> select {",
+				"default: -> v0 = 2",
+				"v0 = 2 -> select {",
+				"case v2 := <-v1: -> v0 = v2",
+				"v0 = v2 -> v0 = 3",
+			},
+			notWant: []string{"switch v0 { -> select {", "select { -> v0 = 3"},
+		},
+		{
+			name: "def-use",
+			src: `package skeleton
+
+func func1(v0 int) int {
+	v1 := v0
+	if v1 > 0 {
+		v1 = 2
+	}
+	v2 := v1
+	return v2
+}`,
+			kind: EdgeDefUse,
+			want: []string{
+				"v0 -> v0",
+				"v1 -> v1",
+				"v2 -> v2",
+			},
+		},
+		{
+			name: "closure capture",
+			src: `package skeleton
+
+func func1() {
+	racyVar0 := 0
+	go func() {
+		racyVar0 = 1
+	}()
+	v1 := racyVar0
+	_ = v1
+}`,
+			kind: EdgeDefUse,
+			want: []string{"racyVar0 -> racyVar0"},
+		},
+		{
+			name: "spawns",
+			src: `package skeleton
+
+func func1(v0 *type0) {
+	go func2()
+	go v0.func3()
+	Wrapper0.Go(func() error {
+		return nil
+	})
+	go func() {
+	}()
+}
+
+func func2() {
+}
+
+func (v1 *type0) func3() {
+}`,
+			kind: EdgeSpawn,
+			want: []string{
+				"go func2() -> func func2() {",
+				"go v0.func3() -> func (v1 *type0) func3() {",
+				"Wrapper0.Go(func() error { -> func() error {",
+				"go func() { -> func() {",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := edges(build(t, tt.src), tt.src, tt.kind)
+			for _, want := range tt.want {
+				if !contains(got, want) {
+					t.Errorf("Missing %s edge %q in %q", tt.kind, want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if contains(got, notWant) {
+					t.Errorf("Unexpected %s edge %q", tt.kind, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildDefUseReach(t *testing.T) {
+	src := `package skeleton
+
+func func1() int {
+	v0 := 1
+	v1 := v0
+	v0 = 2
+	return v1
+}`
+	g := build(t, src)
+	// The second assignment of v0 comes after its only use
+	var defs []int
+	for _, n := range g.Nodes {
+		if n.Label == "v0" {
+			defs = append(defs, n.ID)
+		}
+	}
+	if len(defs) != 3 {
+		t.Fatalf("Got %d v0 nodes, want 3", len(defs))
+	}
+	for _, e := range g.Edges {
+		if e.Kind == EdgeDefUse && e.Source == defs[2] {
+			t.Errorf("Unexpected def-use edge from the last assignment to node %d", e.Target)
+		}
+	}
+}
+
+func TestBuildRacy(t *testing.T) {
+	g, err := File("testdata/D10447847/read1.go")
+	if err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+	var got []string
+	for _, n := range g.Nodes {
+		if n.Racy {
+			got = append(got, n.Label+" "+n.Access)
+		}
+	}
+	// The declaration is racy but is not an access
+	want := []string{"racyVar0 ", "racyVar0 write", "racyVar0 read", "racyVar0 read"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Racy nodes = %q, want %q", got, want)
+	}
+	if g.Nodes[0].Kind != "File" {
+		t.Errorf("Root kind = %q, want File", g.Nodes[0].Kind)
+	}
+}
+
+func TestDir(t *testing.T) {
+	graphs, err := Dir("testdata")
+	if err != nil {
+		t.Fatalf("Dir failed: %v", err)
+	}
+	if len(graphs) != 3 {
+		t.Fatalf("Got %d graphs, want 3", len(graphs))
+	}
+	for _, g := range graphs {
+		if g.Case == "D3" {
+			if g.Error == "" || len(g.Nodes) != 0 {
+				t.Errorf("Expected an empty graph with an error for D3, got %d nodes", len(g.Nodes))
+			}
+			continue
+		}
+		if g.Error != "" || len(g.Nodes) == 0 {
+			t.Errorf("Graph of %s/%s: error %q, %d nodes", g.Case, g.File, g.Error, len(g.Nodes))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, graphs); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(graphs) {
+		t.Fatalf("Got %d lines, want %d", len(lines), len(graphs))
+	}
+	var g Graph
+	if err := json.Unmarshal([]byte(lines[0]), &g); err != nil {
+		t.Fatalf("Invalid JSON line: %v", err)
+	}
+	if g.Case != graphs[0].Case || len(g.Edges) != len(graphs[0].Edges) {
+		t.Errorf("Decoded graph %s with %d edges, want %s with %d", g.Case, len(g.Edges), graphs[0].Case, len(graphs[0].Edges))
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	graphs, err := Dir("testdata")
+	if err != nil {
+		t.Fatalf("Dir failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := WriteGraphML(&buf, graphs); err != nil {
+		t.Fatalf("WriteGraphML failed: %v", err)
+	}
+
+	dec := xml.NewDecoder(&buf)
+	counts := make(map[string]int)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Invalid GraphML: %v", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			counts[start.Name.Local]++
+		}
+	}
+	nodes, links := 0, 0
+	for _, g := range graphs {
+		nodes += len(g.Nodes)
+		links += len(g.Edges)
+	}
+	if counts["graph"] != len(graphs) || counts["node"] != nodes || counts["edge"] != links {
+		t.Errorf("Got %d graphs, %d nodes and %d edges, want %d, %d and %d",
+			counts["graph"], counts["node"], counts["edge"], len(graphs), nodes, links)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
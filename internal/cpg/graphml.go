@@ -0,0 +1,107 @@
+package cpg
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteJSON writes one graph per line
+func WriteJSON(w io.Writer, graphs []*Graph) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, g := range graphs {
+		if err := enc.Encode(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// graphMLKeys are the attributes of nodes and edges, in the order they are
+// declared and written
+var graphMLKeys = []struct {
+	id, target, name, typ string
+}{
+	{"kind", "node", "kind", "string"},
+	{"label", "node", "label", "string"},
+	{"line", "node", "line", "int"},
+	{"column", "node", "column", "int"},
+	{"offset", "node", "offset", "int"},
+	{"end", "node", "end", "int"},
+	{"racy", "node", "racy", "boolean"},
+	{"access", "node", "access", "string"},
+	{"ekind", "edge", "kind", "string"},
+}
+
+// WriteGraphML writes the graphs as one GraphML document, with a graph per
+// file identified by its case and file name. Files that did not parse are
+// written as empty graphs.
+func WriteGraphML(w io.Writer, graphs []*Graph) error {
+	ew := &errWriter{w: w}
+	ew.printf("%s", xml.Header)
+	ew.printf("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	for _, k := range graphMLKeys {
+		ew.printf("  <key id=%q for=%q attr.name=%q attr.type=%q/>\n", k.id, k.target, k.name, k.typ)
+	}
+	for _, g := range graphs {
+		id := g.File
+		if g.Case != "" {
+			id = g.Case + "/" + g.File
+		}
+		ew.printf("  <graph id=\"%s\" edgedefault=\"directed\">\n", escape(id))
+		for _, n := range g.Nodes {
+			ew.printf("    <node id=\"n%d\">\n", n.ID)
+			ew.data("kind", n.Kind)
+			if n.Label != "" {
+				ew.data("label", n.Label)
+			}
+			ew.data("line", strconv.Itoa(n.Line))
+			ew.data("column", strconv.Itoa(n.Column))
+			ew.data("offset", strconv.Itoa(n.Offset))
+			ew.data("end", strconv.Itoa(n.End))
+			if n.Racy {
+				ew.data("racy", "true")
+			}
+			if n.Access != "" {
+				ew.data("access", n.Access)
+			}
+			ew.printf("    </node>\n")
+		}
+		for _, e := range g.Edges {
+			ew.printf("    <edge source=\"n%d\" target=\"n%d\">\n", e.Source, e.Target)
+			ew.data("ekind", e.Kind)
+			ew.printf("    </edge>\n")
+		}
+		ew.printf("  </graph>\n")
+	}
+	ew.printf("</graphml>\n")
+	return ew.err
+}
+
+// errWriter keeps the first write error so that a document can be written
+// without checking every line
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+func (ew *errWriter) data(key, value string) {
+	ew.printf("      <data key=\"%s\">%s</data>\n", key, escape(value))
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	// Writing to a strings.Builder cannot fail
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,5 @@
+package skeleton
+
+func func1() {
+	racyVar0 = 
+}
@@ -0,0 +1,189 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/uber/data-race-skeletons/internal/analyzer"
+	"github.com/uber/data-race-skeletons/internal/corpus"
+	"github.com/uber/data-race-skeletons/internal/patterns"
+	"github.com/uber/data-race-skeletons/internal/skeletonizer"
+	"github.com/uber/data-race-skeletons/internal/split"
+	"github.com/uber/data-race-skeletons/internal/stats"
+)
+
+// Text modes of the exported files
+const (
+	Raw       = "raw"
+	Canonical = "canonical"
+)
+
+// Options controls what is exported
+type Options struct {
+	// Canonical exports the files with their placeholders renumbered in
+	// order of first occurrence, shared by the files of a case, instead of
+	// their text as found in the dataset
+	Canonical bool
+	// Class replaces the placeholders of token streams by their class, such
+	// as v for v12, so that the vocabulary does not depend on numbering
+	Class bool
+}
+
+// Record is the exported form of a case, one JSON line
+type Record struct {
+	Case     string `json:"case"`
+	RaceType string `json:"race_type"`
+	Text     string `json:"text"` // raw or canonical
+	// RacyVars are the racy variables of the case, as named in the exported text
+	RacyVars []string `json:"racy_vars"`
+	Patterns []Label  `json:"patterns"`
+	Files    []File   `json:"files"`
+}
+
+// Label is a race pattern with the highest confidence of the files of a case
+type Label struct {
+	Pattern    string  `json:"pattern"`
+	Confidence float64 `json:"confidence"`
+}
+
+// File is an exported skeleton file. Positions of accesses and pattern
+// evidence refer to Text.
+type File struct {
+	Name     string            `json:"name"`
+	Role     string            `json:"role"`
+	Text     string            `json:"text"`
+	Accesses []analyzer.Access `json:"accesses"`
+	Patterns []patterns.Match  `json:"patterns"`
+	Stats    Stats             `json:"stats"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Stats are the concurrency statistics of a file
+type Stats struct {
+	stats.Counts
+	GoroutineDepth int `json:"goroutine_depth"`
+	Lines          int `json:"lines"`
+	Bytes          int `json:"bytes"`
+}
+
+// Dir exports the skeleton cases found in dir
+func Dir(dir string, opts Options) ([]Record, error) {
+	cases, err := corpus.FindCases(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no skeletons found in %s", dir)
+	}
+	var records []Record
+	for _, c := range cases {
+		r, err := Case(c, opts)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Case exports a case. Files that cannot be canonicalized are exported raw,
+// and files that do not parse have no accesses, patterns or counts; both
+// carry an error.
+func Case(c corpus.Case, opts Options) (Record, error) {
+	r := Record{Case: c.Name, RaceType: split.RaceType(c.Files), Text: Raw, RacyVars: []string{}, Patterns: []Label{}}
+	if opts.Canonical {
+		r.Text = Canonical
+	}
+	sources, err := readSources(c, opts)
+	if err != nil {
+		return Record{}, err
+	}
+	racy := make(map[string]bool)
+	var lists [][]patterns.Match
+	for _, s := range sources {
+		src := s.src
+		f := File{Name: s.name, Role: s.role, Text: string(src), Accesses: []analyzer.Access{}, Patterns: []patterns.Match{}, Error: s.err}
+		fs := stats.File(f.Name, src)
+		f.Stats = Stats{Counts: fs.Counts, GoroutineDepth: fs.GoroutineDepth, Lines: fs.Lines, Bytes: fs.Bytes}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, f.Name, src, 0)
+		if err != nil {
+			if f.Error == "" {
+				f.Error = fmt.Sprintf("error parsing file: %v", err)
+			}
+			r.Files = append(r.Files, f)
+			continue
+		}
+		f.Accesses = append(f.Accesses, analyzer.Accesses(fset, file)...)
+		for _, a := range f.Accesses {
+			racy[a.Var] = true
+		}
+		for _, name := range fs.RacyVars {
+			racy[name] = true
+		}
+		f.Patterns = append(f.Patterns, patterns.File(fset, file, src)...)
+		lists = append(lists, f.Patterns)
+		r.Files = append(r.Files, f)
+	}
+
+	for name := range racy {
+		r.RacyVars = append(r.RacyVars, name)
+	}
+	sort.Strings(r.RacyVars)
+	for _, match := range patterns.Merge(lists...) {
+		r.Patterns = append(r.Patterns, Label{Pattern: match.Pattern, Confidence: match.Confidence})
+	}
+	return r, nil
+}
+
+// source is a file of a case in the text mode being exported
+type source struct {
+	name, role string
+	src        []byte
+	err        string // Why the file could not be canonicalized
+}
+
+// readSources reads the files of a case, canonicalizing them with a mapping
+// shared by the case if requested
+func readSources(c corpus.Case, opts Options) ([]source, error) {
+	m := skeletonizer.NewMapping()
+	var sources []source
+	for _, filename := range c.Files {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		s := source{name: filepath.Base(filename), role: split.Role(filename), src: src}
+		if opts.Canonical {
+			if text, err := skeletonizer.Canonicalize(src, m); err != nil {
+				s.err = err.Error()
+			} else {
+				s.src = text
+			}
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// WriteJSONL writes one record per line
+func WriteJSONL(w io.Writer, records []Record) error {
+	return writeLines(w, len(records), func(i int) interface{} { return records[i] })
+}
+
+func writeLines(w io.Writer, n int, record func(int) interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for i := 0; i < n; i++ {
+		if err := enc.Encode(record(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uber/data-race-skeletons/internal/corpus"
+)
+
+func TestCase(t *testing.T) {
+	tests := []struct {
+		name         string
+		dir          string
+		opts         Options
+		wantRaceType string
+		wantPattern  string
+		wantAccesses []string
+		wantText     string
+		wantErr      bool
+	}{
+		{
+			name:         "raw errgroup",
+			dir:          "testdata/D10447847",
+			wantRaceType: "read-write",
+			wantPattern:  "errgroup-shared-err",
+			wantAccesses: []string{"racyVar0 write", "racyVar0 read", "racyVar0 read"},
+			wantText:     "func (v1 *type0) func1(v6 pkg5.v9",
+		},
+		{
+			name:         "canonical errgroup",
+			dir:          "testdata/D10447847",
+			opts:         Options{Canonical: true},
+			wantRaceType: "read-write",
+			wantPattern:  "errgroup-shared-err",
+			wantAccesses: []string{"racyVar0 write", "racyVar0 read", "racyVar0 read"},
+			wantText:     "func (v0 *type0) func1(v2 pkg0.v3",
+		},
+		{
+			name:         "map insertion",
+			dir:          "testdata/D6645345",
+			wantRaceType: "write-write",
+			wantPattern:  "concurrent-map-write",
+			wantAccesses: []string{"racyVar0 write"},
+		},
+		{
+			name:         "parse error",
+			dir:          "testdata/D3",
+			wantRaceType: "write-write",
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cases, err := corpus.FindCases(tt.dir)
+			if err != nil || len(cases) != 1 {
+				t.Fatalf("FindCases() = %v, %v", cases, err)
+			}
+			r, err := Case(cases[0], tt.opts)
+			if err != nil {
+				t.Fatalf("Case() error = %v", err)
+			}
+			if r.RaceType != tt.wantRaceType {
+				t.Errorf("RaceType = %s, want %s", r.RaceType, tt.wantRaceType)
+			}
+			if tt.wantPattern != "" && (len(r.Patterns) == 0 || r.Patterns[0].Pattern != tt.wantPattern) {
+				t.Errorf("Patterns = %v, want %s first", r.Patterns, tt.wantPattern)
+			}
+			for _, f := range r.Files {
+				if (f.Error != "") != tt.wantErr {
+					t.Errorf("%s error = %q, wantErr %v", f.Name, f.Error, tt.wantErr)
+				}
+				if !strings.Contains(f.Text, tt.wantText) {
+					t.Errorf("%s text missing %q:\n%s", f.Name, tt.wantText, f.Text)
+				}
+				if tt.wantErr {
+					continue
+				}
+				var got []string
+				for _, a := range f.Accesses {
+					if f.Text[a.Offset:a.End] != a.Var {
+						t.Errorf("%s access %v spans %q", f.Name, a, f.Text[a.Offset:a.End])
+					}
+					got = append(got, a.Var+" "+a.Kind)
+				}
+				if strings.Join(got, ",") != strings.Join(tt.wantAccesses, ",") {
+					t.Errorf("%s accesses = %v, want %v", f.Name, got, tt.wantAccesses)
+				}
+				if f.Role == "" {
+					t.Errorf("%s has no role", f.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	records, err := Dir("testdata", Options{})
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	var b bytes.Buffer
+	if err := WriteJSONL(&b, records); err != nil {
+		t.Fatalf("WriteJSONL() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("WriteJSONL() wrote %d lines, want 3", len(lines))
+	}
+	var r Record
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if r.Case != "D10447847" || len(r.Files) != 2 || strings.Join(r.RacyVars, ",") != "racyVar0" {
+		t.Errorf("first record = %+v", r)
+	}
+	if !strings.Contains(lines[0], `"go_statements":0`) || !strings.Contains(lines[0], `"text":"raw"`) {
+		t.Errorf("record missing statistics or text mode: %.300s", lines[0])
+	}
+}
+
+func TestTokens(t *testing.T) {
+	dir := t.TempDir()
+	src := "package skeleton\n\nfunc (v1 *type0) func1() {\n\tv1.racyVar0 = v2 // comment\n\tpkg0.Func3(\"StringConst0\", racyVar1)\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "write1.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := corpus.Case{Name: "D1", Files: []string{filepath.Join(dir, "write1.go")}}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			name: "exact",
+			want: "v1/B-WRITE ./I-WRITE racyVar0/I-WRITE =/O v2/O pkg0/O ./O Func3/O (/O \"StringConst0\"/O ,/O racyVar1/B-READ )/O",
+		},
+		{
+			name: "class",
+			opts: Options{Class: true},
+			want: "v/B-WRITE ./I-WRITE racyVar/I-WRITE =/O v/O pkg/O ./O Func/O (/O \"StringConst\"/O ,/O racyVar/B-READ )/O",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := Tokens(c, tt.opts)
+			if err != nil {
+				t.Fatalf("Tokens() error = %v", err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("Tokens() = %d records, want 1", len(records))
+			}
+			r := records[0]
+			if len(r.Tags) != len(r.Tokens) || len(r.Offsets) != len(r.Tokens) || len(r.Lines) != len(r.Tokens) {
+				t.Fatalf("Tokens() arrays differ in length: %+v", r)
+			}
+			var got []string
+			for i, tok := range r.Tokens {
+				if r.Lines[i] >= 4 && r.Lines[i] <= 5 {
+					got = append(got, tok+"/"+r.Tags[i])
+				}
+				if !tt.opts.Class && src[r.Offsets[i]:r.Offsets[i]+len(tok)] != tok {
+					t.Errorf("token %q at offset %d is %q in the source", tok, r.Offsets[i], src[r.Offsets[i]:r.Offsets[i]+len(tok)])
+				}
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("Tokens() =\n%s\nwant\n%s", strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+}
+
+func TestTokensParseError(t *testing.T) {
+	records, err := TokensDir("testdata/D3", Options{})
+	if err != nil {
+		t.Fatalf("TokensDir() error = %v", err)
+	}
+	if len(records) != 1 || records[0].Error == "" {
+		t.Fatalf("TokensDir() = %+v, want one record with an error", records)
+	}
+	for _, tag := range records[0].Tags {
+		if tag != TagOutside {
+			t.Errorf("tag %s in a file that does not parse", tag)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package export
+
+import (
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"strconv"
+
+	"github.com/uber/data-race-skeletons/internal/analyzer"
+	"github.com/uber/data-race-skeletons/internal/corpus"
+	"github.com/uber/data-race-skeletons/internal/skeletonizer"
+	"github.com/uber/data-race-skeletons/internal/split"
+)
+
+// Vocabularies of the token streams
+const (
+	Exact = "exact"
+	Class = "class"
+)
+
+// Tags of the BIO scheme: the first token of a racy access is tagged B-, its
+// other tokens I-, and tokens outside accesses O
+const (
+	TagOutside     = "O"
+	TagBeginRead   = "B-READ"
+	TagInsideRead  = "I-READ"
+	TagBeginWrite  = "B-WRITE"
+	TagInsideWrite = "I-WRITE"
+)
+
+// TokenRecord is a skeleton file as a labeled token stream, one JSON line.
+// Tokens, Tags and the positions are parallel; positions refer to the raw or
+// canonical text the tokens were scanned from.
+type TokenRecord struct {
+	Case     string   `json:"case"`
+	File     string   `json:"file"`
+	Role     string   `json:"role"`
+	RaceType string   `json:"race_type"`
+	Text     string   `json:"text"`  // raw or canonical
+	Vocab    string   `json:"vocab"` // exact or class
+	Tokens   []string `json:"tokens"`
+	Tags     []string `json:"tags"`
+	Lines    []int    `json:"lines"`
+	Columns  []int    `json:"columns"`
+	Offsets  []int    `json:"offsets"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// TokensDir exports the files of the skeleton cases found in dir as token streams
+func TokensDir(dir string, opts Options) ([]TokenRecord, error) {
+	cases, err := corpus.FindCases(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no skeletons found in %s", dir)
+	}
+	var records []TokenRecord
+	for _, c := range cases {
+		rs, err := Tokens(c, opts)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rs...)
+	}
+	return records, nil
+}
+
+// Tokens exports the files of a case as go/scanner token streams, without
+// comments and the semicolons the scanner inserts at line ends. Tokens of the
+// expressions the analyzer reports as racy accesses are tagged. Files that do
+// not parse are exported with all tokens outside and an error.
+func Tokens(c corpus.Case, opts Options) ([]TokenRecord, error) {
+	sources, err := readSources(c, opts)
+	if err != nil {
+		return nil, err
+	}
+	var records []TokenRecord
+	for _, s := range sources {
+		r := TokenRecord{
+			Case:     c.Name,
+			File:     s.name,
+			Role:     s.role,
+			RaceType: split.RaceType(c.Files),
+			Text:     Raw,
+			Vocab:    Exact,
+			Tokens:   []string{},
+			Tags:     []string{},
+			Lines:    []int{},
+			Columns:  []int{},
+			Offsets:  []int{},
+			Error:    s.err,
+		}
+		if opts.Canonical {
+			r.Text = Canonical
+		}
+		if opts.Class {
+			r.Vocab = Class
+		}
+
+		var accesses []analyzer.Access
+		fset := token.NewFileSet()
+		if file, err := parser.ParseFile(fset, s.name, s.src, 0); err != nil {
+			if r.Error == "" {
+				r.Error = fmt.Sprintf("error parsing file: %v", err)
+			}
+		} else {
+			accesses = analyzer.Accesses(fset, file)
+		}
+
+		fset = token.NewFileSet()
+		file := fset.AddFile(s.name, fset.Base(), len(s.src))
+		var sc scanner.Scanner
+		sc.Init(file, s.src, nil, 0)
+		for {
+			pos, tok, lit := sc.Scan()
+			if tok == token.EOF {
+				break
+			}
+			if tok == token.SEMICOLON && lit == "\n" {
+				continue
+			}
+			if lit == "" {
+				lit = tok.String()
+			}
+			if opts.Class {
+				lit = class(tok, lit)
+			}
+			p := fset.Position(pos)
+			r.Tokens = append(r.Tokens, lit)
+			r.Tags = append(r.Tags, tag(accesses, p.Offset))
+			r.Lines = append(r.Lines, p.Line)
+			r.Columns = append(r.Columns, p.Column)
+			r.Offsets = append(r.Offsets, p.Offset)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// WriteTokensJSONL writes one token record per line
+func WriteTokensJSONL(w io.Writer, records []TokenRecord) error {
+	return writeLines(w, len(records), func(i int) interface{} { return records[i] })
+}
+
+// tag returns the tag of the token starting at offset
+func tag(accesses []analyzer.Access, offset int) string {
+	for _, a := range accesses {
+		if offset < a.ExprOffset || offset >= a.ExprEnd {
+			continue
+		}
+		begin := offset == a.ExprOffset
+		switch {
+		case a.Kind == analyzer.Write && begin:
+			return TagBeginWrite
+		case a.Kind == analyzer.Write:
+			return TagInsideWrite
+		case begin:
+			return TagBeginRead
+		default:
+			return TagInsideRead
+		}
+	}
+	return TagOutside
+}
+
+// class returns the class of a placeholder token, quoted for string
+// placeholders, or the token itself
+func class(tok token.Token, lit string) string {
+	switch tok {
+	case token.IDENT:
+		if c := skeletonizer.PlaceholderClass(lit); c != "" {
+			return c
+		}
+	case token.STRING:
+		if skeletonizer.IsStringPlaceholder(lit) {
+			name, _ := strconv.Unquote(lit)
+			return strconv.Quote(skeletonizer.PlaceholderClass(name))
+		}
+	}
+	return lit
+}
@@ -0,0 +1,217 @@
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TestFile is the test the harness adds to the module
+	TestFile = "race_test.go"
+	// blockedMessage is logged when the sides do not return, which is common in
+	// skeletons waiting on channels nothing sends to. Races are still reported.
+	blockedMessage = "harness: sides did not return"
+	waitSeconds    = 5
+	fieldDepth     = 3
+	sliceLen       = 2
+)
+
+// driver generates the test that runs the sides at the same time. Arguments of
+// the same type, receivers included, are shared so that both sides reach the
+// same variables.
+func driver(pkg *types.Package, sides []side) ([]byte, []string, error) {
+	d := &driverGen{
+		pkg:     pkg,
+		imports: map[string]string{"sync": "sync", "testing": "testing", "time": "time"},
+		shared:  make(map[string]string),
+	}
+	var calls []string
+	for _, s := range sides {
+		call, err := d.call(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		calls = append(calls, call)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "package %s\n\nimport (\n", pkg.Name())
+	var paths []string
+	for path := range d.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%q\n", path)
+	}
+	b.WriteString(")\n\n")
+	b.WriteString("// TestRace runs both sides of the race at the same time on shared arguments\n")
+	b.WriteString("func TestRace(t *testing.T) {\n")
+	b.WriteString(d.decls.String())
+	fmt.Fprintf(&b, "var wg sync.WaitGroup\nwg.Add(%d)\n", len(calls))
+	for _, call := range calls {
+		fmt.Fprintf(&b, "go func() {\ndefer wg.Done()\ndefer func() { _ = recover() }()\n%s\n}()\n", call)
+	}
+	b.WriteString("done := make(chan struct{})\ngo func() {\nwg.Wait()\nclose(done)\n}()\n")
+	fmt.Fprintf(&b, "select {\ncase <-done:\ncase <-time.After(%d * time.Second):\nt.Log(%q)\n}\n}\n", waitSeconds, blockedMessage)
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error formatting %s: %v", TestFile, err)
+	}
+	var names []string
+	for _, s := range sides {
+		names = append(names, s.String())
+	}
+	return src, names, nil
+}
+
+type driverGen struct {
+	pkg     *types.Package
+	imports map[string]string // Path to name
+	shared  map[string]string // Type to the variable holding it
+	decls   bytes.Buffer
+}
+
+// call returns the statement that runs a side
+func (d *driverGen) call(s side) (string, error) {
+	var fn *types.Func
+	if s.recv == nil {
+		fn, _ = d.pkg.Scope().Lookup(s.name.Name).(*types.Func)
+	} else if tn, ok := d.pkg.Scope().Lookup(s.recv.Name).(*types.TypeName); ok {
+		obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(tn.Type()), true, d.pkg, s.name.Name)
+		fn, _ = obj.(*types.Func)
+	}
+	if fn == nil {
+		return "", fmt.Errorf("%s: not found in the module", s)
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.TypeParams().Len() > 0 || sig.RecvTypeParams().Len() > 0 {
+		return "", fmt.Errorf("%s: generic functions are not supported", s)
+	}
+
+	call := fn.Name()
+	if sig.Recv() != nil {
+		call = d.arg(sig.Recv().Type()) + "." + call
+	}
+	var args []string
+	for i := 0; i < sig.Params().Len(); i++ {
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			break
+		}
+		args = append(args, d.arg(sig.Params().At(i).Type()))
+	}
+	return call + "(" + strings.Join(args, ", ") + ")", nil
+}
+
+// arg returns the variable holding the shared argument of type t, declaring it on first use
+func (d *driverGen) arg(t types.Type) string {
+	typ := d.typeString(t)
+	if name, ok := d.shared[typ]; ok {
+		return name
+	}
+	name := "a" + strconv.Itoa(len(d.shared))
+	d.shared[typ] = name
+	fmt.Fprintf(&d.decls, "%s := %s\n", name, d.value(t))
+	return name
+}
+
+// value returns an expression for a usable value of type t: pointers, maps,
+// channels and slices are allocated so that the sides share what they point to
+func (d *driverGen) value(t types.Type) string {
+	typ := d.typeString(t)
+	if typ == "context.Context" {
+		return "context.Background()"
+	}
+	if p, ok := t.(*types.Pointer); ok {
+		if lit := d.structLit(p.Elem(), fieldDepth); lit != "" {
+			return "&" + lit
+		}
+		return "new(" + d.typeString(p.Elem()) + ")"
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Map:
+		return "make(" + typ + ")"
+	case *types.Chan:
+		return "make(" + typ + ", 1)"
+	case *types.Slice:
+		return "make(" + typ + ", " + strconv.Itoa(sliceLen) + ")"
+	case *types.Signature:
+		lit := d.funcLit(u)
+		if _, ok := t.(*types.Named); ok {
+			return typ + "(" + lit + ")"
+		}
+		return lit
+	}
+	return "*new(" + typ + ")"
+}
+
+// structLit returns a literal of a struct type declared in the module whose
+// pointer, map and channel fields are allocated, or "" if there is none
+func (d *driverGen) structLit(t types.Type, depth int) string {
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() != d.pkg || depth == 0 {
+		return ""
+	}
+	st, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return ""
+	}
+	var fields []string
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		var v string
+		switch u := f.Type().Underlying().(type) {
+		case *types.Pointer:
+			if lit := d.structLit(u.Elem(), depth-1); lit != "" {
+				v = "&" + lit
+			} else if _, ok := f.Type().(*types.Pointer); ok {
+				v = "new(" + d.typeString(u.Elem()) + ")"
+			}
+		case *types.Map:
+			v = "make(" + d.typeString(f.Type()) + ")"
+		case *types.Chan:
+			v = "make(" + d.typeString(f.Type()) + ", 1)"
+		}
+		if v != "" {
+			fields = append(fields, f.Name()+": "+v)
+		}
+	}
+	return d.typeString(t) + "{" + strings.Join(fields, ", ") + "}"
+}
+
+// funcLit returns a function literal of type sig that returns zero values
+func (d *driverGen) funcLit(sig *types.Signature) string {
+	var params, results []string
+	for i := 0; i < sig.Params().Len(); i++ {
+		t := sig.Params().At(i).Type()
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			params = append(params, "..."+d.typeString(t.(*types.Slice).Elem()))
+			continue
+		}
+		params = append(params, d.typeString(t))
+	}
+	for i := 0; i < sig.Results().Len(); i++ {
+		results = append(results, "r"+strconv.Itoa(i)+" "+d.typeString(sig.Results().At(i).Type()))
+	}
+	lit := "func(" + strings.Join(params, ", ") + ")"
+	if len(results) > 0 {
+		return lit + " (" + strings.Join(results, ", ") + ") { return }"
+	}
+	return lit + " {}"
+}
+
+func (d *driverGen) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == d.pkg {
+			return ""
+		}
+		d.imports[p.Path()] = p.Name()
+		return p.Name()
+	})
+}
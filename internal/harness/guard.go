@@ -0,0 +1,51 @@
+package harness
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"github.com/uber/data-race-skeletons/internal/stubgen"
+)
+
+// recoverStmt is added to goroutines of the skeleton. Slicing often keeps a
+// WaitGroup's Done but not its Add, and stubs return nil for unknown values;
+// an unrecovered panic in a goroutine would end the test before the race.
+const recoverStmt = "defer func() { _ = recover() }();"
+
+// guard makes the goroutines a skeleton spawns recover from panics: function
+// literals run by go statements and passed to Go spawner methods
+func guard(src stubgen.Source) (stubgen.Source, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, src.Name, src.Src, parser.ParseComments)
+	if err != nil {
+		return src, fmt.Errorf("error parsing file: %v", err)
+	}
+	var offsets []int
+	add := func(e ast.Expr) {
+		if lit, ok := e.(*ast.FuncLit); ok {
+			offsets = append(offsets, fset.Position(lit.Body.Lbrace).Offset+1)
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			add(n.Call.Fun)
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Go" {
+				for _, arg := range n.Args {
+					add(arg)
+				}
+			}
+		}
+		return true
+	})
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	out := append([]byte(nil), src.Src...)
+	for _, off := range offsets {
+		out = append(out[:off], append([]byte(recoverStmt), out[off:]...)...)
+	}
+	return stubgen.Source{Name: src.Name, Src: out}, nil
+}
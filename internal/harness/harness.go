@@ -0,0 +1,205 @@
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/uber/data-race-skeletons/internal/stubgen"
+)
+
+// Outcomes of a run
+const (
+	OutcomeRace       = "race"        // The race detector reported a data race
+	OutcomeNoRace     = "no-race"     // The test passed without a report
+	OutcomePanic      = "panic"       // The test crashed before a race was reported
+	OutcomeTimeout    = "timeout"     // The test did not finish in time
+	OutcomeBuildError = "build-error" // The module does not compile
+	OutcomeError      = "error"       // The test could not be generated or run
+)
+
+const (
+	raceWarning    = "WARNING: DATA RACE"
+	defaultTimeout = 5 * time.Minute
+	maxOutput      = 4096
+)
+
+// Result is the outcome of running a skeleton pair under the race detector
+type Result struct {
+	Case    string   `json:"case"`
+	Files   []string `json:"files"`
+	Calls   []string `json:"calls,omitempty"`
+	Outcome string   `json:"outcome"`
+	Races   int      `json:"races"`
+	Blocked bool     `json:"blocked"`
+	Dir     string   `json:"dir,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Options configures a run
+type Options struct {
+	// Timeout bounds building and running the test, 5 minutes if zero
+	Timeout time.Duration
+	// Keep leaves the module on disk and records its directory in the result
+	Keep bool
+}
+
+// BuildError is returned when the generated module does not type-check
+type BuildError struct {
+	Errs []error
+}
+
+func (e *BuildError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Generate turns the files of a skeleton pair into a module whose TestRace
+// runs the read and write sides concurrently. It returns the module and the
+// functions each side calls.
+func Generate(srcs []stubgen.Source) (*stubgen.Module, []string, error) {
+	merged, sides, err := merge(srcs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range merged {
+		if merged[i], err = guard(merged[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	m, err := stubgen.Generate(merged, stubgen.Options{Populate: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	pkg, errs := m.Package()
+	if len(errs) > 0 {
+		return nil, nil, &BuildError{Errs: errs}
+	}
+	test, calls, err := driver(pkg, sides)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.Files[TestFile] = test
+	return m, calls, nil
+}
+
+// RunFiles reads the files of a skeleton pair and runs them
+func RunFiles(name string, filenames []string, opts Options) Result {
+	var srcs []stubgen.Source
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return Result{Case: name, Files: filenames, Outcome: OutcomeError, Error: err.Error()}
+		}
+		srcs = append(srcs, stubgen.Source{Name: filepath.Base(filename), Src: src})
+	}
+	return Run(name, srcs, opts)
+}
+
+// Run generates the harness of a skeleton pair in a temporary module and runs
+// it with go test -race
+func Run(name string, srcs []stubgen.Source, opts Options) Result {
+	r := Result{Case: name}
+	for _, src := range srcs {
+		r.Files = append(r.Files, src.Name)
+	}
+	m, calls, err := Generate(srcs)
+	if err != nil {
+		r.Outcome = OutcomeError
+		var buildErr *BuildError
+		if errors.As(err, &buildErr) {
+			r.Outcome = OutcomeBuildError
+		}
+		r.Error = err.Error()
+		return r
+	}
+	r.Calls = calls
+
+	dir, err := os.MkdirTemp("", "harness-")
+	if err != nil {
+		r.Outcome, r.Error = OutcomeError, err.Error()
+		return r
+	}
+	if opts.Keep {
+		r.Dir = dir
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	if err := m.Write(dir); err != nil {
+		r.Outcome, r.Error = OutcomeError, err.Error()
+		return r
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", "test", "-race", "-v", "-count=1", "-run=^TestRace$", "-timeout="+timeout.String(), ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=")
+	output, err := cmd.CombinedOutput()
+	classify(&r, string(output), err, ctx.Err() != nil)
+	return r
+}
+
+// classify sets the outcome of a go test run from its output
+func classify(r *Result, output string, runErr error, expired bool) {
+	r.Races = strings.Count(output, raceWarning)
+	r.Blocked = strings.Contains(output, blockedMessage)
+	switch {
+	case r.Races > 0:
+		r.Outcome = OutcomeRace
+	case expired || strings.Contains(output, "panic: test timed out"):
+		r.Outcome = OutcomeTimeout
+	case strings.Contains(output, "[build failed]") || strings.Contains(output, "[setup failed]"):
+		r.Outcome = OutcomeBuildError
+	case strings.HasPrefix(output, "go: "):
+		// The go command itself failed, for example because the race detector needs cgo
+		r.Outcome = OutcomeError
+	case runErr != nil:
+		r.Outcome = OutcomePanic
+	default:
+		r.Outcome = OutcomeNoRace
+		return
+	}
+	if r.Outcome == OutcomeRace {
+		return
+	}
+	if len(output) > maxOutput {
+		output = "..." + output[len(output)-maxOutput:]
+	}
+	r.Error = strings.TrimSpace(output)
+	if r.Error == "" && runErr != nil {
+		r.Error = runErr.Error()
+	}
+}
+
+// Expected reports whether the outcome matches expecting a race, or expecting
+// none for fixed variants
+func (r Result) Expected(race bool) bool {
+	if race {
+		return r.Outcome == OutcomeRace
+	}
+	return r.Outcome == OutcomeNoRace
+}
+
+func (r Result) String() string {
+	s := fmt.Sprintf("%s: %s", r.Case, r.Outcome)
+	if r.Races > 0 {
+		s += fmt.Sprintf(" (%d reports)", r.Races)
+	}
+	if r.Blocked {
+		s += ", sides blocked"
+	}
+	return s
+}
@@ -0,0 +1,215 @@
+package harness
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uber/data-race-skeletons/internal/corpus"
+	"github.com/uber/data-race-skeletons/internal/stubgen"
+)
+
+func TestMerge(t *testing.T) {
+	read := "package skeleton\n\nfunc (v0 *type0) func1() {\n\t_ = v0.racyVar0\n}\n\nfunc func2() {}\n"
+	tests := []struct {
+		name      string
+		srcs      []stubgen.Source
+		wantFiles int
+		wantCalls []string
+		want      string // Expected in the second file
+		wantErr   bool
+	}{
+		{
+			name:      "single file",
+			srcs:      []stubgen.Source{{Name: "read1.go", Src: []byte(read)}},
+			wantFiles: 1,
+			wantCalls: []string{"read1.go: (type0).func1", "read1.go: (type0).func1"},
+		},
+		{
+			name:      "identical files",
+			srcs:      []stubgen.Source{{Name: "read1.go", Src: []byte(read)}, {Name: "write1.go", Src: []byte(read)}},
+			wantFiles: 1,
+			wantCalls: []string{"read1.go: (type0).func1", "read1.go: (type0).func1"},
+		},
+		{
+			name: "colliding method is renamed",
+			srcs: []stubgen.Source{
+				{Name: "read1.go", Src: []byte(read)},
+				{Name: "write1.go", Src: []byte("package skeleton\n\nfunc (v0 *type0) func1() {\n\tv0.racyVar0 = v1\n\tfunc2()\n}\n\nfunc func2() {}\n")},
+			},
+			wantFiles: 2,
+			wantCalls: []string{"read1.go: (type0).func1", "write1.go: (type0).func1_2"},
+			want:      "func (v0 *type0) func1_2() {",
+		},
+		{
+			name: "identical declaration is dropped",
+			srcs: []stubgen.Source{
+				{Name: "read1.go", Src: []byte(read)},
+				{Name: "write1.go", Src: []byte("package skeleton\n\nfunc (v3 *type1) func3() {\n\tv3.racyVar0 = v1\n}\n\nfunc func2() {}\n")},
+			},
+			wantFiles: 2,
+			wantCalls: []string{"read1.go: (type0).func1", "write1.go: (type1).func3"},
+		},
+		{
+			name:    "no files",
+			wantErr: true,
+		},
+		{
+			name:    "no functions",
+			srcs:    []stubgen.Source{{Name: "read1.go", Src: []byte("package skeleton\n\nvar v0 int\n")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, sides, err := merge(tt.srcs)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("merge() expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("merge() error = %v", err)
+			}
+			if len(files) != tt.wantFiles {
+				t.Errorf("merge() returned %d files, want %d", len(files), tt.wantFiles)
+			}
+			for i, s := range sides {
+				if s.String() != tt.wantCalls[i] {
+					t.Errorf("side %d = %q, want %q", i, s, tt.wantCalls[i])
+				}
+			}
+			if len(files) == 2 {
+				second := string(files[1].Src)
+				if !strings.Contains(second, tt.want) {
+					t.Errorf("second file missing %q:\n%s", tt.want, second)
+				}
+				if strings.Count(second, "func func2()") != 0 {
+					t.Errorf("second file repeats func2:\n%s", second)
+				}
+			}
+		})
+	}
+}
+
+func TestGuard(t *testing.T) {
+	src := "package skeleton\n\nfunc func1() {\n\tgo func() {\n\t\tv0.Done()\n\t}()\n\tWrapper1.Go(func() error {\n\t\treturn nil\n\t})\n\tv1(func() {})\n}\n"
+	out, err := guard(stubgen.Source{Name: "write1.go", Src: []byte(src)})
+	if err != nil {
+		t.Fatalf("guard() error = %v", err)
+	}
+	if got := strings.Count(string(out.Src), recoverStmt); got != 2 {
+		t.Errorf("guard() added %d recovers, want 2:\n%s", got, out.Src)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	m, calls, err := generateDir(t, "testdata/racy")
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	want := []string{"read1.go: (type0).func1", "write1.go: (type0).func2"}
+	for i, call := range calls {
+		if call != want[i] {
+			t.Errorf("call %d = %q, want %q", i, call, want[i])
+		}
+	}
+	test := string(m.Files[TestFile])
+	for _, want := range []string{"func TestRace(t *testing.T)", "a0 := &type0{}", "a0.func1(a1)", "a0.func2(a1, a2)", "a2 := make([]int, 2)"} {
+		if !strings.Contains(test, want) {
+			t.Errorf("%s missing %q:\n%s", TestFile, want, test)
+		}
+	}
+	if !strings.Contains(string(m.Files[stubgen.StubFile]), "r0 = []int{2, 2}") {
+		t.Errorf("stubs are not populated:\n%s", m.Files[stubgen.StubFile])
+	}
+	if !strings.Contains(string(m.Files["write1.go"]), recoverStmt[:len(recoverStmt)-1]) {
+		t.Errorf("goroutine is not guarded:\n%s", m.Files["write1.go"])
+	}
+}
+
+func TestGenerateBuildError(t *testing.T) {
+	srcs := []stubgen.Source{{Name: "read1.go", Src: []byte("package skeleton\n\nfunc func1() {\n\tvar v0 int = \"StringConst0\"\n\t_ = v0\n}\n")}}
+	_, _, err := Generate(srcs)
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) {
+		t.Errorf("Generate() error = %v, want a BuildError", err)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		runErr  error
+		expired bool
+		want    string
+	}{
+		{"race", "==================\nWARNING: DATA RACE\nRead at...\n--- FAIL: TestRace", errors.New("exit status 1"), false, OutcomeRace},
+		{"no race", "=== RUN   TestRace\n--- PASS: TestRace (0.00s)\nPASS\n", nil, false, OutcomeNoRace},
+		{"panic", "panic: runtime error: invalid memory address\nFAIL\tskeleton", errors.New("exit status 2"), false, OutcomePanic},
+		{"timeout", "panic: test timed out after 1s", errors.New("exit status 2"), false, OutcomeTimeout},
+		{"killed", "", errors.New("signal: killed"), true, OutcomeTimeout},
+		{"build failed", "# skeleton\n./read1.go:3:2: undefined: v0\nFAIL\tskeleton [build failed]", errors.New("exit status 1"), false, OutcomeBuildError},
+		{"go command", "go: -race requires cgo; enable cgo by setting CGO_ENABLED=1", errors.New("exit status 2"), false, OutcomeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Result
+			classify(&r, tt.output, tt.runErr, tt.expired)
+			if r.Outcome != tt.want {
+				t.Errorf("classify() = %q, want %q", r.Outcome, tt.want)
+			}
+			if (r.Outcome == OutcomeRace || r.Outcome == OutcomeNoRace) != (r.Error == "") {
+				t.Errorf("classify() error = %q for outcome %q", r.Error, r.Outcome)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test -race")
+	}
+	tests := []struct {
+		dir  string
+		race bool
+	}{
+		{"testdata/racy", true},
+		{"testdata/fixed", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			cases, err := corpus.FindCases(tt.dir)
+			if err != nil {
+				t.Fatalf("FindCases() error = %v", err)
+			}
+			r := RunFiles(cases[0].Name, cases[0].Files, Options{})
+			if !r.Expected(tt.race) {
+				t.Errorf("Run() = %v, want race %v\n%s", r, tt.race, r.Error)
+			}
+		})
+	}
+}
+
+func generateDir(t *testing.T, dir string) (*stubgen.Module, []string, error) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var srcs []stubgen.Source
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, stubgen.Source{Name: filepath.Base(f), Src: src})
+	}
+	return Generate(srcs)
+}
@@ -0,0 +1,223 @@
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/stubgen"
+)
+
+// renameSuffix is appended to names the second file declares differently from the first
+const renameSuffix = "_2"
+
+// side is a function of the pair that the test calls
+type side struct {
+	file string
+	recv *ast.Ident // Receiver type name, nil for functions
+	name *ast.Ident
+}
+
+func (s side) String() string {
+	if s.recv == nil {
+		return fmt.Sprintf("%s: %s", s.file, s.name.Name)
+	}
+	return fmt.Sprintf("%s: (%s).%s", s.file, s.recv.Name, s.name.Name)
+}
+
+// merge makes the files of a pair one package and picks the function each side runs.
+// A single file, or two identical ones, runs against itself. Declarations the second
+// file repeats verbatim are dropped, others that collide are renamed in the second file.
+func merge(srcs []stubgen.Source) ([]stubgen.Source, []side, error) {
+	switch {
+	case len(srcs) == 0 || len(srcs) > 2:
+		return nil, nil, fmt.Errorf("expected one or two skeleton files, got %d", len(srcs))
+	case len(srcs) == 1 || bytes.Equal(srcs[0].Src, srcs[1].Src):
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, srcs[0].Name, srcs[0].Src, parser.ParseComments)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing file: %v", err)
+		}
+		s, err := entry(srcs[0].Name, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		return srcs[:1], []side{s, s}, nil
+	}
+
+	a, b := srcs[0], srcs[1]
+	if a.Name == b.Name {
+		b.Name = strings.TrimSuffix(b.Name, ".go") + renameSuffix + ".go"
+	}
+	fset := token.NewFileSet()
+	fileA, err := parser.ParseFile(fset, a.Name, a.Src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing file: %v", err)
+	}
+	fileB, err := parser.ParseFile(fset, b.Name, b.Src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing file: %v", err)
+	}
+	sideA, err := entry(a.Name, fileA)
+	if err != nil {
+		return nil, nil, err
+	}
+	sideB, err := entry(b.Name, fileB)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	declared := make(map[string]string) // Declaration key to source text
+	for _, decl := range fileA.Decls {
+		for _, key := range declKeys(decl) {
+			declared[key] = text(fset, a.Src, decl)
+		}
+	}
+	used := identNames(fileA)
+	for name := range identNames(fileB) {
+		used[name] = true
+	}
+
+	renames := make(map[string]string)
+	var decls []ast.Decl
+	for _, decl := range fileB.Decls {
+		keys := declKeys(decl)
+		same := len(keys) > 0
+		for _, key := range keys {
+			if declared[key] != text(fset, b.Src, decl) {
+				same = false
+			}
+		}
+		if same {
+			// Calls in the second file resolve to the copy in the first
+			continue
+		}
+		for _, key := range keys {
+			if _, ok := declared[key]; !ok {
+				continue
+			}
+			name := key[strings.LastIndex(key, ".")+1:]
+			if _, ok := renames[name]; ok {
+				continue
+			}
+			renamed := name + renameSuffix
+			for used[renamed] {
+				renamed += renameSuffix
+			}
+			used[renamed] = true
+			renames[name] = renamed
+		}
+		decls = append(decls, decl)
+	}
+	for _, decl := range decls {
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				if renamed, ok := renames[id.Name]; ok {
+					id.Name = renamed
+				}
+			}
+			return true
+		})
+	}
+	fileB.Decls = decls
+
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, fileB); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", b.Name, err)
+	}
+	b.Src = out.Bytes()
+	return []stubgen.Source{a, b}, []side{sideA, sideB}, nil
+}
+
+// entry picks the function of a file that accesses a racy variable, or its first function
+func entry(filename string, file *ast.File) (side, error) {
+	var first *ast.FuncDecl
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil || fn.Name.Name == "init" || fn.Name.Name == "_" {
+			continue
+		}
+		if first == nil {
+			first = fn
+		}
+		racy := false
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && strings.HasPrefix(id.Name, "racyVar") {
+				racy = true
+			}
+			return !racy
+		})
+		if racy {
+			return newSide(filename, fn)
+		}
+	}
+	if first == nil {
+		return side{}, fmt.Errorf("%s: no function to run", filename)
+	}
+	return newSide(filename, first)
+}
+
+func newSide(filename string, fn *ast.FuncDecl) (side, error) {
+	s := side{file: filename, name: fn.Name}
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return s, nil
+	}
+	t := fn.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	id, ok := t.(*ast.Ident)
+	if !ok {
+		return side{}, fmt.Errorf("%s: generic receiver of %s is not supported", filename, fn.Name.Name)
+	}
+	s.recv = id
+	return s, nil
+}
+
+// declKeys returns the names a top-level declaration declares, methods qualified by their receiver
+func declKeys(decl ast.Decl) []string {
+	var keys []string
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Name.Name == "init" || d.Name.Name == "_" {
+			return nil
+		}
+		if s, err := newSide("", d); err == nil && s.recv != nil {
+			return []string{s.recv.Name + "." + d.Name.Name}
+		}
+		return []string{d.Name.Name}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				keys = append(keys, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range s.Names {
+					if name.Name != "_" {
+						keys = append(keys, name.Name)
+					}
+				}
+			}
+		}
+	}
+	return keys
+}
+
+func text(fset *token.FileSet, src []byte, n ast.Node) string {
+	return string(src[fset.Position(n.Pos()).Offset:fset.Position(n.End()).Offset])
+}
+
+func identNames(file *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			names[id.Name] = true
+		}
+		return true
+	})
+	return names
+}
@@ -0,0 +1,10 @@
+package skeleton
+
+func (v0 *type0) func1(v2 pkg0.v3) int {
+	v0.v1.Lock()
+	defer v0.v1.Unlock()
+	if v2.Func4() {
+		return v0.racyVar0
+	}
+	return IntConst0
+}
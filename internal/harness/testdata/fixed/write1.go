@@ -0,0 +1,14 @@
+package skeleton
+
+func (v0 *type0) func2(v2 pkg0.v3, v1 []int) {
+	for _, v4 := range v2.Func5() {
+		v4 := v4
+		Wrapper1.Go(func() error {
+			v0.v1.Lock()
+			defer v0.v1.Unlock()
+			v0.racyVar0 += v4
+			return nil
+		})
+	}
+	Wrapper1.Wait()
+}
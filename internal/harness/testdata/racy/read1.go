@@ -0,0 +1,8 @@
+package skeleton
+
+func (v0 *type0) func1(v2 pkg0.v3) int {
+	if v2.Func4() {
+		return v0.racyVar0
+	}
+	return IntConst0
+}
@@ -0,0 +1,248 @@
+package leakcheck
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/skeletonizer"
+)
+
+// Severity levels, from least to most likely to expose proprietary information
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// Kinds of leaks
+const (
+	KindComment    = "comment"
+	KindString     = "string"
+	KindImport     = "import"
+	KindIdentifier = "identifier"
+	KindSelector   = "selector"
+	KindNumber     = "number"
+	KindPackage    = "package"
+)
+
+// Finding represents a name or text that does not follow the placeholder grammar
+type Finding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Kind     string `json:"kind"`
+	Text     string `json:"text"`
+	Severity string `json:"severity"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s %q is not anonymized", f.File, f.Line, f.Column, f.Severity, f.Kind, f.Text)
+}
+
+// SeverityRank orders severities; unknown severities rank lowest
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	}
+	return 0
+}
+
+// allowedNames lists well-known identifiers that are not proprietary
+var allowedNames = map[string]bool{
+	"main":   true,
+	"init":   true,
+	"error":  true,
+	"any":    true,
+	"cancel": true, // Conventional result of context.WithCancel
+}
+
+// allowedSelectors lists stdlib and well-known concurrency API names,
+// which skeletons keep even when the package itself is anonymized
+var allowedSelectors = map[string]bool{
+	"WithContext": true, "Group": true, "WaitGroup": true, "Mutex": true,
+	"RWMutex": true, "Once": true, "Cond": true, "Pool": true, "Map": true,
+	"Load": true, "Store": true, "Swap": true, "CompareAndSwap": true,
+	"LoadOrStore": true, "LoadAndDelete": true, "Delete": true, "Range": true,
+	"Signal": true, "Broadcast": true, "Get": true, "Put": true,
+	"Acquire": true, "Release": true, "TryAcquire": true,
+	"Increment": true, "Decrement": true, "Inc": true, "Dec": true,
+}
+
+// packageClauses lists the package names accepted in skeletons
+var packageClauses = map[string]bool{
+	skeletonizer.SkeletonPackage: true,
+	"main":                       true,
+}
+
+// Checker scans skeletons for names and text outside the placeholder grammar
+type Checker struct {
+	allow map[string]bool
+}
+
+// NewChecker returns a checker that additionally accepts the given names
+func NewChecker(extra []string) *Checker {
+	c := &Checker{allow: make(map[string]bool)}
+	for _, name := range extra {
+		c.allow[name] = true
+	}
+	return c
+}
+
+// LoadAllowlist reads extra allowed names, one per line; blank lines and # comments are ignored
+func LoadAllowlist(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, scanner.Err()
+}
+
+// CheckPath scans a Go file, or every Go file below a directory
+func (c *Checker) CheckPath(root string) ([]Finding, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return c.CheckFile(root)
+	}
+	var findings []Finding
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+		fileFindings, err := c.CheckFile(p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		findings = append(findings, fileFindings...)
+		return nil
+	})
+	return findings, err
+}
+
+// CheckFile scans a Go file and returns its findings in source order
+func (c *Checker) CheckFile(filename string) ([]Finding, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing file: %v", err)
+	}
+
+	var findings []Finding
+	report := func(pos token.Pos, kind, text, severity string) {
+		p := fset.Position(pos)
+		findings = append(findings, Finding{
+			File:     filename,
+			Line:     p.Line,
+			Column:   p.Column,
+			Kind:     kind,
+			Text:     text,
+			Severity: severity,
+		})
+	}
+
+	if !packageClauses[file.Name.Name] && !c.allow[file.Name.Name] {
+		report(file.Name.Pos(), KindPackage, file.Name.Name, SeverityLow)
+	}
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			report(comment.Pos(), KindComment, comment.Text, SeverityHigh)
+		}
+	}
+
+	for _, spec := range file.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || !skeletonizer.ConcurrencyPackages[p] && !c.allow[p] {
+			report(spec.Path.Pos(), KindImport, spec.Path.Value, SeverityHigh)
+		}
+	}
+	for _, decl := range file.Decls {
+		ast.Inspect(decl, func(n ast.Node) bool {
+			return c.inspect(n, report)
+		})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
+		}
+		return findings[i].Column < findings[j].Column
+	})
+	return findings, nil
+}
+
+// inspect checks one node of a declaration
+func (c *Checker) inspect(n ast.Node, report func(token.Pos, string, string, string)) bool {
+	switch n := n.(type) {
+	case *ast.ImportSpec:
+		// Import paths are checked separately; aliases are checked as identifiers
+		if n.Name != nil && !c.allowedIdent(n.Name.Name) {
+			report(n.Name.Pos(), KindIdentifier, n.Name.Name, SeverityMedium)
+		}
+		return false
+	case *ast.BasicLit:
+		switch n.Kind {
+		case token.STRING, token.CHAR:
+			if !skeletonizer.IsStringPlaceholder(n.Value) {
+				report(n.Pos(), KindString, n.Value, SeverityHigh)
+			}
+		case token.INT, token.FLOAT, token.IMAG:
+			report(n.Pos(), KindNumber, n.Value, SeverityLow)
+		}
+	case *ast.SelectorExpr:
+		if x, ok := n.X.(*ast.Ident); ok && (skeletonizer.ConcurrencyNames[x.Name] || c.allow[x.Name]) {
+			// Members of concurrency packages are public API
+			if !ast.IsExported(n.Sel.Name) {
+				report(n.Sel.Pos(), KindSelector, n.Sel.Name, SeverityMedium)
+			}
+			return false
+		}
+		ast.Inspect(n.X, func(n ast.Node) bool {
+			return c.inspect(n, report)
+		})
+		name := n.Sel.Name
+		if !c.allowedIdent(name) && !skeletonizer.ConcurrencyMethods[name] && !allowedSelectors[name] {
+			report(n.Sel.Pos(), KindSelector, name, SeverityMedium)
+		}
+		return false
+	case *ast.Ident:
+		if !c.allowedIdent(n.Name) {
+			report(n.Pos(), KindIdentifier, n.Name, SeverityMedium)
+		}
+	}
+	return true
+}
+
+func (c *Checker) allowedIdent(name string) bool {
+	return skeletonizer.IsPlaceholder(name) || skeletonizer.IsPredeclared(name) || skeletonizer.ConcurrencyNames[name] ||
+		allowedNames[name] || c.allow[name]
+}
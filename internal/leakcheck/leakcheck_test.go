@@ -0,0 +1,92 @@
+package leakcheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		allow    []string
+		want     []Finding
+	}{
+		{
+			name:     "clean skeleton",
+			filename: "testdata/clean.go",
+		},
+		{
+			name:     "leaky skeleton",
+			filename: "testdata/leaky.go",
+			want: []Finding{
+				{Line: 1, Column: 9, Kind: KindPackage, Text: "payments", Severity: SeverityLow},
+				{Line: 3, Column: 8, Kind: KindImport, Text: `"github.com/example/ledger"`, Severity: SeverityHigh},
+				{Line: 5, Column: 1, Kind: KindComment, Text: "// chargeCard retries the ledger write", Severity: SeverityHigh},
+				{Line: 7, Column: 13, Kind: KindIdentifier, Text: "ledger", Severity: SeverityMedium},
+				{Line: 7, Column: 20, Kind: KindSelector, Text: "Charge", Severity: SeverityMedium},
+				{Line: 7, Column: 31, Kind: KindString, Text: `"card declined"`, Severity: SeverityHigh},
+				{Line: 7, Column: 48, Kind: KindNumber, Text: "3", Severity: SeverityLow},
+				{Line: 8, Column: 12, Kind: KindSelector, Text: "customerID", Severity: SeverityMedium},
+			},
+		},
+		{
+			name:     "allowlisted names",
+			filename: "testdata/leaky.go",
+			allow:    []string{"payments", "github.com/example/ledger", "ledger", "customerID"},
+			want: []Finding{
+				{Line: 5, Column: 1, Kind: KindComment, Text: "// chargeCard retries the ledger write", Severity: SeverityHigh},
+				{Line: 7, Column: 31, Kind: KindString, Text: `"card declined"`, Severity: SeverityHigh},
+				{Line: 7, Column: 48, Kind: KindNumber, Text: "3", Severity: SeverityLow},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewChecker(tt.allow).CheckFile(tt.filename)
+			if err != nil {
+				t.Fatalf("CheckFile() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("CheckFile() = %v, want %d findings", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				want.File = tt.filename
+				if got[i] != want {
+					t.Errorf("CheckFile()[%d] = %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	findings, err := NewChecker(nil).CheckPath("testdata")
+	if err != nil {
+		t.Fatalf("CheckPath() error = %v", err)
+	}
+	for _, f := range findings {
+		if f.File != filepath.Join("testdata", "leaky.go") {
+			t.Errorf("CheckPath() unexpected finding %v", f)
+		}
+	}
+	if len(findings) == 0 {
+		t.Errorf("CheckPath() found nothing in testdata")
+	}
+}
+
+func TestLoadAllowlist(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "allow.txt")
+	if err := os.WriteFile(filename, []byte("# reviewed names\nledger\n\n  customerID  \n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	names, err := LoadAllowlist(filename)
+	if err != nil {
+		t.Fatalf("LoadAllowlist() error = %v", err)
+	}
+	if len(names) != 2 || names[0] != "ledger" || names[1] != "customerID" {
+		t.Errorf("LoadAllowlist() = %v, want [ledger customerID]", names)
+	}
+}
@@ -0,0 +1,17 @@
+package skeleton
+
+func (v1 *type0) func1(v2 pkg0.v3) type1 {
+	var v4 sync.WaitGroup
+	var v5 sync.Mutex
+	v6, cancel := pkg1.Func2(v2)
+	defer cancel()
+	Wrapper1.Go(func() type1 {
+		v5.Lock()
+		racyVar0 = append(racyVar0, v6.Func3("StringConst0", IntConst0))
+		v5.Unlock()
+		return nil
+	})
+	v4.Wait()
+	atomic.AddInt32(&v1.v7, IntConst1)
+	return pkg2.WithContext(v2)
+}
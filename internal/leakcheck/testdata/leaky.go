@@ -0,0 +1,9 @@
+package payments
+
+import "github.com/example/ledger"
+
+// chargeCard retries the ledger write
+func (v1 *type0) func1(v2 pkg0.v3) type1 {
+	racyVar0 = ledger.Charge(v2, "card declined", 3)
+	return v1.customerID
+}
@@ -0,0 +1,724 @@
+package patterns
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// Race patterns from the DR.FIX paper
+const (
+	// LoopVarCapture is a loop variable used by a goroutine started in the loop
+	LoopVarCapture = "loop-variable-capture"
+	// ErrgroupSharedErr is a variable of the spawning function, usually err,
+	// reassigned by closures passed to errgroup Go
+	ErrgroupSharedErr = "errgroup-shared-err"
+	// ConcurrentMapWrite is a map inserted into or deleted from by spawned goroutines
+	ConcurrentMapWrite = "concurrent-map-write"
+	// SliceHeaderReassign is a slice variable reassigned, by append or slicing, while shared
+	SliceHeaderReassign = "slice-header-reassignment"
+	// StructFieldReceiver is a racy field accessed through a method receiver
+	StructFieldReceiver = "struct-field-receiver"
+	// LazyInit is a check-then-set initialization without sync.Once
+	LazyInit = "unsynchronized-lazy-init"
+	// CapturedWrite is a variable of the spawning function assigned by a
+	// goroutine started with a go statement
+	CapturedWrite = "captured-variable-write"
+)
+
+// Evidence is a node that made a rule match
+type Evidence struct {
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Node   string `json:"node"` // AST node type, for example GoStmt
+	Text   string `json:"text"` // Source line of the node
+}
+
+// Match is a race pattern found in a file
+type Match struct {
+	Pattern    string     `json:"pattern"`
+	Confidence float64    `json:"confidence"`
+	Evidence   []Evidence `json:"evidence"`
+}
+
+// Kinds of racy variables, inferred from their declarations since skeletons are not type-checked
+const (
+	kindUnknown = iota
+	kindMap
+	kindSlice
+)
+
+type classifier struct {
+	fset    *token.FileSet
+	lines   []string
+	matches map[string]*Match
+	// goroutines maps the function literals run as goroutines to their go
+	// statement or spawner call
+	goroutines map[*ast.FuncLit]ast.Node
+	kinds      map[string]int
+	defs       map[string]ast.Expr // Last value defined with := for each name
+}
+
+// File classifies the races of a parsed file. A file usually matches one
+// pattern, but may match several; matches are sorted by decreasing confidence.
+func File(fset *token.FileSet, file *ast.File, src []byte) []Match {
+	c := &classifier{
+		fset:       fset,
+		lines:      strings.Split(string(src), "\n"),
+		matches:    make(map[string]*Match),
+		goroutines: make(map[*ast.FuncLit]ast.Node),
+		kinds:      make(map[string]int),
+		defs:       make(map[string]ast.Expr),
+	}
+	c.declarations(file)
+
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			if spawn, ok := c.goroutines[n]; ok {
+				c.loopCapture(n, spawn, stack)
+				c.capturedWrite(n, spawn)
+			}
+		case *ast.AssignStmt:
+			if c.inGoroutine(stack) {
+				c.mapWrite(n)
+			}
+			c.sliceReassign(n)
+		case *ast.CallExpr:
+			if c.inGoroutine(stack) {
+				c.mapDelete(n)
+			}
+		case *ast.SelectorExpr:
+			c.receiverField(n, stack)
+		case *ast.IfStmt:
+			c.lazyInit(n, stack)
+		}
+		return true
+	})
+
+	var matches []Match
+	for _, m := range c.matches {
+		sort.Slice(m.Evidence, func(i, j int) bool {
+			a, b := m.Evidence[i], m.Evidence[j]
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+		matches = append(matches, *m)
+	}
+	sortMatches(matches)
+	return matches
+}
+
+// sortMatches sorts matches by decreasing confidence, then by pattern
+func sortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Confidence != matches[j].Confidence {
+			return matches[i].Confidence > matches[j].Confidence
+		}
+		return matches[i].Pattern < matches[j].Pattern
+	})
+}
+
+// Merge combines the matches of the files of a case, keeping the highest
+// confidence of each pattern and the evidence of every file
+func Merge(lists ...[]Match) []Match {
+	merged := make(map[string]*Match)
+	var order []string
+	for _, list := range lists {
+		for _, m := range list {
+			old, ok := merged[m.Pattern]
+			if !ok {
+				m := m
+				m.Evidence = append([]Evidence(nil), m.Evidence...)
+				merged[m.Pattern] = &m
+				order = append(order, m.Pattern)
+				continue
+			}
+			if m.Confidence > old.Confidence {
+				old.Confidence = m.Confidence
+			}
+			old.Evidence = append(old.Evidence, m.Evidence...)
+		}
+	}
+	var matches []Match
+	for _, name := range order {
+		matches = append(matches, *merged[name])
+	}
+	sortMatches(matches)
+	return matches
+}
+
+// add records a match, keeping the highest confidence and the evidence of every rule that fired
+func (c *classifier) add(pattern string, confidence float64, nodes ...ast.Node) {
+	m, ok := c.matches[pattern]
+	if !ok {
+		m = &Match{Pattern: pattern}
+		c.matches[pattern] = m
+	}
+	if confidence > m.Confidence {
+		m.Confidence = confidence
+	}
+	for _, n := range nodes {
+		e := c.evidence(n)
+		dup := false
+		for _, old := range m.Evidence {
+			if old == e {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			m.Evidence = append(m.Evidence, e)
+		}
+	}
+}
+
+func (c *classifier) evidence(n ast.Node) Evidence {
+	pos := c.fset.Position(n.Pos())
+	e := Evidence{Line: pos.Line, Column: pos.Column, Node: strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")}
+	if pos.Line-1 < len(c.lines) {
+		e.Text = strings.TrimSpace(c.lines[pos.Line-1])
+	}
+	return e
+}
+
+// declarations finds the goroutine bodies and infers the kind of variables
+func (c *classifier) declarations(file *ast.File) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			if lit, ok := n.Call.Fun.(*ast.FuncLit); ok {
+				c.goroutines[lit] = n
+			}
+		case *ast.CallExpr:
+			if isSpawner(n) {
+				for _, arg := range n.Args {
+					if lit, ok := arg.(*ast.FuncLit); ok {
+						c.goroutines[lit] = n
+					}
+				}
+			}
+		case *ast.Field:
+			for _, name := range n.Names {
+				c.setKind(name.Name, typeKind(n.Type))
+			}
+		case *ast.ValueSpec:
+			for i, name := range n.Names {
+				if n.Type != nil {
+					c.setKind(name.Name, typeKind(n.Type))
+				} else if i < len(n.Values) {
+					c.setKind(name.Name, valueKind(n.Values[i]))
+				}
+			}
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				id, ok := lhs.(*ast.Ident)
+				if !ok {
+					continue
+				}
+				c.setKind(id.Name, valueKind(n.Rhs[i]))
+				if n.Tok == token.DEFINE {
+					c.defs[id.Name] = n.Rhs[i]
+				}
+			}
+		}
+		return true
+	})
+}
+
+func (c *classifier) setKind(name string, kind int) {
+	if kind != kindUnknown {
+		c.kinds[name] = kind
+	}
+}
+
+// inGoroutine reports whether the top of the stack is inside a goroutine body
+func (c *classifier) inGoroutine(stack []ast.Node) bool {
+	return c.goroutine(stack) != nil
+}
+
+// goroutine returns the innermost goroutine body enclosing the top of the stack
+func (c *classifier) goroutine(stack []ast.Node) *ast.FuncLit {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if lit, ok := stack[i].(*ast.FuncLit); ok {
+			if _, ok := c.goroutines[lit]; ok {
+				return lit
+			}
+		}
+	}
+	return nil
+}
+
+// loopCapture matches goroutines that use, rather than receive as argument,
+// a variable declared by an enclosing loop
+func (c *classifier) loopCapture(lit *ast.FuncLit, spawn ast.Node, stack []ast.Node) {
+	vars := make(map[string]bool)
+	for i := len(stack) - 2; i >= 0; i-- {
+		if _, ok := stack[i].(*ast.FuncLit); ok {
+			break
+		}
+		switch loop := stack[i].(type) {
+		case *ast.RangeStmt:
+			if loop.Tok == token.DEFINE {
+				for _, e := range []ast.Expr{loop.Key, loop.Value} {
+					if id, ok := e.(*ast.Ident); ok && id.Name != "_" {
+						vars[id.Name] = true
+					}
+				}
+			}
+		case *ast.ForStmt:
+			if init, ok := loop.Init.(*ast.AssignStmt); ok && init.Tok == token.DEFINE {
+				for _, e := range init.Lhs {
+					if id, ok := e.(*ast.Ident); ok && id.Name != "_" {
+						vars[id.Name] = true
+					}
+				}
+			}
+		}
+	}
+	for _, name := range params(lit) {
+		delete(vars, name)
+	}
+	if len(vars) == 0 {
+		return
+	}
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || !vars[id.Name] {
+			return true
+		}
+		confidence := 0.7
+		if isRacy(id.Name) {
+			confidence = 0.9
+		}
+		c.add(LoopVarCapture, confidence, spawn, id)
+		return true
+	})
+}
+
+// capturedWrite matches goroutines that assign a variable of the spawning
+// function. In closures passed to errgroup Go the variable is the shared
+// error when it is compared to nil or returned by the closure.
+func (c *classifier) capturedWrite(lit *ast.FuncLit, spawn ast.Node) {
+	_, errgroup := spawn.(*ast.CallExpr)
+	local := make(map[string]bool)
+	for _, name := range params(lit) {
+		local[name] = true
+	}
+	check := func(stmt ast.Node, lhs ast.Expr) {
+		id, ok := unparen(lhs).(*ast.Ident)
+		if !ok || local[id.Name] || !isRacy(id.Name) {
+			return
+		}
+		switch {
+		case !errgroup:
+			c.add(CapturedWrite, 0.7, spawn, stmt)
+		case usedAsError(lit.Body, id.Name):
+			c.add(ErrgroupSharedErr, 0.9, spawn, stmt)
+		default:
+			c.add(ErrgroupSharedErr, 0.7, spawn, stmt)
+		}
+	}
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				if n.Tok == token.DEFINE {
+					if id, ok := lhs.(*ast.Ident); ok {
+						local[id.Name] = true
+					}
+					continue
+				}
+				check(n, lhs)
+			}
+		case *ast.IncDecStmt:
+			check(n, n.X)
+		case *ast.DeclStmt:
+			if gen, ok := n.Decl.(*ast.GenDecl); ok {
+				for _, spec := range gen.Specs {
+					if vs, ok := spec.(*ast.ValueSpec); ok {
+						for _, name := range vs.Names {
+							local[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+		return true
+	})
+}
+
+// unparen strips parentheses and pointer indirections
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		switch x := e.(type) {
+		case *ast.ParenExpr:
+			e = x.X
+		case *ast.StarExpr:
+			e = x.X
+		default:
+			return e
+		}
+	}
+}
+
+// usedAsError reports whether a name is compared to nil or returned in body
+func usedAsError(body ast.Node, name string) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BinaryExpr:
+			if (n.Op == token.EQL || n.Op == token.NEQ) && (isIdent(n.X, name) && isIdent(n.Y, "nil") || isIdent(n.Y, name) && isIdent(n.X, "nil")) {
+				found = true
+			}
+		case *ast.ReturnStmt:
+			for _, r := range n.Results {
+				if isIdent(r, name) {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// mapWrite matches index assignments to a racy variable inside a goroutine
+func (c *classifier) mapWrite(as *ast.AssignStmt) {
+	if as.Tok == token.DEFINE {
+		return
+	}
+	for _, lhs := range as.Lhs {
+		index, ok := lhs.(*ast.IndexExpr)
+		if !ok {
+			continue
+		}
+		name := racyName(index.X)
+		if name == "" {
+			continue
+		}
+		switch c.kinds[name] {
+		case kindMap:
+			c.add(ConcurrentMapWrite, 0.9, as)
+		case kindUnknown:
+			c.add(ConcurrentMapWrite, 0.5, as)
+		}
+	}
+}
+
+// mapDelete matches deletes from a racy variable inside a goroutine
+func (c *classifier) mapDelete(call *ast.CallExpr) {
+	if !isIdent(call.Fun, "delete") || len(call.Args) == 0 {
+		return
+	}
+	if racyName(call.Args[0]) != "" {
+		c.add(ConcurrentMapWrite, 0.9, call)
+	}
+}
+
+// sliceReassign matches assignments of a new slice header to a racy variable:
+// an append, a slicing, or a variable defined by one
+func (c *classifier) sliceReassign(as *ast.AssignStmt) {
+	if as.Tok != token.ASSIGN || len(as.Lhs) != len(as.Rhs) {
+		return
+	}
+	for i, lhs := range as.Lhs {
+		name := racyName(lhs)
+		if name == "" {
+			continue
+		}
+		rhs := as.Rhs[i]
+		if id, ok := rhs.(*ast.Ident); ok {
+			if def, ok := c.defs[id.Name]; ok {
+				rhs = def
+			}
+		}
+		confidence := 0.0
+		switch r := rhs.(type) {
+		case *ast.CallExpr:
+			if isIdent(r.Fun, "append") {
+				confidence = 0.7
+				if len(r.Args) > 0 && racyName(r.Args[0]) == name {
+					confidence = 0.9
+				}
+			}
+		case *ast.SliceExpr:
+			confidence = 0.7
+			if racyName(r.X) == name {
+				confidence = 0.9
+			}
+		}
+		if confidence == 0 && c.kinds[name] == kindSlice {
+			confidence = 0.6
+		}
+		if confidence > 0 {
+			c.add(SliceHeaderReassign, confidence, as)
+		}
+	}
+}
+
+// receiverField matches racy fields selected from the receiver of the enclosing method
+func (c *classifier) receiverField(sel *ast.SelectorExpr, stack []ast.Node) {
+	if !isRacy(sel.Sel.Name) {
+		return
+	}
+	root := sel.X
+	for {
+		switch x := root.(type) {
+		case *ast.SelectorExpr:
+			root = x.X
+			continue
+		case *ast.ParenExpr:
+			root = x.X
+			continue
+		case *ast.StarExpr:
+			root = x.X
+			continue
+		}
+		break
+	}
+	id, ok := root.(*ast.Ident)
+	if !ok {
+		return
+	}
+	var decl *ast.FuncDecl
+	for _, n := range stack {
+		if d, ok := n.(*ast.FuncDecl); ok {
+			decl = d
+		}
+	}
+	if decl == nil || decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return
+	}
+	names := decl.Recv.List[0].Names
+	if len(names) == 0 || names[0].Name != id.Name {
+		return
+	}
+	confidence := 0.6
+	if written(stack) {
+		confidence = 0.8
+	}
+	c.add(StructFieldReceiver, confidence, sel)
+}
+
+// written reports whether the expression at the top of the stack is assigned,
+// directly or through an index or field of it
+func written(stack []ast.Node) bool {
+	child := stack[len(stack)-1]
+	for i := len(stack) - 2; i >= 0; i-- {
+		switch p := stack[i].(type) {
+		case *ast.ParenExpr, *ast.StarExpr:
+		case *ast.IndexExpr:
+			if p.X != child {
+				return false
+			}
+		case *ast.SelectorExpr:
+			if p.X != child {
+				return false
+			}
+		case *ast.AssignStmt:
+			if p.Tok == token.DEFINE {
+				return false
+			}
+			for _, lhs := range p.Lhs {
+				if lhs == child {
+					return true
+				}
+			}
+			return false
+		case *ast.IncDecStmt:
+			return p.X == child
+		default:
+			return false
+		}
+		child = stack[i]
+	}
+	return false
+}
+
+// lazyInit matches an if statement that tests whether a racy expression is
+// unset and sets it in its body. A lock or Once in the function lowers the confidence.
+func (c *classifier) lazyInit(stmt *ast.IfStmt, stack []ast.Node) {
+	for _, x := range unsetTests(stmt.Cond) {
+		if racyName(x) == "" && !mentionsRacy(x) {
+			continue
+		}
+		target := types.ExprString(x)
+		var set ast.Node
+		ast.Inspect(stmt.Body, func(n ast.Node) bool {
+			if as, ok := n.(*ast.AssignStmt); ok && as.Tok != token.DEFINE {
+				for _, lhs := range as.Lhs {
+					if types.ExprString(lhs) == target {
+						set = as
+					}
+				}
+			}
+			return set == nil
+		})
+		if set == nil {
+			continue
+		}
+		confidence := 0.8
+		if guarded(stack) {
+			confidence = 0.5
+		}
+		c.add(LazyInit, confidence, stmt, set)
+	}
+}
+
+// unsetTests returns the expressions a condition tests for being nil, zero, empty or false
+func unsetTests(cond ast.Expr) []ast.Expr {
+	var xs []ast.Expr
+	ast.Inspect(cond, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.BinaryExpr:
+			if e.Op != token.EQL {
+				return true
+			}
+			if isUnset(e.Y) {
+				xs = append(xs, e.X)
+			} else if isUnset(e.X) {
+				xs = append(xs, e.Y)
+			}
+		case *ast.UnaryExpr:
+			if e.Op == token.NOT {
+				xs = append(xs, e.X)
+			}
+		case *ast.FuncLit:
+			return false
+		}
+		return true
+	})
+	return xs
+}
+
+func isUnset(e ast.Expr) bool {
+	if isIdent(e, "nil") || isIdent(e, "false") {
+		return true
+	}
+	lit, ok := e.(*ast.BasicLit)
+	return ok && (lit.Value == "0" || lit.Value == `""`)
+}
+
+// guarded reports whether the function enclosing the top of the stack locks or uses a Once
+func guarded(stack []ast.Node) bool {
+	var fn ast.Node
+	for i := len(stack) - 1; i >= 0 && fn == nil; i-- {
+		switch stack[i].(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			fn = stack[i]
+		}
+	}
+	if fn == nil {
+		return false
+	}
+	found := false
+	ast.Inspect(fn, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+				switch sel.Sel.Name {
+				case "Lock", "RLock", "Do":
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func isSpawner(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && (sel.Sel.Name == "Go" || sel.Sel.Name == "TryGo")
+}
+
+func isRacy(name string) bool {
+	return strings.HasPrefix(name, "racyVar")
+}
+
+func isIdent(e ast.Expr, name string) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+// racyName returns the racy variable or field an expression denotes, or ""
+func racyName(e ast.Expr) string {
+	switch x := e.(type) {
+	case *ast.Ident:
+		if isRacy(x.Name) {
+			return x.Name
+		}
+	case *ast.SelectorExpr:
+		if isRacy(x.Sel.Name) {
+			return x.Sel.Name
+		}
+	case *ast.ParenExpr:
+		return racyName(x.X)
+	case *ast.StarExpr:
+		return racyName(x.X)
+	}
+	return ""
+}
+
+func mentionsRacy(e ast.Expr) bool {
+	found := false
+	ast.Inspect(e, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && isRacy(id.Name) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func params(lit *ast.FuncLit) []string {
+	var names []string
+	for _, field := range lit.Type.Params.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+func typeKind(t ast.Expr) int {
+	switch t := t.(type) {
+	case *ast.MapType:
+		return kindMap
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return kindSlice
+		}
+	}
+	return kindUnknown
+}
+
+func valueKind(e ast.Expr) int {
+	switch v := e.(type) {
+	case *ast.CompositeLit:
+		if v.Type != nil {
+			return typeKind(v.Type)
+		}
+	case *ast.CallExpr:
+		if isIdent(v.Fun, "make") && len(v.Args) > 0 {
+			return typeKind(v.Args[0])
+		}
+		if isIdent(v.Fun, "append") {
+			return kindSlice
+		}
+	case *ast.SliceExpr:
+		return kindSlice
+	}
+	return kindUnknown
+}
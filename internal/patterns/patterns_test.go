@@ -0,0 +1,268 @@
+package patterns
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantMin float64
+		wantNot []string
+	}{
+		{
+			name: "errgroup shared err",
+			src: `package skeleton
+
+func func1() type1 {
+	v4, v6 := errgroup.WithContext(v6)
+	for v16 := range v8 {
+		Wrapper1.Go(func() type1 {
+			v8[v7].v14, racyVar0 = v1.Func4(v6)
+			if racyVar0 != nil {
+				return racyVar0
+			}
+			return nil
+		})
+	}
+	return Wrapper1.Wait()
+}
+`,
+			want:    ErrgroupSharedErr,
+			wantMin: 0.9,
+			wantNot: []string{CapturedWrite},
+		},
+		{
+			name: "go statement writes captured variable",
+			src: `package skeleton
+
+func func1() {
+	var racyVar0 type0
+	go func() {
+		v1, racyVar0 = v2.Func4()
+	}()
+	go func() {
+		racyVar0 := v3
+		_ = racyVar0
+	}()
+}
+`,
+			want:    CapturedWrite,
+			wantMin: 0.7,
+			wantNot: []string{ErrgroupSharedErr},
+		},
+		{
+			name: "loop variable captured",
+			src: `package skeleton
+
+func func1() {
+	for _, racyVar0 := range v1 {
+		go func() {
+			v2.Func1(racyVar0)
+		}()
+	}
+}
+`,
+			want:    LoopVarCapture,
+			wantMin: 0.9,
+		},
+		{
+			name: "loop variable passed as argument",
+			src: `package skeleton
+
+func func1() {
+	for _, racyVar0 := range v1 {
+		go func(racyVar0 type0) {
+			v2.Func1(racyVar0)
+		}(racyVar0)
+	}
+}
+`,
+			wantNot: []string{LoopVarCapture},
+		},
+		{
+			name: "concurrent map insertion",
+			src: `package skeleton
+
+func func1() {
+	racyVar0 := map[type1]*v9.v11{}
+	for _, v28 := range v24 {
+		go func(v28 *v9.v4) {
+			defer v21.Done()
+			racyVar0[v28.Func20()] = v22
+		}(v28)
+	}
+}
+`,
+			want:    ConcurrentMapWrite,
+			wantMin: 0.9,
+			wantNot: []string{LoopVarCapture},
+		},
+		{
+			name: "map insertion outside goroutines",
+			src: `package skeleton
+
+func func1() {
+	racyVar0 := map[type1]type2{}
+	racyVar0[v1] = v2
+}
+`,
+			wantNot: []string{ConcurrentMapWrite},
+		},
+		{
+			name: "slice header reassignment",
+			src: `package skeleton
+
+func func1(racyVar0 []type1) {
+	v2 = func(v6 pkg1.v7) {
+		v13, v12 := racyVar0[IntConst0], racyVar0[IntConst1:]
+		racyVar0 = v12
+	}
+}
+`,
+			want:    SliceHeaderReassign,
+			wantMin: 0.9,
+		},
+		{
+			name: "struct field written through receiver",
+			src: `package skeleton
+
+func (v1 *type0) func1() {
+	v1.v2.racyVar0 = v3
+}
+`,
+			want:    StructFieldReceiver,
+			wantMin: 0.8,
+		},
+		{
+			name: "struct field of another variable",
+			src: `package skeleton
+
+func (v1 *type0) func1() {
+	v4.racyVar0 = v3
+}
+`,
+			wantNot: []string{StructFieldReceiver},
+		},
+		{
+			name: "lazy init",
+			src: `package skeleton
+
+func (v1 *type0) func1() *type1 {
+	if v1.racyVar0 == nil {
+		v1.racyVar0 = func2()
+	}
+	return v1.racyVar0
+}
+`,
+			want:    LazyInit,
+			wantMin: 0.8,
+		},
+		{
+			name: "lazy init under lock",
+			src: `package skeleton
+
+func (v1 *type0) func1() *type1 {
+	v1.v2.Lock()
+	defer v1.v2.Unlock()
+	if v1.racyVar0 == nil {
+		v1.racyVar0 = func2()
+	}
+	return v1.racyVar0
+}
+`,
+			want:    LazyInit,
+			wantMin: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "skeleton.go", tt.src, 0)
+			if err != nil {
+				t.Fatalf("ParseFile() error = %v", err)
+			}
+			matches := File(fset, file, []byte(tt.src))
+			got := make(map[string]Match)
+			for _, m := range matches {
+				got[m.Pattern] = m
+			}
+			if tt.want != "" {
+				m, ok := got[tt.want]
+				if !ok {
+					t.Fatalf("File() = %v, want %s", matches, tt.want)
+				}
+				if m.Confidence < tt.wantMin {
+					t.Errorf("%s confidence = %v, want at least %v", tt.want, m.Confidence, tt.wantMin)
+				}
+				if len(m.Evidence) == 0 {
+					t.Errorf("%s has no evidence", tt.want)
+				}
+			}
+			for _, p := range tt.wantNot {
+				if _, ok := got[p]; ok {
+					t.Errorf("File() = %v, want no %s", matches, p)
+				}
+			}
+		})
+	}
+}
+
+func TestFileEvidence(t *testing.T) {
+	src := `package skeleton
+
+func func1() {
+	var racyVar0 type0
+	go func() {
+		racyVar0 = v1
+	}()
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "skeleton.go", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	matches := File(fset, file, []byte(src))
+	if len(matches) != 1 {
+		t.Fatalf("File() = %v, want one match", matches)
+	}
+	want := []Evidence{
+		{Line: 5, Column: 2, Node: "GoStmt", Text: "go func() {"},
+		{Line: 6, Column: 3, Node: "AssignStmt", Text: "racyVar0 = v1"},
+	}
+	if len(matches[0].Evidence) != len(want) {
+		t.Fatalf("Evidence = %v, want %v", matches[0].Evidence, want)
+	}
+	for i, e := range want {
+		if matches[0].Evidence[i] != e {
+			t.Errorf("Evidence[%d] = %v, want %v", i, matches[0].Evidence[i], e)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := []Match{{Pattern: CapturedWrite, Confidence: 0.7, Evidence: []Evidence{{Line: 1}}}}
+	b := []Match{
+		{Pattern: LoopVarCapture, Confidence: 0.9, Evidence: []Evidence{{Line: 2}}},
+		{Pattern: CapturedWrite, Confidence: 0.8, Evidence: []Evidence{{Line: 3}}},
+	}
+	got := Merge(a, b)
+	if len(got) != 2 {
+		t.Fatalf("Merge() = %v, want 2 matches", got)
+	}
+	if got[0].Pattern != LoopVarCapture || got[1].Pattern != CapturedWrite {
+		t.Errorf("Merge() order = %s, %s", got[0].Pattern, got[1].Pattern)
+	}
+	if got[1].Confidence != 0.8 || len(got[1].Evidence) != 2 {
+		t.Errorf("Merge() %s = %v, want confidence 0.8 and 2 evidence", CapturedWrite, got[1])
+	}
+	if len(a[0].Evidence) != 1 {
+		t.Errorf("Merge() modified its input: %v", a[0])
+	}
+}
@@ -0,0 +1,62 @@
+package skeletonizer
+
+import (
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// kindCanonical is the mapping kind used to renumber placeholders
+const kindCanonical = "canonical"
+
+// Canonicalize renumbers the placeholders of a skeleton in order of first
+// occurrence, numbering them as the skeletonizer does, so that skeletons equal
+// up to the choice of placeholders get the same text. Comments and the
+// original layout are dropped and the result is gofmt-formatted.
+// Placeholders are allocated from m, so that both files of a pair can be
+// renumbered consistently by sharing it.
+func Canonicalize(src []byte, m *Mapping) ([]byte, error) {
+	var b strings.Builder
+	var errs scanner.ErrorList
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, func(pos token.Position, msg string) { errs.Add(pos, msg) }, 0)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch {
+		case tok == token.SEMICOLON && lit == "\n":
+			b.WriteString("\n")
+			continue
+		case tok == token.IDENT:
+			if prefix, _, ok := splitPlaceholder(lit); ok {
+				lit = m.lookup(kindCanonical, lit, prefix)
+			}
+		case tok == token.STRING && IsStringPlaceholder(lit):
+			name, _ := strconv.Unquote(lit)
+			lit = strconv.Quote(m.lookup(kindCanonical, name, prefixStringConst))
+		case tok == token.LBRACE:
+			// Break after every brace so that the layout of the original does not matter
+			b.WriteString("{\n")
+			continue
+		case lit == "":
+			lit = tok.String()
+		}
+		b.WriteString(lit)
+		b.WriteString(" ")
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("error scanning file: %v", errs.Err())
+	}
+	out, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("error formatting file: %v", err)
+	}
+	return out, nil
+}
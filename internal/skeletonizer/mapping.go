@@ -0,0 +1,117 @@
+package skeletonizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Entry records the original name behind a placeholder
+type Entry struct {
+	Placeholder string `json:"placeholder"`
+	Kind        string `json:"kind"`
+	Original    string `json:"original"`
+}
+
+// Mapping assigns placeholders to original names and remembers them for de-anonymization
+type Mapping struct {
+	byKey    map[string]string // kind + "\x00" + original -> placeholder
+	entries  []Entry
+	counters map[string]int // counter group -> next index
+}
+
+// NewMapping returns an empty mapping
+func NewMapping() *Mapping {
+	return &Mapping{
+		byKey:    make(map[string]string),
+		counters: make(map[string]int),
+	}
+}
+
+// LoadMapping reads a mapping file written by WriteFile so that numbering continues across files
+func LoadMapping(filename string) (*Mapping, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error decoding mapping %s: %v", filename, err)
+	}
+	m := NewMapping()
+	for _, e := range entries {
+		prefix, n, ok := splitPlaceholder(e.Placeholder)
+		if !ok {
+			return nil, fmt.Errorf("invalid placeholder %q in %s", e.Placeholder, filename)
+		}
+		m.byKey[e.Kind+"\x00"+e.Original] = e.Placeholder
+		m.entries = append(m.entries, e)
+		group := counterGroup(prefix)
+		if n+1 > m.counters[group] {
+			m.counters[group] = n + 1
+		}
+	}
+	return m, nil
+}
+
+// WriteFile writes the mapping as JSON, readable only by the owner
+func (m *Mapping) WriteFile(filename string) error {
+	data, err := json.MarshalIndent(m.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o600)
+}
+
+// Entries returns the mapping entries sorted by placeholder
+func (m *Mapping) Entries() []Entry {
+	entries := make([]Entry, len(m.entries))
+	copy(entries, m.entries)
+	sort.Slice(entries, func(i, j int) bool {
+		pi, ni, _ := splitPlaceholder(entries[i].Placeholder)
+		pj, nj, _ := splitPlaceholder(entries[j].Placeholder)
+		if pi != pj {
+			return pi < pj
+		}
+		return ni < nj
+	})
+	return entries
+}
+
+// Original returns the original name behind a placeholder
+func (m *Mapping) Original(placeholder string) (string, bool) {
+	for _, e := range m.entries {
+		if e.Placeholder == placeholder {
+			return e.Original, true
+		}
+	}
+	return "", false
+}
+
+// lookup returns the placeholder for an original name, allocating one with prefix if needed
+func (m *Mapping) lookup(kind, original, prefix string) string {
+	key := kind + "\x00" + original
+	if p, ok := m.byKey[key]; ok {
+		return p
+	}
+	group := counterGroup(prefix)
+	if _, ok := m.counters[group]; !ok && prefix == prefixWrapper {
+		// The dataset numbers wrappers from 1
+		m.counters[group] = 1
+	}
+	p := fmt.Sprintf("%s%d", prefix, m.counters[group])
+	m.counters[group]++
+	m.byKey[key] = p
+	m.entries = append(m.entries, Entry{Placeholder: p, Kind: kind, Original: original})
+	return p
+}
+
+// counterGroup returns the numbering group of a prefix; values and functions share one counter
+func counterGroup(prefix string) string {
+	switch prefix {
+	case prefixValue, prefixFunc, prefixExported:
+		return prefixValue
+	}
+	return prefix
+}
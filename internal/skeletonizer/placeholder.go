@@ -0,0 +1,122 @@
+package skeletonizer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Placeholder prefixes used by the dataset
+const (
+	prefixValue       = "v"
+	prefixFunc        = "func"
+	prefixExported    = "Func"
+	prefixPackage     = "pkg"
+	prefixType        = "type"
+	prefixWrapper     = "Wrapper"
+	prefixRacy        = "racyVar"
+	prefixStringConst = "StringConst"
+	prefixIntConst    = "IntConst"
+	prefixFloatConst  = "FloatConst"
+)
+
+var placeholderPattern = regexp.MustCompile(`^(v|func|Func|pkg|type|Wrapper|racyVar|StringConst|IntConst|FloatConst)([0-9]+)$`)
+
+// IsPlaceholder reports whether name follows the dataset's placeholder grammar
+func IsPlaceholder(name string) bool {
+	return placeholderPattern.MatchString(name)
+}
+
+// IsStringPlaceholder reports whether a quoted string literal is a StringConstN placeholder
+func IsStringPlaceholder(lit string) bool {
+	s, err := strconv.Unquote(lit)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(s, prefixStringConst) && IsPlaceholder(s)
+}
+
+// PlaceholderClass returns the prefix of a placeholder, such as v for v12
+// or racyVar for racyVar0, or "" if name is not a placeholder
+func PlaceholderClass(name string) string {
+	prefix, _, ok := splitPlaceholder(name)
+	if !ok {
+		return ""
+	}
+	return prefix
+}
+
+// splitPlaceholder returns the prefix and index of a placeholder name
+func splitPlaceholder(name string) (string, int, bool) {
+	m := placeholderPattern.FindStringSubmatch(name)
+	if m == nil {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return m[1], n, true
+}
+
+// ConcurrencyPackages lists the import paths whose identifiers are kept verbatim
+var ConcurrencyPackages = map[string]bool{
+	"sync":                             true,
+	"sync/atomic":                      true,
+	"golang.org/x/sync/errgroup":       true,
+	"golang.org/x/sync/semaphore":      true,
+	"golang.org/x/sync/singleflight":   true,
+	"go.uber.org/atomic":               true,
+	"github.com/uber-go/atomic":        true,
+	"golang.org/x/sync/syncmap":        true,
+	"github.com/sourcegraph/conc":      true,
+	"github.com/sourcegraph/conc/pool": true,
+}
+
+// ConcurrencyNames lists the package names of ConcurrencyPackages as they appear in code
+var ConcurrencyNames = map[string]bool{
+	"sync":         true,
+	"atomic":       true,
+	"errgroup":     true,
+	"semaphore":    true,
+	"singleflight": true,
+	"syncmap":      true,
+	"conc":         true,
+	"pool":         true,
+}
+
+// ConcurrencyMethods lists method names that are kept when called on any receiver
+var ConcurrencyMethods = map[string]bool{
+	"Go":       true,
+	"Wait":     true,
+	"Done":     true,
+	"Add":      true,
+	"Lock":     true,
+	"Unlock":   true,
+	"RLock":    true,
+	"RUnlock":  true,
+	"TryLock":  true,
+	"TryRLock": true,
+	"Do":       true,
+	"SetLimit": true,
+	"TryGo":    true,
+}
+
+// predeclared lists the universe identifiers that are kept as is
+var predeclared = map[string]bool{
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true,
+	"copy": true, "delete": true, "imag": true, "len": true, "make": true,
+	"max": true, "min": true, "new": true, "panic": true, "print": true,
+	"println": true, "real": true, "recover": true,
+	"bool": true, "byte": true, "comparable": true, "complex64": true,
+	"complex128": true, "float32": true, "float64": true, "int": true,
+	"int8": true, "int16": true, "int32": true, "int64": true, "rune": true,
+	"string": true, "uint": true, "uint8": true, "uint16": true, "uint32": true,
+	"uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true, "_": true,
+}
+
+// IsPredeclared reports whether name is a universe identifier kept by the skeletonizer
+func IsPredeclared(name string) bool {
+	return predeclared[name]
+}
@@ -0,0 +1,457 @@
+package skeletonizer
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/slicer"
+)
+
+// SkeletonPackage is the package clause used by every skeleton
+const SkeletonPackage = "skeleton"
+
+// Position identifies an identifier by its 1-based line and column
+type Position struct {
+	Line   int
+	Column int
+}
+
+// ParsePosition parses a "line:column" string
+func ParsePosition(s string) (Position, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return Position{}, fmt.Errorf("invalid position %q, want line:column", s)
+	}
+	line, err := strconv.Atoi(parts[0])
+	if err != nil || line <= 0 {
+		return Position{}, fmt.Errorf("invalid line in position %q", s)
+	}
+	col, err := strconv.Atoi(parts[1])
+	if err != nil || col <= 0 {
+		return Position{}, fmt.Errorf("invalid column in position %q", s)
+	}
+	return Position{Line: line, Column: col}, nil
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Options controls how a file is skeletonized
+type Options struct {
+	Racy      []Position // Positions of the racy variables, in racyVarN order
+	WholeFile bool       // Keep every declaration instead of only those enclosing a racy variable
+	Slice     bool       // Reduce kept functions to the statements relevant to the racy variables
+}
+
+// Kinds of mapping entries
+const (
+	KindValue   = "value"
+	KindFunc    = "func"
+	KindType    = "type"
+	KindPackage = "package"
+	KindWrapper = "wrapper"
+	KindRacy    = "racy"
+	KindString  = "string"
+	KindInt     = "int"
+	KindFloat   = "float"
+)
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// Skeletonize anonymizes a Go source file into the dataset's placeholder format.
+// Placeholders are allocated from m, so the same mapping can be shared by both files of a pair.
+func Skeletonize(filename string, src []byte, m *Mapping, opts Options) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing file: %v", err)
+	}
+
+	var racy []racyVar
+	names := make(map[string]bool)
+	var enclosing []ast.Decl
+	for _, pos := range opts.Racy {
+		ident := identAt(fset, file, pos)
+		if ident == nil {
+			return nil, fmt.Errorf("no identifier at %s in %s", pos, filename)
+		}
+		r := racyVar{name: ident.Name, obj: ident.Obj, placeholder: m.lookup(KindRacy, ident.Name, prefixRacy)}
+		if sel := selectorOf(file, ident); sel != nil {
+			r.obj, r.x = nil, types.ExprString(sel.X)
+		}
+		racy = append(racy, r)
+		names[ident.Name] = true
+		for _, decl := range file.Decls {
+			if decl.Pos() <= ident.Pos() && ident.End() <= decl.End() && !containsDecl(enclosing, decl) {
+				enclosing = append(enclosing, decl)
+			}
+		}
+	}
+
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+		if opts.WholeFile || len(opts.Racy) == 0 || containsDecl(enclosing, decl) {
+			decls = append(decls, decl)
+		}
+	}
+
+	if opts.Slice {
+		var sliced []string
+		for name := range names {
+			sliced = append(sliced, name)
+		}
+		sort.Strings(sliced)
+		for _, decl := range decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				slicer.Func(fn, sliced)
+			}
+		}
+	}
+
+	s := &skeletonizer{
+		mapping:  m,
+		racy:     racy,
+		imports:  importNames(file),
+		types:    make(map[*ast.Ident]bool),
+		funcs:    make(map[*ast.Ident]bool),
+		wrappers: make(map[string]bool),
+		parents:  make(map[ast.Node]ast.Node),
+	}
+	out := &ast.File{Name: ast.NewIdent(SkeletonPackage), Decls: decls}
+	s.prepare(out)
+	s.rewrite(out)
+
+	if opts.Slice {
+		sliced, err := slicer.Print(fset, out)
+		if err != nil {
+			return nil, fmt.Errorf("error printing skeleton: %v", err)
+		}
+		return sliced, nil
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, out); err != nil {
+		return nil, fmt.Errorf("error printing skeleton: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// identAt returns the identifier covering pos
+func identAt(fset *token.FileSet, file *ast.File, pos Position) *ast.Ident {
+	var found *ast.Ident
+	ast.Inspect(file, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		p := fset.Position(ident.Pos())
+		if p.Line == pos.Line && p.Column <= pos.Column && pos.Column < p.Column+len(ident.Name) {
+			found = ident
+		}
+		return true
+	})
+	return found
+}
+
+// selectorOf returns the selector expression whose selected field is ident, or nil
+func selectorOf(file *ast.File, ident *ast.Ident) *ast.SelectorExpr {
+	var found *ast.SelectorExpr
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok && sel.Sel == ident {
+			found = sel
+		}
+		return found == nil
+	})
+	return found
+}
+
+func containsDecl(decls []ast.Decl, decl ast.Decl) bool {
+	for _, d := range decls {
+		if d == decl {
+			return true
+		}
+	}
+	return false
+}
+
+// importNames maps the local name of every import to its path
+func importNames(file *ast.File) map[string]string {
+	names := make(map[string]string)
+	for _, spec := range file.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(p)
+		if majorVersion.MatchString(name) && path.Dir(p) != "." {
+			name = path.Base(path.Dir(p))
+		}
+		name = strings.TrimPrefix(name, "go-")
+		name = strings.Map(func(r rune) rune {
+			if r == '-' || r == '.' {
+				return -1
+			}
+			return r
+		}, name)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		names[name] = p
+	}
+	return names
+}
+
+// racyVar is a racy variable given by the position of one of its
+// identifiers. A variable is matched by its declaration, or by name when the
+// parser did not resolve it, and a field by the expression it is selected
+// from, along with the declarations of fields of its name.
+type racyVar struct {
+	name        string
+	obj         *ast.Object
+	x           string // Operand of a field, or "" for a variable
+	placeholder string
+}
+
+// matches reports whether an identifier is an occurrence of the racy
+// variable; sel is the selector expression selecting it, if any, and field
+// is set when it declares a struct field
+func (r racyVar) matches(ident *ast.Ident, sel *ast.SelectorExpr, field bool) bool {
+	switch {
+	case ident.Name != r.name:
+		return false
+	case r.x == "":
+		return sel == nil && !field && ident.Obj == r.obj
+	case field:
+		return true
+	}
+	return sel != nil && types.ExprString(sel.X) == r.x
+}
+
+// skeletonizer rewrites the identifiers and literals of one file
+type skeletonizer struct {
+	mapping  *Mapping
+	racy     []racyVar
+	imports  map[string]string     // import name -> path
+	types    map[*ast.Ident]bool   // identifiers in type position
+	funcs    map[*ast.Ident]bool   // identifiers naming functions or methods
+	wrappers map[string]bool       // names used as receivers of spawner calls
+	parents  map[ast.Node]ast.Node // child -> parent
+}
+
+// prepare records parents and classifies identifiers before any of them is renamed
+func (s *skeletonizer) prepare(file *ast.File) {
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if len(stack) > 0 {
+			s.parents[n] = stack[len(stack)-1]
+		}
+		stack = append(stack, n)
+
+		switch n := n.(type) {
+		case *ast.Field:
+			s.markType(n.Type)
+			if _, ok := n.Type.(*ast.FuncType); ok && len(stack) >= 3 {
+				if _, ok := stack[len(stack)-3].(*ast.InterfaceType); ok {
+					for _, name := range n.Names {
+						s.funcs[name] = true
+					}
+				}
+			}
+		case *ast.ValueSpec:
+			s.markType(n.Type)
+		case *ast.TypeSpec:
+			s.types[n.Name] = true
+			s.markType(n.Type)
+		case *ast.CompositeLit:
+			s.markType(n.Type)
+		case *ast.TypeAssertExpr:
+			s.markType(n.Type)
+		case *ast.FuncDecl:
+			s.funcs[n.Name] = true
+		case *ast.CallExpr:
+			switch fun := n.Fun.(type) {
+			case *ast.Ident:
+				if (fun.Name == "make" || fun.Name == "new") && len(n.Args) > 0 {
+					s.markType(n.Args[0])
+				} else {
+					s.funcs[fun] = true
+				}
+			case *ast.SelectorExpr:
+				s.funcs[fun.Sel] = true
+				if x, ok := fun.X.(*ast.Ident); ok && (fun.Sel.Name == "Go" || fun.Sel.Name == "TryGo") {
+					if _, isImport := s.imports[x.Name]; !isImport {
+						s.wrappers[x.Name] = true
+					}
+				}
+			case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.ParenExpr, *ast.StarExpr:
+				s.markType(fun)
+			}
+		}
+		return true
+	})
+}
+
+// markType marks the identifiers of a type expression
+func (s *skeletonizer) markType(expr ast.Expr) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		s.types[t] = true
+	case *ast.StarExpr:
+		s.markType(t.X)
+	case *ast.ParenExpr:
+		s.markType(t.X)
+	case *ast.ArrayType:
+		s.markType(t.Elt)
+	case *ast.MapType:
+		s.markType(t.Key)
+		s.markType(t.Value)
+	case *ast.ChanType:
+		s.markType(t.Value)
+	case *ast.Ellipsis:
+		s.markType(t.Elt)
+	case *ast.IndexExpr:
+		s.markType(t.X)
+		s.markType(t.Index)
+	case *ast.IndexListExpr:
+		s.markType(t.X)
+		for _, index := range t.Indices {
+			s.markType(index)
+		}
+	}
+}
+
+// rewrite replaces identifiers and literals with placeholders.
+// Names are computed before any identifier changes, since selectors look at their operand.
+func (s *skeletonizer) rewrite(file *ast.File) {
+	names := make(map[*ast.Ident]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.File:
+			return true
+		case *ast.Field:
+			n.Tag = nil
+		case *ast.BasicLit:
+			s.rewriteLit(n)
+		case *ast.Ident:
+			if n != file.Name {
+				names[n] = s.placeholder(n)
+			}
+		}
+		return true
+	})
+	for ident, name := range names {
+		ident.Name = name
+	}
+}
+
+func (s *skeletonizer) rewriteLit(lit *ast.BasicLit) {
+	switch lit.Kind {
+	case token.STRING:
+		lit.Value = strconv.Quote(s.mapping.lookup(KindString, lit.Value, prefixStringConst))
+	case token.INT, token.CHAR:
+		lit.Value = s.mapping.lookup(KindInt, lit.Value, prefixIntConst)
+	case token.FLOAT, token.IMAG:
+		lit.Value = s.mapping.lookup(KindFloat, lit.Value, prefixFloatConst)
+	}
+}
+
+// placeholder returns the new name of an identifier
+func (s *skeletonizer) placeholder(ident *ast.Ident) string {
+	name := ident.Name
+	sel, ok := s.parents[ident].(*ast.SelectorExpr)
+	var selected *ast.SelectorExpr
+	if ok && sel.Sel == ident {
+		selected = sel
+	}
+	field := false
+	if f, ok := s.parents[ident].(*ast.Field); ok {
+		_, field = s.parents[s.parents[f]].(*ast.StructType)
+	}
+	for _, r := range s.racy {
+		if r.matches(ident, selected, field) {
+			return r.placeholder
+		}
+	}
+	if name == "_" {
+		return name
+	}
+
+	if ok {
+		if selected != nil {
+			return s.selected(sel)
+		}
+		if p, ok := s.imports[name]; ok {
+			if ConcurrencyPackages[p] {
+				return name
+			}
+			return s.mapping.lookup(KindPackage, p, prefixPackage)
+		}
+	}
+
+	switch {
+	case predeclared[name]:
+		return name
+	case s.wrappers[name]:
+		return s.mapping.lookup(KindWrapper, name, prefixWrapper)
+	case s.types[ident]:
+		return s.mapping.lookup(KindType, name, prefixType)
+	case s.funcs[ident]:
+		return s.function(name)
+	}
+	return s.mapping.lookup(KindValue, name, prefixValue)
+}
+
+// selected returns the new name of the selector in a selector expression
+func (s *skeletonizer) selected(sel *ast.SelectorExpr) string {
+	name := sel.Sel.Name
+	if x, ok := sel.X.(*ast.Ident); ok {
+		if p, ok := s.imports[x.Name]; ok {
+			if ConcurrencyPackages[p] {
+				return name
+			}
+			if s.funcs[sel.Sel] {
+				return s.function(name)
+			}
+			return s.mapping.lookup(KindValue, name, prefixValue)
+		}
+	}
+	if s.funcs[sel.Sel] {
+		if ConcurrencyMethods[name] {
+			return name
+		}
+		return s.function(name)
+	}
+	return s.mapping.lookup(KindValue, name, prefixValue)
+}
+
+// function returns the placeholder of a function, keeping its exportedness
+func (s *skeletonizer) function(name string) string {
+	prefix := prefixFunc
+	if ast.IsExported(name) {
+		prefix = prefixExported
+	}
+	return s.mapping.lookup(KindFunc, name, prefix)
+}
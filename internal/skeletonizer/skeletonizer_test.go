@@ -0,0 +1,255 @@
+package skeletonizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSkeletonize(t *testing.T) {
+	src, err := os.ReadFile("testdata/input.go")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	m := NewMapping()
+	out, err := Skeletonize("testdata/input.go", src, m, Options{Racy: []Position{{Line: 18, Column: 6}}})
+	if err != nil {
+		t.Fatalf("Skeletonize() error = %v", err)
+	}
+	got := string(out)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "package clause", want: "package skeleton\n"},
+		{name: "racy variable", want: "racyVar0 = append(racyVar0, v8)"},
+		{name: "receiver type", want: "func (v0 *type0) Func1("},
+		{name: "imported package", want: "v2 pkg0.v3"},
+		{name: "concurrency package kept", want: "var v6 sync.Mutex"},
+		{name: "errgroup kept", want: "Wrapper1, v2 := errgroup.WithContext(v2)"},
+		{name: "spawner call kept", want: "Wrapper1.Go(func() type1 {"},
+		{name: "lock calls kept", want: "defer v6.Unlock()"},
+		{name: "string literal", want: `"StringConst0"`},
+		{name: "int literal", want: "racyVar0[:IntConst0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Skeletonize() missing %q in:\n%s", tt.want, got)
+			}
+		})
+	}
+
+	for _, leaked := range []string{"FetchAll", "orders", "storage", "Fetcher", "helper", "//"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("Skeletonize() leaked %q in:\n%s", leaked, got)
+		}
+	}
+	if original, ok := m.Original("racyVar0"); !ok || original != "orders" {
+		t.Errorf("Original(racyVar0) = %q, %v, want orders", original, ok)
+	}
+}
+
+func TestSkeletonizeErrors(t *testing.T) {
+	src, err := os.ReadFile("testdata/input.go")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if _, err := Skeletonize("testdata/input.go", src, NewMapping(), Options{Racy: []Position{{Line: 2, Column: 1}}}); err == nil {
+		t.Errorf("Skeletonize() expected error for position without identifier")
+	}
+	if _, err := Skeletonize("broken.go", []byte("package"), NewMapping(), Options{}); err == nil {
+		t.Errorf("Skeletonize() expected parse error")
+	}
+}
+
+func TestMappingRoundTrip(t *testing.T) {
+	src, err := os.ReadFile("testdata/input.go")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	m := NewMapping()
+	if _, err := Skeletonize("testdata/input.go", src, m, Options{Racy: []Position{{Line: 18, Column: 6}}}); err != nil {
+		t.Fatalf("Skeletonize() error = %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "mapping.json")
+	if err := m.WriteFile(filename); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mapping permissions = %v, want 0600", perm)
+	}
+
+	loaded, err := LoadMapping(filename)
+	if err != nil {
+		t.Fatalf("LoadMapping() error = %v", err)
+	}
+	// The second file of a pair must reuse names and continue numbering
+	out, err := Skeletonize("testdata/input.go", src, loaded, Options{Racy: []Position{{Line: 18, Column: 6}}, WholeFile: true})
+	if err != nil {
+		t.Fatalf("Skeletonize() error = %v", err)
+	}
+	got := string(out)
+	if !strings.Contains(got, "racyVar0 = append(racyVar0, v8)") {
+		t.Errorf("Skeletonize() did not reuse mapping:\n%s", got)
+	}
+	if !strings.Contains(got, `return "StringConst1"`) {
+		t.Errorf("Skeletonize() did not continue numbering:\n%s", got)
+	}
+}
+
+func TestIsPlaceholder(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "v12", want: true},
+		{name: "Func3", want: true},
+		{name: "racyVar0", want: true},
+		{name: "Wrapper1", want: true},
+		{name: "IntConst4", want: true},
+		{name: "orders", want: false},
+		{name: "v", want: false},
+		{name: "pkgX", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsPlaceholder(tt.name); got != tt.want {
+			t.Errorf("IsPlaceholder(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if !IsStringPlaceholder(`"StringConst7"`) || IsStringPlaceholder(`"orders"`) {
+		t.Errorf("IsStringPlaceholder() misclassified literals")
+	}
+	for name, want := range map[string]string{"v12": "v", "Func3": "Func", "racyVar0": "racyVar", "orders": ""} {
+		if got := PlaceholderClass(name); got != want {
+			t.Errorf("PlaceholderClass(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSkeletonizeSlice(t *testing.T) {
+	src, err := os.ReadFile("testdata/input.go")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	out, err := Skeletonize("testdata/input.go", src, NewMapping(), Options{Racy: []Position{{Line: 18, Column: 6}}, Slice: true})
+	if err != nil {
+		t.Fatalf("Skeletonize() error = %v", err)
+	}
+	got := string(out)
+	if !strings.Contains(got, "racyVar0 = append(racyVar0, v8)") {
+		t.Errorf("Skeletonize() dropped the racy write:\n%s", got)
+	}
+	if strings.Contains(got, "\n\n\t}") || strings.Contains(got, "{\n\n") {
+		t.Errorf("Skeletonize() left blank lines at block edges:\n%s", got)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	a := `package skeleton
+
+func func4(v7 pkg3.v2) type5 {
+	// comment
+	racyVar1 = v7.Func9("StringConst3", IntConst2)
+	Wrapper3.Go(func() type5 { return v7.Func9(nil, v11) })
+	return racyVar1
+}
+`
+	b := `package skeleton
+
+func func1(v0 pkg0.v9) type0 {
+	racyVar0 = v0.Func2("StringConst0", IntConst5)
+	Wrapper1.Go(func() type0 {
+		return v0.Func2(nil, v3)
+	})
+	return racyVar0
+}
+`
+	want := `package skeleton
+
+func func0(v1 pkg0.v2) type0 {
+	racyVar0 = v1.Func3("StringConst0", IntConst0)
+	Wrapper1.Go(func() type0 {
+		return v1.Func3(nil, v4)
+	})
+	return racyVar0
+}
+`
+	gotA, err := Canonicalize([]byte(a), NewMapping())
+	if err != nil {
+		t.Fatalf("Canonicalize() error = %v", err)
+	}
+	if string(gotA) != want {
+		t.Errorf("Canonicalize() =\n%s\nwant\n%s", gotA, want)
+	}
+	gotB, err := Canonicalize([]byte(b), NewMapping())
+	if err != nil {
+		t.Fatalf("Canonicalize() error = %v", err)
+	}
+	if string(gotB) != want {
+		t.Errorf("Canonicalize() of a differently laid out skeleton =\n%s\nwant\n%s", gotB, want)
+	}
+	// Files sharing a mapping continue its numbering
+	m := NewMapping()
+	if _, err := Canonicalize([]byte(a), m); err != nil {
+		t.Fatalf("Canonicalize() error = %v", err)
+	}
+	second, err := Canonicalize([]byte("package skeleton\n\nfunc func4() { v30 = racyVar1 }\n"), m)
+	if err != nil {
+		t.Fatalf("Canonicalize() error = %v", err)
+	}
+	if !strings.Contains(string(second), "func func0() {\n\tv5 = racyVar0\n}") {
+		t.Errorf("Canonicalize() with a shared mapping =\n%s", second)
+	}
+	if _, err := Canonicalize([]byte("package skeleton\n\nfunc func1() {\n"), NewMapping()); err == nil {
+		t.Errorf("Canonicalize() accepted an unterminated function")
+	}
+}
+
+func TestSkeletonizeShadowed(t *testing.T) {
+	src, err := os.ReadFile("testdata/shadow.go")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	tests := []struct {
+		name string
+		racy Position
+		want []string
+	}{
+		{
+			name: "variable",
+			racy: Position{Line: 12, Column: 3},
+			want: []string{"var racyVar0 type1", "\tracyVar0 = ", "return racyVar0"},
+		},
+		{
+			name: "field",
+			racy: Position{Line: 16, Column: 5},
+			want: []string{"\tracyVar0 type1\n", ".racyVar0 }", ".racyVar0 = "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Skeletonize("testdata/shadow.go", src, NewMapping(), Options{Racy: []Position{tt.racy}, WholeFile: true})
+			if err != nil {
+				t.Fatalf("Skeletonize() error = %v", err)
+			}
+			got := string(out)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Skeletonize() missing %q in:\n%s", want, got)
+				}
+			}
+			if n := strings.Count(got, "racyVar0"); n != len(tt.want) {
+				t.Errorf("Skeletonize() renamed %d identifiers to racyVar0, want %d:\n%s", n, len(tt.want), got)
+			}
+		})
+	}
+}
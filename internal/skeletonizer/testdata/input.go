@@ -0,0 +1,44 @@
+package orders
+
+import (
+	"context"
+	"sync"
+
+	"github.com/example/storage"
+	"golang.org/x/sync/errgroup"
+)
+
+// Fetcher loads orders from storage
+type Fetcher struct {
+	client *storage.Client
+	limit  int
+}
+
+func (f *Fetcher) FetchAll(ctx context.Context, ids []string) ([]*storage.Order, error) {
+	var orders []*storage.Order
+	var mu sync.Mutex
+	group, ctx := errgroup.WithContext(ctx)
+	for _, id := range ids {
+		group.Go(func() error {
+			order, err := f.client.Get(ctx, id, "orders")
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			orders = append(orders, order)
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	if len(orders) > f.limit {
+		return orders[:42], nil
+	}
+	return orders, nil
+}
+
+func helper() string {
+	return "unrelated"
+}
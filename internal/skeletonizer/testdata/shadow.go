@@ -0,0 +1,20 @@
+package cache
+
+type Loader struct {
+	err error
+}
+
+func (s *Loader) check() error { return s.err }
+
+func (s *Loader) Load(done chan struct{}) error {
+	var err error
+	go func() {
+		err = s.check()
+		close(done)
+	}()
+	if err := s.check(); err != nil {
+		s.err = err
+	}
+	<-done
+	return err
+}
@@ -0,0 +1,646 @@
+package slicer
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// syncMethods lists method names treated as synchronization or spawning
+var syncMethods = map[string]bool{
+	"Go":        true,
+	"TryGo":     true,
+	"Wait":      true,
+	"Done":      true,
+	"Add":       true,
+	"Lock":      true,
+	"Unlock":    true,
+	"RLock":     true,
+	"RUnlock":   true,
+	"TryLock":   true,
+	"Do":        true,
+	"SetLimit":  true,
+	"Acquire":   true,
+	"Release":   true,
+	"Signal":    true,
+	"Broadcast": true,
+}
+
+// syncPackages lists package names whose calls and types are synchronization
+var syncPackages = map[string]bool{
+	"sync":      true,
+	"atomic":    true,
+	"errgroup":  true,
+	"semaphore": true,
+}
+
+// RacyPrefix is the prefix of racy variables in skeletons
+const RacyPrefix = "racyVar"
+
+// File slices the named function of a Go source file.
+// The result keeps the package clause and imports, followed by the sliced function only.
+// An empty funcName selects the first function that mentions one of vars;
+// empty vars select the identifiers named racyVarN.
+func File(filename string, src []byte, funcName string, vars []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing file: %v", err)
+	}
+
+	var fn *ast.FuncDecl
+	for _, decl := range file.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Body == nil {
+			continue
+		}
+		if funcName != "" && funcName == FuncName(d) || funcName != "" && funcName == d.Name.Name ||
+			funcName == "" && mentions(d, vars) {
+			fn = d
+			break
+		}
+	}
+	if fn == nil {
+		if funcName == "" {
+			return nil, fmt.Errorf("no function in %s uses the racy variables", filename)
+		}
+		return nil, fmt.Errorf("function %s not found in %s", funcName, filename)
+	}
+	Func(fn, vars)
+
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			decls = append(decls, decl)
+		}
+	}
+	file.Decls = append(decls, fn)
+
+	out, err := Print(fset, file)
+	if err != nil {
+		return nil, fmt.Errorf("error printing slice: %v", err)
+	}
+	return out, nil
+}
+
+// Print formats a sliced file and tidies the blank lines dropped statements left
+func Print(fset *token.FileSet, file *ast.File) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return Tidy(buf.Bytes()), nil
+}
+
+// Tidy removes the blank lines that dropped statements leave at the start and end of blocks
+func Tidy(src []byte) []byte {
+	lines := bytes.Split(src, []byte("\n"))
+	var out [][]byte
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 && i > 0 && i+1 < len(lines) {
+			prev := bytes.TrimSpace(out[len(out)-1])
+			next := bytes.TrimSpace(lines[i+1])
+			if bytes.HasSuffix(prev, []byte("{")) || bytes.HasPrefix(next, []byte("}")) || len(next) == 0 {
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+	return bytes.Join(out, []byte("\n"))
+}
+
+// FuncName returns the name of a function as Recv.Method for methods
+func FuncName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	t := fn.Recv.List[0].Type
+	for {
+		switch r := t.(type) {
+		case *ast.StarExpr:
+			t = r.X
+			continue
+		case *ast.IndexExpr:
+			t = r.X
+			continue
+		case *ast.IndexListExpr:
+			t = r.X
+			continue
+		case *ast.Ident:
+			return r.Name + "." + fn.Name.Name
+		}
+		return fn.Name.Name
+	}
+}
+
+// mentions reports whether fn uses one of vars, or a racyVarN identifier if vars is empty
+func mentions(fn *ast.FuncDecl, vars []string) bool {
+	found := false
+	ast.Inspect(fn, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && isCriterion(ident.Name, vars) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func isCriterion(name string, vars []string) bool {
+	if len(vars) == 0 {
+		return strings.HasPrefix(name, RacyPrefix)
+	}
+	for _, v := range vars {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Func reduces the body of fn, in place, to the statements relevant to the racy variables:
+// statements that data- or control-depend on them, goroutine spawns, synchronization calls,
+// the control flow enclosing any of these, and the earlier definitions of the variables the
+// kept statements use. Empty vars select the racyVarN identifiers.
+func Func(fn *ast.FuncDecl, vars []string) {
+	if fn.Body == nil {
+		return
+	}
+	s := &slicer{
+		forward:  make(map[string]bool),
+		backward: make(map[string]bool),
+	}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && isCriterion(ident.Name, vars) {
+			s.forward[ident.Name] = true
+			s.backward[ident.Name] = true
+		}
+		return true
+	})
+	s.propagate(fn.Body)
+	fn.Body.List, _, _ = s.block(fn.Body.List, false)
+}
+
+// slicer holds the variables the slice depends on
+type slicer struct {
+	forward  map[string]bool // Variables whose values depend on the racy variables
+	backward map[string]bool // Variables the racy variables' values depend on
+}
+
+// unit is the access summary of one statement, excluding nested statements
+type unit struct {
+	reads  []string
+	writes []string
+}
+
+// propagate computes the forward and backward variable sets to a fixpoint
+func (s *slicer) propagate(body *ast.BlockStmt) {
+	var units []unit
+	ast.Inspect(body, func(n ast.Node) bool {
+		if stmt, ok := n.(ast.Stmt); ok {
+			units = append(units, access(stmt))
+		}
+		return true
+	})
+	for changed := true; changed; {
+		changed = false
+		for _, u := range units {
+			if intersects(u.writes, s.backward) {
+				changed = addAll(s.backward, u.reads) || changed
+			}
+			if intersects(u.reads, s.forward) {
+				changed = addAll(s.forward, u.writes) || changed
+			}
+		}
+	}
+}
+
+// relevant reports whether a statement's own accesses depend on the racy variables
+func (s *slicer) relevant(stmt ast.Stmt) bool {
+	u := access(stmt)
+	return intersects(u.writes, s.backward) || intersects(u.reads, s.forward)
+}
+
+// block slices a statement list. after reports whether relevant statements follow the list
+// in an enclosing block, which keeps early exits that they control-depend on.
+// It returns the kept statements and whether they are relevant or may exit.
+func (s *slicer) block(list []ast.Stmt, after bool) ([]ast.Stmt, bool, bool) {
+	kept := make([]ast.Stmt, len(list))
+	essential, exits := false, false
+	later := after
+	for i := len(list) - 1; i >= 0; i-- {
+		stmt, e, x := s.stmt(list[i], later)
+		if stmt == nil {
+			continue
+		}
+		if e || x && (later || isExit(stmt)) {
+			kept[i] = stmt
+			// Earlier statements defining the variables a kept statement
+			// uses reach it, so they are kept too
+			addAll(s.backward, uses(stmt))
+			essential = essential || e
+			exits = exits || x
+		}
+		later = later || e
+	}
+	var out []ast.Stmt
+	for _, stmt := range kept {
+		if stmt != nil {
+			out = append(out, stmt)
+		}
+	}
+	return out, essential, exits
+}
+
+// stmt slices one statement, returning nil when nothing in it is kept
+func (s *slicer) stmt(stmt ast.Stmt, after bool) (ast.Stmt, bool, bool) {
+	switch st := stmt.(type) {
+	case *ast.ReturnStmt, *ast.BranchStmt:
+		return st, s.relevant(st), true
+
+	case *ast.AssignStmt, *ast.IncDecStmt, *ast.DeclStmt, *ast.ExprStmt, *ast.SendStmt, *ast.GoStmt, *ast.DeferStmt:
+		essential := s.relevant(st) || isSync(st) || isSpawn(st)
+		for _, lit := range funcLits(st) {
+			var e bool
+			lit.Body.List, e, _ = s.block(lit.Body.List, false)
+			essential = essential || e
+		}
+		if !essential {
+			return nil, false, false
+		}
+		return st, true, false
+
+	case *ast.BlockStmt:
+		list, e, x := s.block(st.List, after)
+		if len(list) == 0 {
+			return nil, false, false
+		}
+		st.List = list
+		return st, e, x
+
+	case *ast.LabeledStmt:
+		inner, e, x := s.stmt(st.Stmt, after)
+		if inner == nil {
+			return nil, false, false
+		}
+		st.Stmt = inner
+		return st, e, x
+
+	case *ast.IfStmt:
+		// Statements guarded by a condition on the racy variables control-depend on them
+		if s.readsForward(st.Cond) {
+			return st, true, containsExit(st)
+		}
+		header := st.Init != nil && s.relevant(st.Init)
+		body, e, x := s.block(st.Body.List, after)
+		st.Body.List = body
+		if st.Else != nil {
+			els, ee, ex := s.stmt(st.Else, after)
+			st.Else = els
+			e, x = e || ee, x || ex
+		}
+		if !header && !e && !x {
+			return nil, false, false
+		}
+		return st, header || e, x
+
+	case *ast.ForStmt:
+		if s.readsForward(st.Cond) {
+			return st, true, containsReturn(st)
+		}
+		header := st.Init != nil && s.relevant(st.Init) || st.Post != nil && s.relevant(st.Post)
+		return s.loop(st, st.Body, header)
+
+	case *ast.RangeStmt:
+		if s.readsForward(st.X) {
+			return st, true, containsReturn(st)
+		}
+		return s.loop(st, st.Body, s.relevant(st))
+
+	case *ast.SwitchStmt:
+		if s.readsForward(st.Tag) {
+			return st, true, containsReturn(st)
+		}
+		header := st.Init != nil && s.relevant(st.Init)
+		return s.clauses(st, st.Body, after, header)
+
+	case *ast.TypeSwitchStmt:
+		if intersects(access(st.Assign).reads, s.forward) {
+			return st, true, containsReturn(st)
+		}
+		return s.clauses(st, st.Body, after, s.relevant(st.Assign))
+
+	case *ast.SelectStmt:
+		// Channel communication is synchronization, so a select is always kept
+		return s.clauses(st, st.Body, after, true)
+	}
+	return nil, false, false
+}
+
+// loop slices a loop body; loop bodies run again after themselves, so early exits are kept.
+// header reports whether the loop header itself is relevant.
+func (s *slicer) loop(loop ast.Stmt, body *ast.BlockStmt, header bool) (ast.Stmt, bool, bool) {
+	list, e, _ := s.block(body.List, true)
+	body.List = list
+	x := containsReturn(body)
+	if !header && !e && !x {
+		return nil, false, false
+	}
+	return loop, header || e, x
+}
+
+// clauses slices the clauses of a switch or select statement
+func (s *slicer) clauses(stmt ast.Stmt, body *ast.BlockStmt, after, header bool) (ast.Stmt, bool, bool) {
+	essential := header
+	for _, clause := range body.List {
+		switch c := clause.(type) {
+		case *ast.CaseClause:
+			var e bool
+			c.Body, e, _ = s.block(c.Body, after)
+			essential = essential || e
+		case *ast.CommClause:
+			var e bool
+			c.Body, e, _ = s.block(c.Body, after)
+			essential = essential || e
+		}
+	}
+	x := containsReturn(body)
+	if !essential && !x {
+		return nil, false, false
+	}
+	return stmt, essential, x
+}
+
+func (s *slicer) readsForward(expr ast.Expr) bool {
+	if expr == nil {
+		return false
+	}
+	return intersects(idents(expr), s.forward)
+}
+
+// access returns the variables a statement reads and writes, ignoring nested statements
+func access(stmt ast.Stmt) unit {
+	var u unit
+	switch st := stmt.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range st.Lhs {
+			root, rest := splitRoot(lhs)
+			if root != "" {
+				u.writes = append(u.writes, root)
+				if st.Tok != token.ASSIGN && st.Tok != token.DEFINE {
+					u.reads = append(u.reads, root)
+				}
+			}
+			u.reads = append(u.reads, rest...)
+		}
+		for _, rhs := range st.Rhs {
+			u.reads = append(u.reads, idents(rhs)...)
+		}
+	case *ast.IncDecStmt:
+		root, rest := splitRoot(st.X)
+		if root != "" {
+			u.writes = append(u.writes, root)
+			u.reads = append(u.reads, root)
+		}
+		u.reads = append(u.reads, rest...)
+	case *ast.DeclStmt:
+		if gen, ok := st.Decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for _, name := range vs.Names {
+					u.writes = append(u.writes, name.Name)
+				}
+				for _, value := range vs.Values {
+					u.reads = append(u.reads, idents(value)...)
+				}
+			}
+		}
+	case *ast.RangeStmt:
+		for _, e := range []ast.Expr{st.Key, st.Value} {
+			if e == nil {
+				continue
+			}
+			root, rest := splitRoot(e)
+			if root != "" {
+				u.writes = append(u.writes, root)
+			}
+			u.reads = append(u.reads, rest...)
+		}
+		u.reads = append(u.reads, idents(st.X)...)
+	case *ast.ExprStmt:
+		u.reads = idents(st.X)
+	case *ast.SendStmt:
+		u.reads = append(idents(st.Chan), idents(st.Value)...)
+	case *ast.ReturnStmt:
+		for _, result := range st.Results {
+			u.reads = append(u.reads, idents(result)...)
+		}
+	case *ast.GoStmt:
+		u.reads = idents(st.Call)
+	case *ast.DeferStmt:
+		u.reads = idents(st.Call)
+	case *ast.IfStmt:
+		u.reads = idents(st.Cond)
+	case *ast.ForStmt:
+		if st.Cond != nil {
+			u.reads = idents(st.Cond)
+		}
+	case *ast.SwitchStmt:
+		if st.Tag != nil {
+			u.reads = idents(st.Tag)
+		}
+	case *ast.CaseClause:
+		for _, e := range st.List {
+			u.reads = append(u.reads, idents(e)...)
+		}
+	}
+	return u
+}
+
+// splitRoot returns the variable an lvalue writes and the variables it reads on the way
+func splitRoot(expr ast.Expr) (string, []string) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if e.Name == "_" {
+			return "", nil
+		}
+		return e.Name, nil
+	case *ast.SelectorExpr:
+		return splitRoot(e.X)
+	case *ast.IndexExpr:
+		root, rest := splitRoot(e.X)
+		return root, append(rest, idents(e.Index)...)
+	case *ast.StarExpr:
+		return splitRoot(e.X)
+	case *ast.ParenExpr:
+		return splitRoot(e.X)
+	}
+	return "", idents(expr)
+}
+
+// idents returns the variable-like identifiers of an expression, outside function literals
+func idents(node ast.Node) []string {
+	var names []string
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.SelectorExpr:
+			names = append(names, idents(n.X)...)
+			return false
+		case *ast.KeyValueExpr:
+			if _, ok := n.Key.(*ast.Ident); ok {
+				names = append(names, idents(n.Value)...)
+				return false
+			}
+		case *ast.Ident:
+			if n.Name != "_" {
+				names = append(names, n.Name)
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// uses returns the variable-like identifiers of a statement, including
+// those of the function literals in it
+func uses(stmt ast.Stmt) []string {
+	var names []string
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			names = append(names, uses(&ast.ExprStmt{X: n.X})...)
+			return false
+		case *ast.KeyValueExpr:
+			if _, ok := n.Key.(*ast.Ident); ok {
+				names = append(names, uses(&ast.ExprStmt{X: n.Value})...)
+				return false
+			}
+		case *ast.Ident:
+			if n.Name != "_" {
+				names = append(names, n.Name)
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// funcLits returns the function literals of a statement that are not nested in other literals
+func funcLits(stmt ast.Stmt) []*ast.FuncLit {
+	var lits []*ast.FuncLit
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.FuncLit); ok {
+			lits = append(lits, lit)
+			return false
+		}
+		return true
+	})
+	return lits
+}
+
+// isSync reports whether a statement synchronizes, outside function literals
+func isSync(stmt ast.Stmt) bool {
+	if _, ok := stmt.(*ast.SendStmt); ok {
+		return true
+	}
+	found := false
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.UnaryExpr:
+			found = found || n.Op == token.ARROW
+		case *ast.CallExpr:
+			if ident, ok := n.Fun.(*ast.Ident); ok && ident.Name == "close" {
+				found = true
+			}
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok && syncPackages[x.Name] {
+				found = true
+			}
+			if syncMethods[n.Sel.Name] {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// isSpawn reports whether a statement starts a goroutine directly or through a spawner
+func isSpawn(stmt ast.Stmt) bool {
+	switch st := stmt.(type) {
+	case *ast.GoStmt:
+		return true
+	case *ast.ExprStmt:
+		if call, ok := st.X.(*ast.CallExpr); ok {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+				return sel.Sel.Name == "Go" || sel.Sel.Name == "TryGo"
+			}
+		}
+	}
+	return false
+}
+
+func isExit(stmt ast.Stmt) bool {
+	switch stmt.(type) {
+	case *ast.ReturnStmt, *ast.BranchStmt:
+		return true
+	}
+	return false
+}
+
+// containsExit reports whether a statement contains a return or branch outside function literals
+func containsExit(node ast.Node) bool {
+	return contains(node, func(n ast.Node) bool {
+		return isExit(n.(ast.Stmt))
+	})
+}
+
+// containsReturn reports whether a statement contains a return outside function literals
+func containsReturn(node ast.Node) bool {
+	return contains(node, func(n ast.Node) bool {
+		_, ok := n.(*ast.ReturnStmt)
+		return ok
+	})
+}
+
+func contains(node ast.Node, match func(ast.Node) bool) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		if _, ok := n.(ast.Stmt); ok && match(n) {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func intersects(names []string, set map[string]bool) bool {
+	for _, name := range names {
+		if set[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// addAll adds names to set and reports whether the set grew
+func addAll(set map[string]bool, names []string) bool {
+	grew := false
+	for _, name := range names {
+		if !set[name] {
+			set[name] = true
+			grew = true
+		}
+	}
+	return grew
+}
@@ -0,0 +1,129 @@
+package slicer
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uber/data-race-skeletons/internal/analyzer"
+)
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		funcName string
+		vars     []string
+		keep     []string
+		drop     []string
+	}{
+		{
+			name:     "real source",
+			filename: "testdata/input.go",
+			funcName: "Service.Process",
+			vars:     []string{"total"},
+			keep: []string{
+				"logger := s.logger.With", // definition reaching the kept logger.Warn
+				"if ctx == nil {",         // early exit the racy writes control-depend on
+				"total := 0",              // definition of the racy variable
+				"n, err := s.fetch",       // data dependence of the racy write
+				"wg.Add(1)",               // synchronization
+				"go func(id string)",
+				"defer wg.Done()",
+				"total += n",
+				"wg.Wait()",
+				"logger.Warn",       // guarded by a condition on the racy variable
+				"s.publish(report)", // forward data dependence
+				"import (",          // imports are kept for the skeletonizer
+			},
+			drop: []string{
+				"logger.Info",
+				"logger.Debug",
+				"logger.Error",
+				"s.metrics.Inc",
+			},
+		},
+		{
+			name:     "skeleton with default variables",
+			filename: "testdata/skeleton.go",
+			keep: []string{
+				"v4 := pkg1.Func5(v1)", // definition reaching the kept pkg1.Func11(v4)
+				"var racyVar0 int",
+				"v7.Add(IntConst0)",
+				"racyVar0 = v8.v10",
+				"for _, v8 := range v3 {",
+				"v7.Wait()",
+				"pkg1.Func11(v4)",
+			},
+			drop: []string{
+				"pkg1.Func6",
+				"pkg1.Func9",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := os.ReadFile(tt.filename)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			out, err := File(tt.filename, src, tt.funcName, tt.vars)
+			if err != nil {
+				t.Fatalf("File() error = %v", err)
+			}
+			got := string(out)
+			for _, want := range tt.keep {
+				if !strings.Contains(got, want) {
+					t.Errorf("File() dropped %q:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.drop {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("File() kept %q:\n%s", unwanted, got)
+				}
+			}
+			if _, err := parser.ParseFile(token.NewFileSet(), "", out, 0); err != nil {
+				t.Errorf("File() output does not parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	src, err := os.ReadFile("testdata/input.go")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if _, err := File("testdata/input.go", src, "Missing", nil); err == nil {
+		t.Errorf("File() expected error for missing function")
+	}
+	if _, err := File("testdata/input.go", src, "", nil); err == nil {
+		t.Errorf("File() expected error without racy variables")
+	}
+}
+
+func TestSliceFeedsAnalyzer(t *testing.T) {
+	src, err := os.ReadFile("../../data/skeletons/D10447847/read1.go")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	out, err := File("read1.go", src, "", nil)
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "read1.go")
+	if err := os.WriteFile(filename, out, 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	result, err := analyzer.AnalyzeFile(filename)
+	if err != nil {
+		t.Fatalf("AnalyzeFile() error = %v", err)
+	}
+	if !result.HasWrite {
+		t.Errorf("AnalyzeFile() on slice = %v, want write", result.HasWrite)
+	}
+}
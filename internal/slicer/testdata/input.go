@@ -0,0 +1,39 @@
+package orders
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+func (s *Service) Process(ctx context.Context, ids []string) (int, error) {
+	logger := s.logger.With("ids", len(ids))
+	logger.Info("processing")
+	if ctx == nil {
+		return 0, fmt.Errorf("nil context")
+	}
+	total := 0
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			logger.Debug("fetching", id)
+			n, err := s.fetch(ctx, id)
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			total += n
+		}(id)
+	}
+	wg.Wait()
+	s.metrics.Inc("processed")
+	if total > s.limit {
+		logger.Warn("over limit")
+		total = s.limit
+	}
+	report := fmt.Sprintf("%d", total)
+	s.publish(report)
+	return total, nil
+}
@@ -0,0 +1,21 @@
+package skeleton
+
+func func1(v1 pkg0.v2, v3 []type0) type1 {
+	v4 := pkg1.Func5(v1)
+	pkg1.Func6(v4, "StringConst0")
+	var racyVar0 int
+	var v7 sync.WaitGroup
+	for _, v8 := range v3 {
+		v7.Add(IntConst0)
+		go func() {
+			defer v7.Done()
+			pkg1.Func9(v4)
+			racyVar0 = v8.v10
+		}()
+	}
+	v7.Wait()
+	if racyVar0 > IntConst1 {
+		pkg1.Func11(v4)
+	}
+	return nil
+}
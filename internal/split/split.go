@@ -0,0 +1,374 @@
+package split
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/corpus"
+	"github.com/uber/data-race-skeletons/internal/patterns"
+	"github.com/uber/data-race-skeletons/internal/skeletonizer"
+)
+
+// Split names, in manifest order
+const (
+	Train = "train"
+	Val   = "val"
+	Test  = "test"
+)
+
+// Names lists the splits in the order of Options.Ratios
+var Names = []string{Train, Val, Test}
+
+// Race types of a case, given by the roles of its files
+const (
+	ReadWrite  = "read-write"
+	WriteWrite = "write-write"
+)
+
+// ManifestFile is the file WriteFiles writes the manifest to, next to one
+// NAME.txt file per split
+const ManifestFile = "manifest.json"
+
+// NoPattern is the pattern label of cases no classifier rule matches
+const NoPattern = "none"
+
+const (
+	defaultSimilarity = 0.9
+	// shingleSize is the number of tokens per shingle compared for near-duplicates
+	shingleSize = 4
+	epsilon     = 1e-9
+)
+
+// Options controls how the corpus is split
+type Options struct {
+	// Ratios are the shares of train, val and test; they need not sum to 1
+	Ratios [3]float64
+	Seed   int64
+	// Similarity is the Jaccard similarity of token shingles above which two
+	// cases are near-duplicates, 0.9 if zero. Above 1, only alpha-equivalent
+	// cases are kept together.
+	Similarity float64
+}
+
+// Case is the manifest entry of a case
+type Case struct {
+	Case     string `json:"case"`
+	Split    string `json:"split"`
+	RaceType string `json:"race_type"`
+	Pattern  string `json:"pattern"`
+	// Group is the first case of the duplicate group the case belongs to
+	Group string `json:"group"`
+	Error string `json:"error,omitempty"`
+}
+
+// Manifest is a split of the corpus
+type Manifest struct {
+	Seed       int64               `json:"seed"`
+	Ratios     [3]float64          `json:"ratios"`
+	Similarity float64             `json:"similarity"`
+	Splits     map[string][]string `json:"splits"`
+	// Groups lists the duplicate groups of more than one case
+	Groups [][]string `json:"groups,omitempty"`
+	Cases  []Case     `json:"cases"`
+}
+
+// features are what a case is stratified and deduplicated on
+type features struct {
+	entry    Case
+	key      string // Canonical text of the files, equal for alpha-equivalent cases
+	shingles map[string]bool
+}
+
+// Dir splits the skeleton cases found in dir
+func Dir(dir string, opts Options) (*Manifest, error) {
+	cases, err := corpus.FindCases(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no skeletons found in %s", dir)
+	}
+	return Split(cases, opts)
+}
+
+// Split assigns every case to a split. Cases that are alpha-equivalent or
+// near-duplicates form a group that goes to a single split. Groups are
+// stratified by the race type and main pattern of their first case, shuffled
+// with the seed, and each is given to the split furthest below its ratio.
+func Split(cases []corpus.Case, opts Options) (*Manifest, error) {
+	var total float64
+	for _, r := range opts.Ratios {
+		if r < 0 {
+			return nil, fmt.Errorf("negative split ratio %v", r)
+		}
+		total += r
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("split ratios are all zero")
+	}
+	if opts.Similarity == 0 {
+		opts.Similarity = defaultSimilarity
+	}
+
+	sorted := append([]corpus.Case(nil), cases...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	fs := make([]*features, len(sorted))
+	for i, c := range sorted {
+		f, err := caseFeatures(c)
+		if err != nil {
+			return nil, err
+		}
+		fs[i] = f
+	}
+
+	groups := group(fs, opts.Similarity)
+	strata := make(map[string][][]*features)
+	var keys []string
+	for _, g := range groups {
+		key := g[0].entry.RaceType + "/" + g[0].entry.Pattern
+		if _, ok := strata[key]; !ok {
+			keys = append(keys, key)
+		}
+		strata[key] = append(strata[key], g)
+	}
+	sort.Strings(keys)
+
+	m := &Manifest{Seed: opts.Seed, Ratios: opts.Ratios, Similarity: opts.Similarity, Splits: make(map[string][]string)}
+	for _, name := range Names {
+		m.Splits[name] = []string{}
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	var totals [3]int
+	grouped := 0
+	for _, key := range keys {
+		gs := strata[key]
+		rng.Shuffle(len(gs), func(i, j int) { gs[i], gs[j] = gs[j], gs[i] })
+		var counts [3]int
+		assigned := 0
+		for _, g := range gs {
+			assigned += len(g)
+			grouped += len(g)
+			// Ties within the stratum, common in small strata, go to the
+			// split furthest below its ratio over the whole corpus
+			best := -1
+			var bestDeficit, bestCorpus float64
+			for i, r := range opts.Ratios {
+				if r == 0 {
+					continue
+				}
+				deficit := r/total*float64(assigned) - float64(counts[i])
+				corpusDeficit := r/total*float64(grouped) - float64(totals[i])
+				if best < 0 || deficit > bestDeficit+epsilon || deficit > bestDeficit-epsilon && corpusDeficit > bestCorpus {
+					best, bestDeficit, bestCorpus = i, deficit, corpusDeficit
+				}
+			}
+			counts[best] += len(g)
+			totals[best] += len(g)
+			for _, f := range g {
+				f.entry.Split = Names[best]
+			}
+		}
+	}
+
+	for _, g := range groups {
+		if len(g) > 1 {
+			var names []string
+			for _, f := range g {
+				names = append(names, f.entry.Case)
+			}
+			m.Groups = append(m.Groups, names)
+		}
+	}
+	for _, f := range fs {
+		m.Cases = append(m.Cases, f.entry)
+		m.Splits[f.entry.Split] = append(m.Splits[f.entry.Split], f.entry.Case)
+	}
+	return m, nil
+}
+
+// WriteFiles writes the manifest and, for each split, the file listing its
+// case IDs, one per line
+func (m *Manifest) WriteFiles(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	for _, name := range Names {
+		var b strings.Builder
+		for _, c := range m.Splits[name] {
+			b.WriteString(c + "\n")
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".txt"), []byte(b.String()), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Roles of the files of a case
+const (
+	RoleRead  = "read"
+	RoleWrite = "write"
+)
+
+// Role returns the role of a skeleton file from its name, read for readN.go
+// and write for writeN.go, or "" for other names
+func Role(filename string) string {
+	base := filepath.Base(filename)
+	switch {
+	case strings.HasPrefix(base, RoleRead):
+		return RoleRead
+	case strings.HasPrefix(base, RoleWrite):
+		return RoleWrite
+	}
+	return ""
+}
+
+// RaceType returns the race type of a case from the names of its files:
+// read-write if one of them is a readN.go file, write-write otherwise
+func RaceType(files []string) string {
+	for _, f := range files {
+		if Role(f) == RoleRead {
+			return ReadWrite
+		}
+	}
+	return WriteWrite
+}
+
+// caseFeatures reads the files of a case. Files that do not parse are
+// compared on their raw text and have no pattern.
+func caseFeatures(c corpus.Case) (*features, error) {
+	f := &features{entry: Case{Case: c.Name, RaceType: RaceType(c.Files)}, shingles: make(map[string]bool)}
+	var texts []string
+	var lists [][]patterns.Match
+	m := skeletonizer.NewMapping()
+	for _, filename := range c.Files {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		text, err := skeletonizer.Canonicalize(src, m)
+		if err != nil {
+			f.entry.Error = fmt.Sprintf("%s: %v", filepath.Base(filename), err)
+			text = src
+		}
+		texts = append(texts, string(text))
+		for _, s := range shingles(text) {
+			f.shingles[s] = true
+		}
+
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filename, src, 0)
+		if err != nil {
+			continue
+		}
+		lists = append(lists, patterns.File(fset, file, src))
+	}
+	sort.Strings(texts)
+	f.key = strings.Join(texts, "\x00")
+	f.entry.Pattern = NoPattern
+	if merged := patterns.Merge(lists...); len(merged) > 0 {
+		f.entry.Pattern = merged[0].Pattern
+	}
+	return f, nil
+}
+
+// shingles returns the runs of shingleSize consecutive tokens of src
+func shingles(src []byte) []string {
+	var toks []string
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if lit == "" || tok == token.SEMICOLON {
+			lit = tok.String()
+		}
+		toks = append(toks, lit)
+	}
+	if len(toks) < shingleSize {
+		return []string{strings.Join(toks, " ")}
+	}
+	var out []string
+	for i := 0; i+shingleSize <= len(toks); i++ {
+		out = append(out, strings.Join(toks[i:i+shingleSize], " "))
+	}
+	return out
+}
+
+// group joins alpha-equivalent and near-duplicate cases. Groups and their
+// cases keep the order of fs.
+func group(fs []*features, similarity float64) [][]*features {
+	parent := make([]int, len(fs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range fs {
+		for j := i + 1; j < len(fs); j++ {
+			if fs[i].key == fs[j].key || jaccard(fs[i].shingles, fs[j].shingles) >= similarity {
+				a, b := find(i), find(j)
+				if a < b {
+					parent[b] = a
+				} else {
+					parent[a] = b
+				}
+			}
+		}
+	}
+	index := make(map[int]int)
+	var groups [][]*features
+	for i, f := range fs {
+		root := find(i)
+		k, ok := index[root]
+		if !ok {
+			k = len(groups)
+			index[root] = k
+			groups = append(groups, nil)
+		}
+		groups[k] = append(groups[k], f)
+	}
+	for _, g := range groups {
+		for _, f := range g {
+			f.entry.Group = g[0].entry.Case
+		}
+	}
+	return groups
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	inter := 0
+	for s := range a {
+		if b[s] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
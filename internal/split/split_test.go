@@ -0,0 +1,150 @@
+package split
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	m, err := Dir("testdata", Options{Ratios: [3]float64{0.5, 0.25, 0.25}, Seed: 1})
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	if len(m.Cases) != 7 {
+		t.Fatalf("Dir() = %d cases, want 7", len(m.Cases))
+	}
+	byCase := make(map[string]Case)
+	for _, c := range m.Cases {
+		byCase[c.Case] = c
+	}
+
+	// R10447847 is D10447847 with other placeholders
+	d, r := byCase["D10447847"], byCase["R10447847"]
+	if d.Group != "D10447847" || r.Group != "D10447847" {
+		t.Errorf("groups = %q, %q, want both D10447847", d.Group, r.Group)
+	}
+	if d.Split != r.Split {
+		t.Errorf("alpha-equivalent cases split into %s and %s", d.Split, r.Split)
+	}
+	if !reflect.DeepEqual(m.Groups, [][]string{{"D10447847", "R10447847"}}) {
+		t.Errorf("Groups = %v", m.Groups)
+	}
+
+	if d.RaceType != ReadWrite || byCase["D6645345"].RaceType != WriteWrite {
+		t.Errorf("race types = %s, %s", d.RaceType, byCase["D6645345"].RaceType)
+	}
+	if d.Pattern != "errgroup-shared-err" || byCase["D6645345"].Pattern != "concurrent-map-write" {
+		t.Errorf("patterns = %s, %s", d.Pattern, byCase["D6645345"].Pattern)
+	}
+
+	total := 0
+	for _, name := range Names {
+		total += len(m.Splits[name])
+	}
+	if total != len(m.Cases) {
+		t.Errorf("splits list %d cases, want %d", total, len(m.Cases))
+	}
+}
+
+func TestSplitSeed(t *testing.T) {
+	opts := Options{Ratios: [3]float64{0.6, 0.2, 0.2}, Seed: 42}
+	a, err := Dir("testdata", opts)
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	b, err := Dir("testdata", opts)
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	if !reflect.DeepEqual(a.Splits, b.Splits) {
+		t.Errorf("same seed gave %v and %v", a.Splits, b.Splits)
+	}
+}
+
+func TestSplitRatios(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratios  [3]float64
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name:   "train only",
+			ratios: [3]float64{1, 0, 0},
+			want:   map[string]int{Train: 7, Val: 0, Test: 0},
+		},
+		{
+			name:    "all zero",
+			ratios:  [3]float64{0, 0, 0},
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			ratios:  [3]float64{1, -1, 0},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Dir("testdata", Options{Ratios: tt.ratios})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for name, n := range tt.want {
+				if len(m.Splits[name]) != n {
+					t.Errorf("%s has %d cases, want %d", name, len(m.Splits[name]), n)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	m, err := Dir("testdata", Options{Ratios: [3]float64{0.5, 0.25, 0.25}, Seed: 1})
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	dir := filepath.Join(t.TempDir(), "split")
+	if err := m.WriteFiles(dir); err != nil {
+		t.Fatalf("WriteFiles() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManifestFile)); err != nil {
+		t.Errorf("manifest not written: %v", err)
+	}
+	for _, name := range Names {
+		data, err := os.ReadFile(filepath.Join(dir, name+".txt"))
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		want := ""
+		if len(m.Splits[name]) > 0 {
+			want = strings.Join(m.Splits[name], "\n") + "\n"
+		}
+		if string(data) != want {
+			t.Errorf("%s.txt = %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestRaceType(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"D1/read1.go", "D1/write2.go"}, ReadWrite},
+		{[]string{"D1/read2.go", "D1/write1.go"}, ReadWrite},
+		{[]string{"D1/write1.go", "D1/write2.go"}, WriteWrite},
+	}
+	for _, tt := range tests {
+		if got := RaceType(tt.files); got != tt.want {
+			t.Errorf("RaceType(%v) = %s, want %s", tt.files, got, tt.want)
+		}
+	}
+}
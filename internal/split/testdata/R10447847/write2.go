@@ -0,0 +1,22 @@
+package skeleton
+
+func (v31 *type0) func9(v6 pkg5.v9, v10 pkg8.v13, v17 pkg8.v13, v15 pkg0.v12) ([]pkg0.v5, type1) {
+	v30, racyVar0 := v31.v0.Func1(v6, v10, v17, v15)
+	if v2 != nil {
+		return nil, pkg4.Func2(v2, "StringConst0")
+	}
+	v4, v6 := errgroup.WithContext(v6)
+	for v16 := range v30 {
+		Wrapper2.Go(func() type1 {
+			v30[v7].v14, racyVar0 = v31.Func4(v6, v30[v7].v11, v30[v7].v3)
+			if racyVar0 != nil && !pkg7.Func5(racyVar0) {
+				return v2
+			}
+			return nil
+		})
+	}
+	if v2 := Wrapper2.Wait(); v2 != nil {
+		return nil, v2
+	}
+	return v30, nil
+}
\ No newline at end of file
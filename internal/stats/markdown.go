@@ -0,0 +1,78 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Markdown renders the report as Markdown tables: the corpus summary, then per case and per file
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	c := r.Corpus
+
+	b.WriteString("# Skeleton Statistics\n\n")
+	fmt.Fprintf(&b, "%d cases, %d files, %d lines, %d bytes (largest file: %d lines, %d bytes)\n\n", c.Cases, c.Files, c.Lines, c.Bytes, c.MaxLines, c.MaxBytes)
+
+	b.WriteString("## Concurrency Constructs\n\n")
+	b.WriteString("| Construct | Total | Files |\n|---|---:|---:|\n")
+	for _, k := range constructs {
+		fmt.Fprintf(&b, "| %s | %d | %d |\n", k.title, k.get(c.Counts), c.FilesWith[k.field])
+	}
+
+	b.WriteString("\n## Racy Variables per Case\n\n")
+	writeHistogram(&b, "Racy variables", "Cases", c.RacyVarsPerCase)
+	b.WriteString("\n## Goroutine Nesting Depth\n\n")
+	writeHistogram(&b, "Depth", "Files", c.GoroutineDepths)
+
+	b.WriteString("\n## Cases\n\n")
+	writeHeader(&b, "Case", "Racy variables")
+	for _, cs := range r.Cases {
+		writeRow(&b, []string{cs.Case, strings.Join(cs.RacyVars, ", ")}, cs.Counts, cs.GoroutineDepth, cs.Lines, cs.Bytes)
+	}
+
+	b.WriteString("\n## Files\n\n")
+	writeHeader(&b, "Case", "File")
+	for _, fs := range r.Files {
+		file := fs.File
+		if fs.Error != "" {
+			file += " (parse error)"
+		}
+		writeRow(&b, []string{fs.Case, file}, fs.Counts, fs.GoroutineDepth, fs.Lines, fs.Bytes)
+	}
+	return b.String()
+}
+
+func writeHistogram(b *strings.Builder, key, count string, h map[int]int) {
+	fmt.Fprintf(b, "| %s | %s |\n|---:|---:|\n", key, count)
+	var keys []int
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, "| %d | %d |\n", k, h[k])
+	}
+}
+
+func writeHeader(b *strings.Builder, first, second string) {
+	cols := []string{first, second}
+	align := []string{"---", "---"}
+	for _, k := range constructs {
+		cols = append(cols, k.title)
+		align = append(align, "---:")
+	}
+	cols = append(cols, "Depth", "Lines", "Bytes")
+	align = append(align, "---:", "---:", "---:")
+	fmt.Fprintf(b, "| %s |\n|%s|\n", strings.Join(cols, " | "), strings.Join(align, "|"))
+}
+
+func writeRow(b *strings.Builder, first []string, counts Counts, depth, lines, size int) {
+	cells := append([]string(nil), first...)
+	for _, k := range constructs {
+		cells = append(cells, strconv.Itoa(k.get(counts)))
+	}
+	cells = append(cells, strconv.Itoa(depth), strconv.Itoa(lines), strconv.Itoa(size))
+	fmt.Fprintf(b, "| %s |\n", strings.Join(cells, " | "))
+}
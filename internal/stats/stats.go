@@ -0,0 +1,442 @@
+package stats
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/uber/data-race-skeletons/internal/corpus"
+)
+
+var (
+	racyPattern    = regexp.MustCompile(`^racyVar[0-9]+$`)
+	wrapperPattern = regexp.MustCompile(`^Wrapper[0-9]+$`)
+)
+
+// Counts holds the number of each concurrency construct
+type Counts struct {
+	GoStatements    int `json:"go_statements"`
+	SpawnerClosures int `json:"spawner_closures"`
+	ChanSends       int `json:"chan_sends"`
+	ChanReceives    int `json:"chan_receives"`
+	Selects         int `json:"selects"`
+	MutexCalls      int `json:"mutex_calls"`
+	RWMutexCalls    int `json:"rwmutex_calls"`
+	WaitGroupCalls  int `json:"waitgroup_calls"`
+	ErrgroupCalls   int `json:"errgroup_calls"`
+	OnceCalls       int `json:"once_calls"`
+	SyncMapCalls    int `json:"sync_map_calls"`
+	AtomicCalls     int `json:"atomic_calls"`
+}
+
+// FileStats are the statistics of one skeleton file
+type FileStats struct {
+	Case string `json:"case"`
+	File string `json:"file"`
+	Counts
+	RacyVars       []string `json:"racy_vars"`
+	GoroutineDepth int      `json:"goroutine_depth"`
+	Bytes          int      `json:"bytes"`
+	Lines          int      `json:"lines"`
+	Error          string   `json:"error,omitempty"`
+}
+
+// CaseStats are the statistics of a case, summed over its files
+type CaseStats struct {
+	Case  string   `json:"case"`
+	Files []string `json:"files"`
+	Counts
+	RacyVars       []string `json:"racy_vars"`
+	GoroutineDepth int      `json:"goroutine_depth"`
+	Bytes          int      `json:"bytes"`
+	Lines          int      `json:"lines"`
+}
+
+// CorpusStats are the statistics of all cases
+type CorpusStats struct {
+	Cases int `json:"cases"`
+	Files int `json:"files"`
+	Counts
+	// FilesWith counts the files using each construct, keyed like the JSON fields of Counts
+	FilesWith map[string]int `json:"files_with"`
+	// RacyVarsPerCase and GoroutineDepths are histograms: value to number of cases or files
+	RacyVarsPerCase map[int]int `json:"racy_vars_per_case"`
+	GoroutineDepths map[int]int `json:"goroutine_depths"`
+	Bytes           int         `json:"bytes"`
+	Lines           int         `json:"lines"`
+	MaxBytes        int         `json:"max_bytes"`
+	MaxLines        int         `json:"max_lines"`
+}
+
+// Report holds corpus-wide, per-case and per-file statistics
+type Report struct {
+	Corpus CorpusStats `json:"corpus"`
+	Cases  []CaseStats `json:"cases"`
+	Files  []FileStats `json:"files"`
+}
+
+// Dir collects the statistics of the skeleton cases found in dir
+func Dir(dir string) (*Report, error) {
+	cases, err := corpus.FindCases(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Collect(cases), nil
+}
+
+// Collect computes the statistics of cases. Files that cannot be read or
+// parsed are reported with their error and only contribute their size.
+func Collect(cases []corpus.Case) *Report {
+	r := &Report{Corpus: CorpusStats{
+		FilesWith:       make(map[string]int),
+		RacyVarsPerCase: make(map[int]int),
+		GoroutineDepths: make(map[int]int),
+	}}
+	for _, c := range cases {
+		cs := CaseStats{Case: c.Name}
+		racy := make(map[string]bool)
+		for _, filename := range c.Files {
+			var fs FileStats
+			if src, err := os.ReadFile(filename); err != nil {
+				fs = FileStats{File: filepath.Base(filename), Error: err.Error()}
+			} else {
+				fs = File(filepath.Base(filename), src)
+			}
+			fs.Case = c.Name
+			r.Files = append(r.Files, fs)
+
+			cs.Files = append(cs.Files, fs.File)
+			cs.Counts.add(fs.Counts)
+			for _, name := range fs.RacyVars {
+				racy[name] = true
+			}
+			if fs.GoroutineDepth > cs.GoroutineDepth {
+				cs.GoroutineDepth = fs.GoroutineDepth
+			}
+			cs.Bytes += fs.Bytes
+			cs.Lines += fs.Lines
+
+			r.Corpus.Files++
+			r.Corpus.Counts.add(fs.Counts)
+			for name, n := range fs.Counts.fields() {
+				if n > 0 {
+					r.Corpus.FilesWith[name]++
+				}
+			}
+			r.Corpus.GoroutineDepths[fs.GoroutineDepth]++
+			r.Corpus.Bytes += fs.Bytes
+			r.Corpus.Lines += fs.Lines
+			if fs.Bytes > r.Corpus.MaxBytes {
+				r.Corpus.MaxBytes = fs.Bytes
+			}
+			if fs.Lines > r.Corpus.MaxLines {
+				r.Corpus.MaxLines = fs.Lines
+			}
+		}
+		cs.RacyVars = sortedKeys(racy)
+		r.Cases = append(r.Cases, cs)
+		r.Corpus.Cases++
+		r.Corpus.RacyVarsPerCase[len(cs.RacyVars)]++
+	}
+	return r
+}
+
+// File computes the statistics of one skeleton file
+func File(filename string, src []byte) FileStats {
+	fs := FileStats{File: filename, RacyVars: []string{}, Bytes: len(src), Lines: countLines(src)}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		fs.Error = err.Error()
+		return fs
+	}
+
+	c := &counter{types: declaredTypes(file)}
+	c.walk(file, 0)
+	fs.Counts = c.counts
+	fs.GoroutineDepth = c.maxDepth
+	fs.RacyVars = sortedKeys(c.racy)
+	return fs
+}
+
+func (c *Counts) add(o Counts) {
+	c.GoStatements += o.GoStatements
+	c.SpawnerClosures += o.SpawnerClosures
+	c.ChanSends += o.ChanSends
+	c.ChanReceives += o.ChanReceives
+	c.Selects += o.Selects
+	c.MutexCalls += o.MutexCalls
+	c.RWMutexCalls += o.RWMutexCalls
+	c.WaitGroupCalls += o.WaitGroupCalls
+	c.ErrgroupCalls += o.ErrgroupCalls
+	c.OnceCalls += o.OnceCalls
+	c.SyncMapCalls += o.SyncMapCalls
+	c.AtomicCalls += o.AtomicCalls
+}
+
+// constructs lists the constructs in report order, with their JSON field and title
+var constructs = []struct {
+	field, title string
+	get          func(Counts) int
+}{
+	{"go_statements", "`go` statements", func(c Counts) int { return c.GoStatements }},
+	{"spawner_closures", "Spawner closures", func(c Counts) int { return c.SpawnerClosures }},
+	{"chan_sends", "Channel sends", func(c Counts) int { return c.ChanSends }},
+	{"chan_receives", "Channel receives", func(c Counts) int { return c.ChanReceives }},
+	{"selects", "`select`", func(c Counts) int { return c.Selects }},
+	{"mutex_calls", "`Mutex` calls", func(c Counts) int { return c.MutexCalls }},
+	{"rwmutex_calls", "`RWMutex` calls", func(c Counts) int { return c.RWMutexCalls }},
+	{"waitgroup_calls", "`WaitGroup` calls", func(c Counts) int { return c.WaitGroupCalls }},
+	{"errgroup_calls", "`errgroup` calls", func(c Counts) int { return c.ErrgroupCalls }},
+	{"once_calls", "`Once` calls", func(c Counts) int { return c.OnceCalls }},
+	{"sync_map_calls", "`sync.Map` calls", func(c Counts) int { return c.SyncMapCalls }},
+	{"atomic_calls", "`atomic` calls", func(c Counts) int { return c.AtomicCalls }},
+}
+
+func (c Counts) fields() map[string]int {
+	m := make(map[string]int, len(constructs))
+	for _, k := range constructs {
+		m[k.field] = k.get(c)
+	}
+	return m
+}
+
+func countLines(src []byte) int {
+	if len(src) == 0 {
+		return 0
+	}
+	n := bytes.Count(src, []byte("\n"))
+	if src[len(src)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// typeName returns the name of a concurrency type such as sync.WaitGroup, ignoring pointers
+func typeName(e ast.Expr) string {
+	if star, ok := e.(*ast.StarExpr); ok {
+		e = star.X
+	}
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	switch pkg.Name {
+	case "sync", "atomic", "errgroup":
+		return pkg.Name + "." + sel.Sel.Name
+	}
+	return ""
+}
+
+// lastName returns the name a receiver expression ends with: v for v and x.v
+func lastName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.ParenExpr:
+		return lastName(e.X)
+	case *ast.StarExpr:
+		return lastName(e.X)
+	case *ast.IndexExpr:
+		return lastName(e.X)
+	}
+	return ""
+}
+
+// declaredTypes maps names to the concurrency types they are declared or initialized with.
+// Skeletons are not type-checked, so names stand for all variables and fields spelled alike.
+func declaredTypes(file *ast.File) map[string]string {
+	types := make(map[string]string)
+	set := func(names []*ast.Ident, t string) {
+		if t == "" {
+			return
+		}
+		for _, name := range names {
+			types[name.Name] = t
+		}
+	}
+	valueType := func(e ast.Expr) string {
+		switch e := e.(type) {
+		case *ast.CompositeLit:
+			return typeName(e.Type)
+		case *ast.UnaryExpr:
+			if lit, ok := e.X.(*ast.CompositeLit); ok && e.Op == token.AND {
+				return typeName(lit.Type)
+			}
+		case *ast.CallExpr:
+			if id, ok := e.Fun.(*ast.Ident); ok && id.Name == "new" && len(e.Args) == 1 {
+				return typeName(e.Args[0])
+			}
+			if typeName(e.Fun) == "errgroup.WithContext" {
+				return "errgroup.Group"
+			}
+		}
+		return ""
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			set(n.Names, typeName(n.Type))
+			if len(n.Values) > 0 {
+				set(n.Names[:1], valueType(n.Values[0]))
+			}
+		case *ast.Field:
+			set(n.Names, typeName(n.Type))
+		case *ast.AssignStmt:
+			if len(n.Rhs) > 0 {
+				if id, ok := n.Lhs[0].(*ast.Ident); ok {
+					set([]*ast.Ident{id}, valueType(n.Rhs[0]))
+				}
+			}
+		}
+		return true
+	})
+	return types
+}
+
+// counter walks a file, counting constructs and the nesting of goroutines
+type counter struct {
+	types    map[string]string
+	counts   Counts
+	racy     map[string]bool
+	maxDepth int
+}
+
+func (c *counter) walk(n ast.Node, depth int) {
+	if c.racy == nil {
+		c.racy = make(map[string]bool)
+	}
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if racyPattern.MatchString(n.Name) {
+				c.racy[n.Name] = true
+			}
+		case *ast.GoStmt:
+			c.counts.GoStatements++
+			c.spawn(depth)
+			c.walk(n.Call.Fun, depth+1)
+			for _, arg := range n.Call.Args {
+				c.walk(arg, depth)
+			}
+			return false
+		case *ast.SendStmt:
+			c.counts.ChanSends++
+		case *ast.UnaryExpr:
+			if n.Op == token.ARROW {
+				c.counts.ChanReceives++
+			}
+		case *ast.SelectStmt:
+			c.counts.Selects++
+		case *ast.ExprStmt:
+			if call, ok := n.X.(*ast.CallExpr); ok {
+				c.call(call, true)
+				c.walkCall(call, depth)
+				return false
+			}
+		case *ast.DeferStmt:
+			c.call(n.Call, true)
+			c.walkCall(n.Call, depth)
+			return false
+		case *ast.CallExpr:
+			c.call(n, false)
+			c.walkCall(n, depth)
+			return false
+		}
+		return true
+	})
+}
+
+// walkCall walks the parts of a call, entering closures passed to spawners one goroutine deeper
+func (c *counter) walkCall(call *ast.CallExpr, depth int) {
+	c.walk(call.Fun, depth)
+	spawner := isSpawner(call)
+	for _, arg := range call.Args {
+		if lit, ok := arg.(*ast.FuncLit); ok && spawner {
+			c.counts.SpawnerClosures++
+			c.spawn(depth)
+			c.walk(lit, depth+1)
+			continue
+		}
+		c.walk(arg, depth)
+	}
+}
+
+func (c *counter) spawn(depth int) {
+	if depth+1 > c.maxDepth {
+		c.maxDepth = depth + 1
+	}
+}
+
+func isSpawner(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && (sel.Sel.Name == "Go" || sel.Sel.Name == "TryGo")
+}
+
+// call classifies a call by the package or the receiver it is made on.
+// stmt is set for calls whose result is not used, as WaitGroup calls are.
+func (c *counter) call(call *ast.CallExpr, stmt bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	method := sel.Sel.Name
+	if pkg, ok := sel.X.(*ast.Ident); ok {
+		switch pkg.Name {
+		case "atomic":
+			c.counts.AtomicCalls++
+			return
+		case "errgroup":
+			c.counts.ErrgroupCalls++
+			return
+		}
+	}
+
+	recv := lastName(sel.X)
+	typ := c.types[recv]
+	switch {
+	case strings.HasPrefix(typ, "atomic."):
+		c.counts.AtomicCalls++
+	case typ == "sync.Map":
+		c.counts.SyncMapCalls++
+	case typ == "sync.Once" || method == "Do" && len(call.Args) == 1 && isFuncLit(call.Args[0]):
+		c.counts.OnceCalls++
+	case typ == "sync.RWMutex" || method == "RLock" || method == "RUnlock" || method == "TryRLock":
+		c.counts.RWMutexCalls++
+	case typ == "sync.Mutex" || method == "Lock" || method == "Unlock" || method == "TryLock":
+		c.counts.MutexCalls++
+	case typ == "errgroup.Group" || wrapperPattern.MatchString(recv):
+		switch method {
+		case "Go", "TryGo", "Wait", "SetLimit":
+			c.counts.ErrgroupCalls++
+		}
+	case typ == "sync.WaitGroup" || stmt && (method == "Add" || method == "Done" || method == "Wait"):
+		c.counts.WaitGroupCalls++
+	}
+}
+
+func isFuncLit(e ast.Expr) bool {
+	_, ok := e.(*ast.FuncLit)
+	return ok
+}
@@ -0,0 +1,151 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uber/data-race-skeletons/internal/corpus"
+)
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		want      Counts
+		wantDepth int
+		wantRacy  []string
+	}{
+		{
+			name: "goroutines and wait group",
+			src: `package skeleton
+
+func func1() {
+	var v0 sync.WaitGroup
+	v0.Add(IntConst0)
+	go func() {
+		defer v0.Done()
+		go func() {
+			racyVar0 = v1
+		}()
+	}()
+	v0.Wait()
+}`,
+			want:      Counts{GoStatements: 2, WaitGroupCalls: 3},
+			wantDepth: 2,
+			wantRacy:  []string{"racyVar0"},
+		},
+		{
+			name: "errgroup spawner",
+			src: `package skeleton
+
+func func1(v0 pkg0.v1) type0 {
+	v2, v0 := errgroup.WithContext(v0)
+	Wrapper1.Go(func() type0 {
+		racyVar0 = v3
+		return nil
+	})
+	v2.Go(func() type0 {
+		return nil
+	})
+	return Wrapper1.Wait()
+}`,
+			want:      Counts{SpawnerClosures: 2, ErrgroupCalls: 4},
+			wantDepth: 1,
+			wantRacy:  []string{"racyVar0"},
+		},
+		{
+			name: "channels and select",
+			src: `package skeleton
+
+func func1(v0 chan int) {
+	v0 <- IntConst0
+	select {
+	case v1 := <-v0:
+		racyVar1 = v1
+	case <-v2.Done():
+	}
+}`,
+			want:     Counts{ChanSends: 1, ChanReceives: 2, Selects: 1},
+			wantRacy: []string{"racyVar1"},
+		},
+		{
+			name: "locks, once, map and atomics",
+			src: `package skeleton
+
+type type0 struct {
+	v0 sync.RWMutex
+	v1 sync.Map
+	v2 atomic.Int64
+}
+
+func (v3 *type0) func1() {
+	v3.v4.Lock()
+	defer v3.v4.Unlock()
+	v3.v0.RLock()
+	v3.v0.Lock()
+	v3.v5.Do(func() {})
+	v3.v1.Store(racyVar0, v6)
+	v3.v2.Add(IntConst0)
+	atomic.AddInt64(&v7, IntConst1)
+}`,
+			want:     Counts{MutexCalls: 2, RWMutexCalls: 2, OnceCalls: 1, SyncMapCalls: 1, AtomicCalls: 2},
+			wantRacy: []string{"racyVar0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := File("write1.go", []byte(tt.src))
+			if fs.Error != "" {
+				t.Fatalf("File() error = %s", fs.Error)
+			}
+			if fs.Counts != tt.want {
+				t.Errorf("File() counts = %+v, want %+v", fs.Counts, tt.want)
+			}
+			if fs.GoroutineDepth != tt.wantDepth {
+				t.Errorf("File() goroutine depth = %d, want %d", fs.GoroutineDepth, tt.wantDepth)
+			}
+			if strings.Join(fs.RacyVars, ",") != strings.Join(tt.wantRacy, ",") {
+				t.Errorf("File() racy vars = %v, want %v", fs.RacyVars, tt.wantRacy)
+			}
+			if fs.Lines != strings.Count(tt.src, "\n")+1 || fs.Bytes != len(tt.src) {
+				t.Errorf("File() size = %d lines, %d bytes", fs.Lines, fs.Bytes)
+			}
+		})
+	}
+}
+
+func TestFileParseError(t *testing.T) {
+	fs := File("broken.go", []byte("package skeleton\n\nfunc func1() {\n"))
+	if fs.Error == "" || fs.Lines != 3 {
+		t.Errorf("File() = %+v, want a parse error and 3 lines", fs)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	cases := []corpus.Case{{Name: "D10447847", Files: []string{
+		"../../data/skeletons/D10447847/read1.go",
+		"../../data/skeletons/D10447847/write2.go",
+	}}}
+	r := Collect(cases)
+	if r.Corpus.Cases != 1 || r.Corpus.Files != 2 || len(r.Files) != 2 {
+		t.Fatalf("Collect() corpus = %+v", r.Corpus)
+	}
+	cs := r.Cases[0]
+	if len(cs.RacyVars) != 1 || cs.SpawnerClosures != 2 || cs.GoroutineDepth != 1 {
+		t.Errorf("Collect() case = %+v", cs)
+	}
+	if r.Corpus.FilesWith["spawner_closures"] != 2 || r.Corpus.RacyVarsPerCase[1] != 1 || r.Corpus.GoroutineDepths[1] != 2 {
+		t.Errorf("Collect() corpus = %+v", r.Corpus)
+	}
+	if r.Corpus.Bytes != r.Files[0].Bytes+r.Files[1].Bytes {
+		t.Errorf("Collect() bytes = %d", r.Corpus.Bytes)
+	}
+
+	md := r.Markdown()
+	for _, want := range []string{"1 cases, 2 files", "| Spawner closures | 2 | 2 |", "| D10447847 | racyVar0 | 0 | 2 |", "| D10447847 | write2.go |"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown() missing %q:\n%s", want, md)
+		}
+	}
+}
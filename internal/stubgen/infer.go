@@ -0,0 +1,1235 @@
+package stubgen
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strconv"
+)
+
+// syntheticPrefix names stub types invented for values whose type is never written
+const syntheticPrefix = "stub"
+
+var (
+	constPattern     = regexp.MustCompile(`^(IntConst|FloatConst)([0-9]+)$`)
+	syntheticPattern = regexp.MustCompile(`^` + syntheticPrefix + `[0-9]+$`)
+)
+
+func isSynthetic(name string) bool {
+	return syntheticPattern.MatchString(name)
+}
+
+// inferrer collects type constraints from the skeleton and solves them by unification
+type inferrer struct {
+	info      *types.Info
+	objects   map[types.Object]*term
+	globals   map[string]*term
+	globalSeq []string
+	assigned  map[string]bool // Globals that are assigned and must be variables
+	consts    map[string]bool
+	stubs     map[string]*named
+	stubSeq   []*named
+	results   [][]*term // Result types of the enclosing functions
+	populate  bool
+}
+
+func newInferrer(info *types.Info) *inferrer {
+	return &inferrer{
+		info:     info,
+		objects:  make(map[types.Object]*term),
+		globals:  make(map[string]*term),
+		assigned: make(map[string]bool),
+		consts:   make(map[string]bool),
+		stubs:    make(map[string]*named),
+	}
+}
+
+// run infers the types of every undefined name used by the files
+func (in *inferrer) run(files []*ast.File) {
+	var bodies []*ast.FuncDecl
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				in.declareFunc(decl)
+				bodies = append(bodies, decl)
+			case *ast.GenDecl:
+				in.genDecl(decl)
+			}
+		}
+	}
+	for _, decl := range bodies {
+		if decl.Body == nil {
+			continue
+		}
+		sig := in.objectTerm(in.info.Defs[decl.Name])
+		in.results = append(in.results, find(sig).sig.results)
+		in.block(decl.Body.List)
+		in.results = in.results[:len(in.results)-1]
+	}
+}
+
+// declareFunc registers a function or method before any body is walked,
+// so calls see the declared signature regardless of order
+func (in *inferrer) declareFunc(decl *ast.FuncDecl) {
+	fn := funcTerm(in.funcType(decl.Type))
+	if obj := in.info.Defs[decl.Name]; obj != nil {
+		in.objects[obj] = fn
+	}
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return
+	}
+	field := decl.Recv.List[0]
+	recv := in.typeOf(field.Type)
+	for _, name := range field.Names {
+		in.define(name, recv)
+	}
+	base := find(recv)
+	if base.kind == pointerKind {
+		base = find(base.elem)
+	}
+	if base.kind == namedKind {
+		n := findNamed(base.named)
+		if m, ok := n.methods[decl.Name.Name]; ok {
+			unify(m, fn)
+		} else {
+			n.addMethod(decl.Name.Name, fn)
+		}
+		n.declared[decl.Name.Name] = true
+	}
+}
+
+func (in *inferrer) genDecl(decl *ast.GenDecl) {
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.ValueSpec:
+			in.valueSpec(spec)
+		case *ast.TypeSpec:
+			in.typeOf(spec.Type)
+		}
+	}
+}
+
+// funcType converts a function type and binds its parameter names
+func (in *inferrer) funcType(ft *ast.FuncType) *signature {
+	sig := &signature{fixed: true}
+	if ft.Params != nil {
+		for _, field := range ft.Params.List {
+			var t *term
+			if ell, ok := field.Type.(*ast.Ellipsis); ok {
+				t = sliceOf(in.typeOf(ell.Elt))
+				sig.variadic = true
+			} else {
+				t = in.typeOf(field.Type)
+			}
+			sig.params = append(sig.params, repeat(t, len(field.Names))...)
+			for _, name := range field.Names {
+				in.define(name, t)
+			}
+		}
+	}
+	if ft.Results != nil {
+		for _, field := range ft.Results.List {
+			t := in.typeOf(field.Type)
+			sig.results = append(sig.results, repeat(t, len(field.Names))...)
+			for _, name := range field.Names {
+				in.define(name, t)
+			}
+		}
+	}
+	return sig
+}
+
+func repeat(t *term, names int) []*term {
+	if names == 0 {
+		names = 1
+	}
+	out := make([]*term, names)
+	for i := range out {
+		out[i] = t
+	}
+	return out
+}
+
+// typeOf converts a type expression, declaring stub types for undefined names
+func (in *inferrer) typeOf(e ast.Expr) *term {
+	if tv, ok := in.info.Types[e]; ok && tv.IsType() {
+		if t := in.fromTypes(tv.Type); t != nil {
+			return t
+		}
+	}
+	switch e := e.(type) {
+	case *ast.Ident:
+		if obj, ok := in.info.Uses[e].(*types.TypeName); ok {
+			if t := in.fromTypes(obj.Type()); t != nil {
+				return t
+			}
+			return &term{kind: sourceKind, name: e.Name}
+		}
+		return namedTerm(in.stub(e.Name))
+	case *ast.ParenExpr:
+		return in.typeOf(e.X)
+	case *ast.StarExpr:
+		return pointerTo(in.typeOf(e.X))
+	case *ast.ArrayType:
+		if e.Len == nil {
+			return sliceOf(in.typeOf(e.Elt))
+		}
+		in.expr(e.Len)
+		return &term{kind: arrayKind, elem: in.typeOf(e.Elt), length: types.ExprString(e.Len)}
+	case *ast.Ellipsis:
+		return sliceOf(in.typeOf(e.Elt))
+	case *ast.MapType:
+		return &term{kind: mapKind, key: in.typeOf(e.Key), elem: in.typeOf(e.Value)}
+	case *ast.ChanType:
+		return &term{kind: chanKind, elem: in.typeOf(e.Value), dir: e.Dir}
+	case *ast.FuncType:
+		return funcTerm(in.funcType(e))
+	case *ast.InterfaceType:
+		if e.Methods == nil || len(e.Methods.List) == 0 {
+			return &term{kind: interfaceKind}
+		}
+	case *ast.StructType:
+		// Struct literals are printed as written, but their fields still take part in inference
+		fields := newNamed("")
+		for _, field := range e.Fields.List {
+			t := in.typeOf(field.Type)
+			for _, name := range field.Names {
+				fields.addField(name.Name, t)
+			}
+		}
+		return &term{kind: sourceKind, name: types.ExprString(e), named: fields}
+	}
+	// Struct and interface literals and generic instances are kept as written;
+	// the stub types they mention still have to be declared
+	ast.Inspect(e, func(n ast.Node) bool {
+		if field, ok := n.(*ast.Field); ok {
+			in.typeOf(field.Type)
+			return false
+		}
+		return true
+	})
+	return &term{kind: sourceKind, name: types.ExprString(e)}
+}
+
+// stub returns the stub type declared for an undefined type name
+func (in *inferrer) stub(name string) *named {
+	n, ok := in.stubs[name]
+	if !ok {
+		n = newNamed(name)
+		in.stubs[name] = n
+		in.stubSeq = append(in.stubSeq, n)
+	}
+	return n
+}
+
+func (in *inferrer) synthetic() *named {
+	for i := len(in.stubSeq); ; i++ {
+		name := syntheticPrefix + strconv.Itoa(i)
+		if _, ok := in.stubs[name]; !ok {
+			return in.stub(name)
+		}
+	}
+}
+
+// fromTypes converts a type the checker resolved, or returns nil if it is invalid
+func (in *inferrer) fromTypes(t types.Type) *term {
+	if t == nil || !valid(t) {
+		return nil
+	}
+	switch t := t.(type) {
+	case *types.Basic:
+		switch {
+		case t.Kind() == types.UntypedNil:
+			return hinted(hintNil)
+		case t.Info()&types.IsUntyped == 0:
+			return basic(t.Name())
+		case t.Info()&types.IsBoolean != 0:
+			return basic("bool")
+		case t.Info()&types.IsString != 0:
+			return hinted(hintString)
+		case t.Info()&types.IsFloat != 0:
+			return hinted(hintFloat)
+		}
+		return hinted(hintInt)
+	case *types.Named:
+		if t.Obj().Pkg() == nil && t.Obj().Name() == "error" {
+			return &term{kind: errorKind}
+		}
+	case *types.Pointer:
+		return pointerTo(in.fromTypes(t.Elem()))
+	case *types.Slice:
+		return sliceOf(in.fromTypes(t.Elem()))
+	case *types.Array:
+		return &term{kind: arrayKind, elem: in.fromTypes(t.Elem()), length: strconv.FormatInt(t.Len(), 10)}
+	case *types.Map:
+		return &term{kind: mapKind, key: in.fromTypes(t.Key()), elem: in.fromTypes(t.Elem())}
+	case *types.Chan:
+		dir := ast.SEND | ast.RECV
+		switch t.Dir() {
+		case types.SendOnly:
+			dir = ast.SEND
+		case types.RecvOnly:
+			dir = ast.RECV
+		}
+		return &term{kind: chanKind, elem: in.fromTypes(t.Elem()), dir: dir}
+	case *types.Signature:
+		sig := &signature{variadic: t.Variadic(), fixed: true}
+		for i := 0; i < t.Params().Len(); i++ {
+			sig.params = append(sig.params, in.fromTypes(t.Params().At(i).Type()))
+		}
+		for i := 0; i < t.Results().Len(); i++ {
+			sig.results = append(sig.results, in.fromTypes(t.Results().At(i).Type()))
+		}
+		return funcTerm(sig)
+	case *types.Interface:
+		if t.Empty() {
+			return &term{kind: interfaceKind}
+		}
+	}
+	return &term{kind: sourceKind, name: types.TypeString(t, qualifier)}
+}
+
+// qualifier prints imported types by package name and local types unqualified
+func qualifier(pkg *types.Package) string {
+	if pkg.Path() == modulePath {
+		return ""
+	}
+	return pkg.Name()
+}
+
+// valid reports whether t is fully resolved
+func valid(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Basic:
+		return t.Kind() != types.Invalid
+	case *types.Pointer:
+		return valid(t.Elem())
+	case *types.Slice:
+		return valid(t.Elem())
+	case *types.Array:
+		return valid(t.Elem())
+	case *types.Map:
+		return valid(t.Key()) && valid(t.Elem())
+	case *types.Chan:
+		return valid(t.Elem())
+	case *types.Signature:
+		return validTuple(t.Params()) && validTuple(t.Results())
+	case *types.Tuple:
+		return validTuple(t)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if !valid(t.Field(i).Type()) {
+				return false
+			}
+		}
+	case *types.Named:
+		return valid(t.Underlying())
+	}
+	return true
+}
+
+func validTuple(t *types.Tuple) bool {
+	for i := 0; i < t.Len(); i++ {
+		if !valid(t.At(i).Type()) {
+			return false
+		}
+	}
+	return true
+}
+
+// objectTerm returns the type of a declared object
+func (in *inferrer) objectTerm(obj types.Object) *term {
+	if obj == nil {
+		return fresh()
+	}
+	if t, ok := in.objects[obj]; ok {
+		return t
+	}
+	t := in.fromTypes(obj.Type())
+	if t == nil {
+		t = fresh()
+	}
+	in.objects[obj] = t
+	return t
+}
+
+// define binds a newly declared name to t, or unifies a redeclared one
+func (in *inferrer) define(id *ast.Ident, t *term) {
+	if id.Name == "_" {
+		return
+	}
+	if obj := in.info.Defs[id]; obj != nil {
+		if prev, ok := in.objects[obj]; ok {
+			unify(prev, t)
+			return
+		}
+		in.objects[obj] = t
+		if typed := in.fromTypes(obj.Type()); typed != nil {
+			unify(t, typed)
+		}
+		return
+	}
+	unify(in.expr(id), t)
+}
+
+// global returns the type of an undefined package-level name
+func (in *inferrer) global(name string) *term {
+	t, ok := in.globals[name]
+	if !ok {
+		t = fresh()
+		in.globals[name] = t
+		in.globalSeq = append(in.globalSeq, name)
+	}
+	return t
+}
+
+func (in *inferrer) block(list []ast.Stmt) {
+	for _, s := range list {
+		in.stmt(s)
+	}
+}
+
+func (in *inferrer) stmt(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		in.block(s.List)
+	case *ast.ExprStmt:
+		if call, ok := unparen(s.X).(*ast.CallExpr); ok {
+			in.call(call, 0, true)
+		} else {
+			in.expr(s.X)
+		}
+	case *ast.AssignStmt:
+		in.assign(s)
+	case *ast.DeclStmt:
+		if decl, ok := s.Decl.(*ast.GenDecl); ok {
+			in.genDecl(decl)
+		}
+	case *ast.ReturnStmt:
+		in.ret(s)
+	case *ast.IfStmt:
+		if s.Init != nil {
+			in.stmt(s.Init)
+		}
+		unify(in.expr(s.Cond), basic("bool"))
+		in.block(s.Body.List)
+		if s.Else != nil {
+			in.stmt(s.Else)
+		}
+	case *ast.ForStmt:
+		if s.Init != nil {
+			in.stmt(s.Init)
+		}
+		if s.Cond != nil {
+			unify(in.expr(s.Cond), basic("bool"))
+		}
+		if s.Post != nil {
+			in.stmt(s.Post)
+		}
+		in.block(s.Body.List)
+	case *ast.RangeStmt:
+		in.rangeStmt(s)
+	case *ast.SwitchStmt:
+		if s.Init != nil {
+			in.stmt(s.Init)
+		}
+		tag := basic("bool")
+		if s.Tag != nil {
+			tag = in.expr(s.Tag)
+		}
+		for _, c := range s.Body.List {
+			clause := c.(*ast.CaseClause)
+			for _, e := range clause.List {
+				unify(in.expr(e), tag)
+			}
+			in.block(clause.Body)
+		}
+	case *ast.TypeSwitchStmt:
+		in.typeSwitch(s)
+	case *ast.SelectStmt:
+		for _, c := range s.Body.List {
+			clause := c.(*ast.CommClause)
+			if clause.Comm != nil {
+				in.stmt(clause.Comm)
+			}
+			in.block(clause.Body)
+		}
+	case *ast.SendStmt:
+		assign(in.chanElem(in.expr(s.Chan)), in.expr(s.Value))
+	case *ast.IncDecStmt:
+		in.numeric(in.expr(s.X))
+	case *ast.GoStmt:
+		in.call(s.Call, 0, true)
+	case *ast.DeferStmt:
+		in.call(s.Call, 0, true)
+	case *ast.LabeledStmt:
+		in.stmt(s.Stmt)
+	}
+}
+
+func (in *inferrer) assign(s *ast.AssignStmt) {
+	if s.Tok != token.ASSIGN && s.Tok != token.DEFINE {
+		unify(in.lhs(s.Lhs[0]), in.expr(s.Rhs[0]))
+		return
+	}
+	var rhs []*term
+	if len(s.Lhs) == len(s.Rhs) {
+		for _, r := range s.Rhs {
+			rhs = append(rhs, in.expr(r))
+		}
+	} else {
+		rhs = in.multi(s.Rhs[0], len(s.Lhs))
+	}
+	for i, l := range s.Lhs {
+		if id, ok := l.(*ast.Ident); ok && s.Tok == token.DEFINE {
+			in.define(id, rhs[i])
+			continue
+		}
+		if id, ok := l.(*ast.Ident); ok && id.Name == "_" {
+			continue
+		}
+		assign(in.lhs(l), rhs[i])
+	}
+}
+
+// lhs types an assigned expression, recording assigned globals
+func (in *inferrer) lhs(e ast.Expr) *term {
+	if id, ok := e.(*ast.Ident); ok && in.undefined(id) {
+		in.assigned[id.Name] = true
+	}
+	return in.expr(e)
+}
+
+func (in *inferrer) valueSpec(spec *ast.ValueSpec) {
+	var typ *term
+	if spec.Type != nil {
+		typ = in.typeOf(spec.Type)
+	}
+	var values []*term
+	switch {
+	case len(spec.Values) == len(spec.Names):
+		for _, v := range spec.Values {
+			values = append(values, in.exprWant(v, typ))
+		}
+	case len(spec.Values) == 1:
+		values = in.multi(spec.Values[0], len(spec.Names))
+	}
+	for i, name := range spec.Names {
+		t := typ
+		if t == nil {
+			t = fresh()
+		}
+		if i < len(values) {
+			assign(t, values[i])
+		}
+		in.define(name, t)
+	}
+}
+
+func (in *inferrer) ret(s *ast.ReturnStmt) {
+	if len(in.results) == 0 {
+		return
+	}
+	results := in.results[len(in.results)-1]
+	switch {
+	case len(s.Results) == len(results):
+		for i, r := range s.Results {
+			assign(results[i], in.exprWant(r, results[i]))
+		}
+	case len(s.Results) == 1 && len(results) > 1:
+		for i, t := range in.multi(s.Results[0], len(results)) {
+			assign(results[i], t)
+		}
+	default:
+		for _, r := range s.Results {
+			in.expr(r)
+		}
+	}
+}
+
+func (in *inferrer) rangeStmt(s *ast.RangeStmt) {
+	x := in.expr(s.X)
+	r := in.shape(x, func() *term { return sliceOf(fresh()) })
+	if r.kind == pointerKind {
+		r = resolve(r.elem)
+	}
+	var key, value *term
+	switch r.kind {
+	case sliceKind, arrayKind:
+		key, value = basic("int"), r.elem
+	case mapKind:
+		key, value = r.key, r.elem
+	case chanKind:
+		key = r.elem
+	case basicKind:
+		if r.name == "string" {
+			key, value = basic("int"), basic("rune")
+		} else {
+			key = r
+		}
+	}
+	for _, pair := range []struct {
+		e ast.Expr
+		t *term
+	}{{s.Key, key}, {s.Value, value}} {
+		if pair.e == nil {
+			continue
+		}
+		t := pair.t
+		if t == nil {
+			t = fresh()
+		}
+		if id, ok := pair.e.(*ast.Ident); ok && s.Tok == token.DEFINE {
+			in.define(id, t)
+		} else {
+			unify(in.lhs(pair.e), t)
+		}
+	}
+	in.block(s.Body.List)
+}
+
+func (in *inferrer) typeSwitch(s *ast.TypeSwitchStmt) {
+	if s.Init != nil {
+		in.stmt(s.Init)
+	}
+	var x ast.Expr
+	switch a := s.Assign.(type) {
+	case *ast.AssignStmt:
+		x = a.Rhs[0]
+	case *ast.ExprStmt:
+		x = a.X
+	}
+	subject := fresh()
+	if assert, ok := x.(*ast.TypeAssertExpr); ok {
+		subject = in.expr(assert.X)
+		unify(subject, &term{kind: interfaceKind})
+	}
+	for _, c := range s.Body.List {
+		clause := c.(*ast.CaseClause)
+		var caseType *term
+		for _, e := range clause.List {
+			if id, ok := e.(*ast.Ident); ok && id.Name == "nil" {
+				continue
+			}
+			caseType = in.typeOf(e)
+		}
+		if obj := in.info.Implicits[clause]; obj != nil {
+			if len(clause.List) == 1 && caseType != nil {
+				in.objects[obj] = caseType
+			} else {
+				in.objects[obj] = subject
+			}
+		}
+		in.block(clause.Body)
+	}
+}
+
+func (in *inferrer) expr(e ast.Expr) *term {
+	return in.exprWant(e, nil)
+}
+
+// exprWant types an expression; want is the expected type, used for elided composite literal types
+func (in *inferrer) exprWant(e ast.Expr, want *term) *term {
+	t := in.structural(e, want)
+	if tv, ok := in.info.Types[e]; ok && tv.IsValue() {
+		if typed := in.fromTypes(tv.Type); typed != nil {
+			unify(t, typed)
+		}
+	}
+	return t
+}
+
+func (in *inferrer) structural(e ast.Expr, want *term) *term {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return in.ident(e)
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.STRING:
+			return hinted(hintString)
+		case token.FLOAT:
+			return hinted(hintFloat)
+		}
+		return hinted(hintInt)
+	case *ast.CompositeLit:
+		return in.composite(e, want)
+	case *ast.FuncLit:
+		sig := in.funcType(e.Type)
+		in.results = append(in.results, sig.results)
+		in.block(e.Body.List)
+		in.results = in.results[:len(in.results)-1]
+		return funcTerm(sig)
+	case *ast.ParenExpr:
+		return in.exprWant(e.X, want)
+	case *ast.SelectorExpr:
+		if in.isPackage(e.X) {
+			return fresh()
+		}
+		return in.selectOn(in.expr(e.X), e.Sel.Name, false)
+	case *ast.IndexExpr:
+		return in.index(e)
+	case *ast.SliceExpr:
+		x := in.expr(e.X)
+		for _, bound := range []ast.Expr{e.Low, e.High, e.Max} {
+			if bound != nil {
+				in.numeric(in.expr(bound))
+			}
+		}
+		r := in.shape(x, func() *term { return sliceOf(fresh()) })
+		if r.kind == pointerKind && resolve(r.elem).kind == arrayKind {
+			return sliceOf(resolve(r.elem).elem)
+		}
+		if r.kind == arrayKind {
+			return sliceOf(r.elem)
+		}
+		return x
+	case *ast.TypeAssertExpr:
+		unify(in.expr(e.X), &term{kind: interfaceKind})
+		if e.Type == nil {
+			return fresh()
+		}
+		return in.typeOf(e.Type)
+	case *ast.StarExpr:
+		r := in.shape(in.expr(e.X), func() *term { return pointerTo(fresh()) })
+		if r.kind == pointerKind {
+			return r.elem
+		}
+		return fresh()
+	case *ast.UnaryExpr:
+		return in.unary(e)
+	case *ast.BinaryExpr:
+		return in.binary(e)
+	case *ast.CallExpr:
+		return in.call(e, 1, false)[0]
+	}
+	return fresh()
+}
+
+func (in *inferrer) ident(id *ast.Ident) *term {
+	obj := in.info.Uses[id]
+	if obj == nil {
+		obj = in.info.Defs[id]
+	}
+	switch obj := obj.(type) {
+	case nil:
+		if id.Name == "_" {
+			return fresh()
+		}
+		if m := constPattern.FindStringSubmatch(id.Name); m != nil {
+			in.consts[id.Name] = true
+			if m[1] == "FloatConst" {
+				return hinted(hintFloat)
+			}
+			return hinted(hintInt)
+		}
+		return in.global(id.Name)
+	case *types.Var, *types.Func:
+		return in.objectTerm(obj)
+	case *types.Nil:
+		return hinted(hintNil)
+	case *types.Const:
+		if t := in.fromTypes(obj.Type()); t != nil {
+			return t
+		}
+	}
+	return fresh()
+}
+
+func (in *inferrer) unary(e *ast.UnaryExpr) *term {
+	x := in.expr(e.X)
+	switch e.Op {
+	case token.AND:
+		return pointerTo(x)
+	case token.NOT:
+		unify(x, basic("bool"))
+		return x
+	case token.ARROW:
+		return in.chanElem(x)
+	}
+	in.numeric(x)
+	return x
+}
+
+func (in *inferrer) binary(e *ast.BinaryExpr) *term {
+	x, y := in.expr(e.X), in.expr(e.Y)
+	switch e.Op {
+	case token.LAND, token.LOR:
+		unify(x, basic("bool"))
+		unify(y, basic("bool"))
+		return basic("bool")
+	case token.EQL, token.NEQ:
+		unify(x, y)
+		return basic("bool")
+	case token.LSS, token.GTR, token.LEQ, token.GEQ:
+		unify(x, y)
+		in.numeric(x)
+		return basic("bool")
+	case token.SHL, token.SHR:
+		in.numeric(x)
+		in.numeric(y)
+		return x
+	}
+	unify(x, y)
+	if e.Op != token.ADD {
+		in.numeric(x)
+	}
+	return x
+}
+
+// numeric hints that an otherwise unknown type is an integer
+func (in *inferrer) numeric(t *term) {
+	switch t = resolve(t); t.kind {
+	case unknownKind:
+		t.hints |= hintInt
+	case namedKind:
+		findNamed(t.named).hints |= hintInt
+	}
+}
+
+// resolve follows unification links and stub type aliases
+func resolve(t *term) *term {
+	seen := make(map[*named]bool)
+	for {
+		t = find(t)
+		if t.kind != namedKind {
+			return t
+		}
+		n := findNamed(t.named)
+		if n.alias == nil || seen[n] {
+			return t
+		}
+		seen[n] = true
+		t = n.alias
+	}
+}
+
+// shape resolves t, giving it the shape built by make if its shape is still open
+func (in *inferrer) shape(t *term, make func() *term) *term {
+	r := resolve(t)
+	if r.kind == unknownKind || r.kind == namedKind && !findNamed(r.named).isStruct() {
+		unify(r, make())
+		r = resolve(t)
+	}
+	return r
+}
+
+func (in *inferrer) chanElem(ch *term) *term {
+	r := in.shape(ch, func() *term { return &term{kind: chanKind, elem: fresh(), dir: ast.SEND | ast.RECV} })
+	if r.kind == chanKind {
+		return r.elem
+	}
+	return fresh()
+}
+
+// selectOn returns the type of field or method name of x, adding it to a stub type if needed
+func (in *inferrer) selectOn(x *term, name string, call bool) *term {
+	t := resolve(x)
+	if t.kind == unknownKind {
+		n := in.synthetic()
+		unify(t, pointerTo(namedTerm(n)))
+		return in.member(n, name, call)
+	}
+	if t.kind == pointerKind {
+		t = resolve(t.elem)
+		if t.kind == unknownKind {
+			n := in.synthetic()
+			unify(t, namedTerm(n))
+			return in.member(n, name, call)
+		}
+	}
+	if t.kind == namedKind {
+		return in.member(findNamed(t.named), name, call)
+	}
+	if t.kind == sourceKind && t.named != nil {
+		if f, ok := t.named.fields[name]; ok {
+			return f
+		}
+	}
+	return fresh()
+}
+
+func (in *inferrer) member(n *named, name string, call bool) *term {
+	if f, ok := n.fields[name]; ok {
+		return f
+	}
+	if m, ok := n.methods[name]; ok {
+		return m
+	}
+	t := fresh()
+	if call {
+		n.addMethod(name, t)
+	} else {
+		n.addField(name, t)
+	}
+	return t
+}
+
+func (in *inferrer) index(e *ast.IndexExpr) *term {
+	x, k := in.expr(e.X), in.expr(e.Index)
+	r := in.shape(x, func() *term {
+		if isInteger(k) {
+			return sliceOf(fresh())
+		}
+		return &term{kind: mapKind, key: k, elem: fresh()}
+	})
+	if r.kind == pointerKind && resolve(r.elem).kind == arrayKind {
+		r = resolve(r.elem)
+	}
+	switch r.kind {
+	case mapKind:
+		unify(r.key, k)
+		return r.elem
+	case sliceKind, arrayKind:
+		in.numeric(k)
+		return r.elem
+	case basicKind:
+		return basic("byte")
+	}
+	return fresh()
+}
+
+func isInteger(t *term) bool {
+	t = resolve(t)
+	switch t.kind {
+	case unknownKind:
+		return t.hints == hintInt
+	case basicKind:
+		switch t.name {
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte", "rune":
+			return true
+		}
+	}
+	return false
+}
+
+func (in *inferrer) composite(e *ast.CompositeLit, want *term) *term {
+	t := want
+	if e.Type != nil {
+		t = in.typeOf(e.Type)
+	} else if t == nil {
+		t = fresh()
+	}
+	r := resolve(t)
+	if r.kind == pointerKind {
+		// Elided &T{} inside a slice or map literal
+		r = resolve(r.elem)
+	}
+	if len(e.Elts) > 0 && (r.kind == unknownKind || r.kind == namedKind && !findNamed(r.named).isStruct()) {
+		// The elements decide an open shape: field names make a struct stub,
+		// other keys a map and positional elements a slice
+		kv, keyed := e.Elts[0].(*ast.KeyValueExpr)
+		switch {
+		case !keyed && r.kind == namedKind:
+			var elts []*term
+			for _, elt := range e.Elts {
+				elts = append(elts, in.expr(elt))
+			}
+			if !mixed(elts) {
+				unify(r, sliceOf(elts[0]))
+				for _, elt := range elts[1:] {
+					unify(elts[0], elt)
+				}
+				return t
+			}
+			// Elements of different types make a struct with positional fields
+			n := findNamed(r.named)
+			for i, elt := range elts {
+				assign(in.member(n, "f"+strconv.Itoa(i), false), elt)
+			}
+			return t
+		case !keyed:
+			unify(r, sliceOf(fresh()))
+		case r.kind == unknownKind || !isIdent(kv.Key):
+			// Maps written with literal keys are mostly heterogeneous, such as log fields
+			unify(r, &term{kind: mapKind, key: fresh(), elem: &term{kind: interfaceKind}})
+		}
+		r = resolve(r)
+	}
+
+	switch {
+	case r.kind == namedKind || r.kind == sourceKind && r.named != nil:
+		for _, elt := range e.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				in.expr(elt)
+				continue
+			}
+			if key, ok := kv.Key.(*ast.Ident); ok {
+				field := in.selectOn(r, key.Name, false)
+				assign(field, in.exprWant(kv.Value, field))
+			}
+		}
+	case r.kind == sliceKind || r.kind == arrayKind:
+		for _, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				in.numeric(in.expr(kv.Key))
+				elt = kv.Value
+			}
+			assign(r.elem, in.exprWant(elt, r.elem))
+		}
+	case r.kind == mapKind:
+		for _, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				unify(in.exprWant(kv.Key, r.key), r.key)
+				assign(r.elem, in.exprWant(kv.Value, r.elem))
+			}
+		}
+	default:
+		for _, elt := range e.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			in.expr(elt)
+		}
+	}
+	return t
+}
+
+// call types a call expression and returns want results.
+// flexible calls (statements, go and defer) leave the result count open.
+func (in *inferrer) call(e *ast.CallExpr, want int, flexible bool) []*term {
+	if in.isConversion(e.Fun) {
+		t := in.typeOf(e.Fun)
+		for _, arg := range e.Args {
+			unify(in.expr(arg), t)
+		}
+		return pad([]*term{t}, want)
+	}
+	if id, ok := unparen(e.Fun).(*ast.Ident); ok {
+		if b, ok := in.info.Uses[id].(*types.Builtin); ok {
+			return pad(in.builtin(b.Name(), e), want)
+		}
+	}
+
+	var fn *term
+	if sel, ok := unparen(e.Fun).(*ast.SelectorExpr); ok && !in.isPackage(sel.X) {
+		recv := in.expr(sel.X)
+		fn = in.selectOn(recv, sel.Sel.Name, true)
+		if r := resolve(recv); r.kind == namedKind && !addressable(sel.X) {
+			findNamed(r.named).valueRecv = true
+		}
+		if tv, ok := in.info.Types[sel]; ok {
+			if typed := in.fromTypes(tv.Type); typed != nil {
+				unify(fn, typed)
+			}
+		}
+	} else {
+		fn = in.expr(e.Fun)
+	}
+	var args []*term
+	for _, arg := range e.Args {
+		args = append(args, in.expr(arg))
+	}
+	return in.apply(fn, args, e.Ellipsis.IsValid(), want, flexible)
+}
+
+// apply unifies a function type with a call of it
+func (in *inferrer) apply(fn *term, args []*term, ellipsis bool, want int, flexible bool) []*term {
+	f := resolve(fn)
+	if f.kind == unknownKind || f.kind == namedKind && !findNamed(f.named).isStruct() {
+		sig := &signature{variadic: ellipsis, fixed: !flexible}
+		for i, arg := range args {
+			p := fresh()
+			if ellipsis && i == len(args)-1 {
+				p = sliceOf(fresh())
+			}
+			unify(p, arg)
+			sig.params = append(sig.params, p)
+		}
+		for i := 0; i < want; i++ {
+			sig.results = append(sig.results, fresh())
+		}
+		unify(f, funcTerm(sig))
+		return sig.results
+	}
+	if f.kind != funcKind {
+		return pad(nil, want)
+	}
+
+	sig := f.sig
+	switch {
+	case sig.loose:
+	case sig.variadic && !ellipsis && len(args) >= len(sig.params)-1:
+		last := len(sig.params) - 1
+		for i, arg := range args {
+			if i < last {
+				assign(sig.params[i], arg)
+			} else if r := resolve(sig.params[last]); r.kind == sliceKind {
+				assign(r.elem, arg)
+			}
+		}
+	case len(args) == len(sig.params):
+		for i, arg := range args {
+			assign(sig.params[i], arg)
+		}
+	default:
+		sig.loose = true
+	}
+	if !sig.fixed && !flexible {
+		for len(sig.results) < want {
+			sig.results = append(sig.results, fresh())
+		}
+		sig.results = sig.results[:want]
+		sig.fixed = true
+	}
+	if flexible || len(sig.results) == want {
+		return sig.results
+	}
+	return pad(nil, want)
+}
+
+func pad(ts []*term, n int) []*term {
+	for len(ts) < n {
+		ts = append(ts, fresh())
+	}
+	return ts[:n]
+}
+
+func (in *inferrer) builtin(name string, e *ast.CallExpr) []*term {
+	arg := func(i int) *term {
+		if i < len(e.Args) {
+			return in.expr(e.Args[i])
+		}
+		return fresh()
+	}
+	switch name {
+	case "len", "cap":
+		if t := find(arg(0)); t.kind == unknownKind {
+			t.hints |= hintSized
+		}
+		return []*term{basic("int")}
+	case "append":
+		s := arg(0)
+		r := in.shape(s, func() *term { return sliceOf(fresh()) })
+		for i := 1; i < len(e.Args); i++ {
+			if e.Ellipsis.IsValid() {
+				unify(in.expr(e.Args[i]), s)
+			} else if r.kind == sliceKind {
+				assign(r.elem, in.exprWant(e.Args[i], r.elem))
+			}
+		}
+		return []*term{s}
+	case "make":
+		t := in.typeOf(e.Args[0])
+		for i := 1; i < len(e.Args); i++ {
+			in.numeric(in.expr(e.Args[i]))
+		}
+		return []*term{t}
+	case "new":
+		return []*term{pointerTo(in.typeOf(e.Args[0]))}
+	case "delete":
+		m, k := arg(0), arg(1)
+		r := in.shape(m, func() *term { return &term{kind: mapKind, key: fresh(), elem: fresh()} })
+		if r.kind == mapKind {
+			unify(r.key, k)
+		}
+		return nil
+	case "close":
+		in.chanElem(arg(0))
+		return nil
+	case "copy":
+		unify(arg(0), arg(1))
+		return []*term{basic("int")}
+	case "recover":
+		return []*term{{kind: interfaceKind}}
+	case "min", "max":
+		t := arg(0)
+		for i := 1; i < len(e.Args); i++ {
+			unify(t, in.expr(e.Args[i]))
+		}
+		return []*term{t}
+	}
+	for i := range e.Args {
+		arg(i)
+	}
+	return []*term{fresh()}
+}
+
+// multi types an expression assigned to n variables
+func (in *inferrer) multi(e ast.Expr, n int) []*term {
+	switch e := unparen(e).(type) {
+	case *ast.CallExpr:
+		return pad(in.call(e, n, false), n)
+	case *ast.IndexExpr:
+		return pad([]*term{in.index(e), basic("bool")}, n)
+	case *ast.TypeAssertExpr:
+		return pad([]*term{in.expr(e), basic("bool")}, n)
+	case *ast.UnaryExpr:
+		if e.Op == token.ARROW {
+			return pad([]*term{in.expr(e), basic("bool")}, n)
+		}
+	}
+	return pad([]*term{in.expr(e)}, n)
+}
+
+// isConversion reports whether fun is a type, making the call a conversion
+func (in *inferrer) isConversion(fun ast.Expr) bool {
+	fun = unparen(fun)
+	if tv, ok := in.info.Types[fun]; ok && tv.IsType() {
+		return true
+	}
+	switch fun := fun.(type) {
+	case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.StructType:
+		return true
+	case *ast.StarExpr:
+		return in.isConversion(fun.X)
+	case *ast.Ident:
+		_, ok := in.stubs[fun.Name]
+		return ok && in.undefined(fun)
+	}
+	return false
+}
+
+// isPackage reports whether e names an imported package
+func (in *inferrer) isPackage(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, ok = in.info.Uses[id].(*types.PkgName)
+	return ok
+}
+
+func (in *inferrer) undefined(id *ast.Ident) bool {
+	return in.info.Uses[id] == nil && in.info.Defs[id] == nil
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+func isIdent(e ast.Expr) bool {
+	_, ok := e.(*ast.Ident)
+	return ok
+}
+
+// addressable approximates whether pointer methods can be called on e
+func addressable(e ast.Expr) bool {
+	switch e := unparen(e).(type) {
+	case *ast.Ident, *ast.SelectorExpr, *ast.StarExpr:
+		return true
+	case *ast.IndexExpr:
+		return addressable(e.X)
+	}
+	return false
+}
+
+// mixed reports whether the terms visibly differ in type
+func mixed(ts []*term) bool {
+	first := resolve(ts[0])
+	for _, t := range ts[1:] {
+		r := resolve(t)
+		if r.kind != first.kind || r.kind == unknownKind && r.hints != first.hints || r.kind == basicKind && r.name != first.name {
+			return true
+		}
+	}
+	return false
+}
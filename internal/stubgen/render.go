@@ -0,0 +1,413 @@
+package stubgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// waitGroupField is the hidden field that lets synthesized Go and Wait methods
+// spawn and join goroutines, so races in the skeleton can actually happen
+const waitGroupField = "stubWG"
+
+// render prints an inferred type as Go source
+func render(t *term) string {
+	t = find(t)
+	switch t.kind {
+	case basicKind, sourceKind:
+		return t.name
+	case errorKind:
+		return "error"
+	case interfaceKind:
+		return "interface{}"
+	case namedKind:
+		return findNamed(t.named).name
+	case pointerKind:
+		if e := resolve(t.elem); e.kind == namedKind {
+			if n := findNamed(e.named); isSynthetic(n.name) && syncType(n) != "" {
+				// The pointer was only guessed from a method call; a nil lock would panic
+				return n.name
+			}
+		}
+		return "*" + render(t.elem)
+	case sliceKind:
+		return "[]" + render(t.elem)
+	case arrayKind:
+		return "[" + t.length + "]" + render(t.elem)
+	case mapKind:
+		return "map[" + render(t.key) + "]" + render(t.elem)
+	case chanKind:
+		switch t.dir {
+		case ast.SEND:
+			return "chan<- " + render(t.elem)
+		case ast.RECV:
+			return "<-chan " + render(t.elem)
+		}
+		elem := render(t.elem)
+		if strings.HasPrefix(elem, "<-") {
+			elem = "(" + elem + ")"
+		}
+		return "chan " + elem
+	case funcKind:
+		return "func" + signatureString(t.sig, false)
+	}
+	return defaultType(t.hints)
+}
+
+// defaultType picks the type of a value that is only known by how it is used
+func defaultType(h hint) string {
+	switch {
+	case h&hintSized != 0:
+		return "[]interface{}"
+	case h&hintNil != 0:
+		return "interface{}"
+	case h&hintFloat != 0:
+		return "float64"
+	case h&hintInt != 0:
+		return "int"
+	case h&hintString != 0:
+		return "string"
+	case h&hintBool != 0:
+		return "bool"
+	}
+	return "interface{}"
+}
+
+// signatureString prints parameters and results, naming them p0, p1... and r0, r1... for declarations
+func signatureString(sig *signature, names bool) string {
+	var params []string
+	if sig.loose {
+		params = []string{"...interface{}"}
+		if names {
+			params[0] = "p " + params[0]
+		}
+	} else {
+		for i, p := range sig.params {
+			s := render(p)
+			if sig.variadic && i == len(sig.params)-1 {
+				if r := resolve(p); r.kind == sliceKind {
+					s = "..." + render(r.elem)
+				}
+			}
+			if names {
+				s = "p" + strconv.Itoa(i) + " " + s
+			}
+			params = append(params, s)
+		}
+	}
+	out := "(" + strings.Join(params, ", ") + ")"
+
+	var results []string
+	for i, r := range sig.results {
+		s := render(r)
+		if names {
+			s = "r" + strconv.Itoa(i) + " " + s
+		}
+		results = append(results, s)
+	}
+	switch {
+	case len(results) == 1 && !names:
+		out += " " + results[0]
+	case len(results) > 0:
+		out += " (" + strings.Join(results, ", ") + ")"
+	}
+	return out
+}
+
+// spawns reports whether a stub method is a Go(func()) spawner
+func spawns(name string, fn *term) bool {
+	f := find(fn)
+	if name != "Go" || f.kind != funcKind || f.sig.loose || len(f.sig.params) != 1 {
+		return false
+	}
+	p := resolve(f.sig.params[0])
+	return p.kind == funcKind && !p.sig.loose && len(p.sig.params) == 0
+}
+
+// mentions reports whether t refers to the stub type n without going through another named type
+func mentions(t *term, n *named) bool {
+	t = find(t)
+	if t.kind == namedKind {
+		return findNamed(t.named) == n
+	}
+	for _, child := range []*term{t.elem, t.key} {
+		if child != nil && mentions(child, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// source renders the declarations of every undefined name as a Go file of package pkg.
+// imports maps package names the skeleton imports to their paths.
+func (in *inferrer) source(pkg string, imports map[string]string) ([]byte, error) {
+	var b bytes.Buffer
+
+	var consts []string
+	for name := range in.consts {
+		consts = append(consts, name)
+	}
+	sort.Slice(consts, func(i, j int) bool { return placeholderLess(consts[i], consts[j]) })
+	if len(consts) > 0 {
+		b.WriteString("const (\n")
+		for _, name := range consts {
+			m := constPattern.FindStringSubmatch(name)
+			n, _ := strconv.Atoi(m[2])
+			if m[1] == "FloatConst" {
+				fmt.Fprintf(&b, "%s = %d.5\n", name, n+1)
+			} else {
+				fmt.Fprintf(&b, "%s = %d\n", name, n+1)
+			}
+		}
+		b.WriteString(")\n\n")
+	}
+
+	for _, n := range in.stubSeq {
+		if findNamed(n) != n {
+			continue
+		}
+		in.writeType(&b, n)
+	}
+
+	for _, name := range in.globalSeq {
+		if _, ok := in.stubs[name]; ok {
+			// Also used as a type; the type declaration wins
+			continue
+		}
+		t := resolve(in.globals[name])
+		if t.kind == funcKind && !in.assigned[name] {
+			writeFunc(&b, "", name, t.sig, false, in.populate)
+			continue
+		}
+		if t.kind == pointerKind {
+			if elem := resolve(t.elem); elem.kind == namedKind && findNamed(elem.named).isStruct() {
+				// Receivers of synthesized methods must not be nil
+				fmt.Fprintf(&b, "var %s = &%s{}\n\n", name, render(t.elem))
+				continue
+			}
+		}
+		if in.populate && (t.kind != basicKind || t.name == "bool") {
+			if v := populated(in.globals[name], populateDepth); v != "" {
+				fmt.Fprintf(&b, "var %s %s = %s\n\n", name, render(in.globals[name]), v)
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "var %s %s\n\n", name, render(in.globals[name]))
+	}
+
+	body := b.Bytes()
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "// Code generated by stubgen. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	var paths []string
+	for name, path := range imports {
+		if regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\.`).Match(body) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&header, "import %q\n", path)
+	}
+	header.WriteString("\n")
+	header.Write(body)
+	return format.Source(header.Bytes())
+}
+
+func (in *inferrer) writeType(b *bytes.Buffer, n *named) {
+	switch {
+	case n.alias != nil:
+		if mentions(n.alias, n) {
+			fmt.Fprintf(b, "type %s %s\n\n", n.name, render(n.alias))
+		} else {
+			fmt.Fprintf(b, "type %s = %s\n\n", n.name, render(n.alias))
+		}
+		return
+	case !n.isStruct():
+		if n.hints != 0 {
+			fmt.Fprintf(b, "type %s = %s\n\n", n.name, defaultType(n.hints))
+		} else {
+			fmt.Fprintf(b, "type %s struct{}\n\n", n.name)
+		}
+		return
+	}
+
+	if lib := syncType(n); lib != "" {
+		fmt.Fprintf(b, "type %s = %s\n\n", n.name, lib)
+		return
+	}
+
+	spawner := false
+	for _, name := range n.methSeq {
+		if !n.declared[name] && spawns(name, n.methods[name]) {
+			spawner = true
+		}
+	}
+	if len(n.fieldSeq) == 0 && !spawner {
+		fmt.Fprintf(b, "type %s struct{}\n\n", n.name)
+	} else {
+		fmt.Fprintf(b, "type %s struct {\n", n.name)
+		for _, name := range n.fieldSeq {
+			fmt.Fprintf(b, "%s %s\n", name, render(n.fields[name]))
+		}
+		if spawner {
+			fmt.Fprintf(b, "%s sync.WaitGroup\n", waitGroupField)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	for _, name := range n.methSeq {
+		if n.declared[name] {
+			continue
+		}
+		sig := &signature{}
+		if m := resolve(n.methods[name]); m.kind == funcKind {
+			sig = m.sig
+		}
+		recv := "*" + n.name
+		if n.valueRecv && !spawner {
+			recv = n.name
+		}
+		writeFunc(b, recv, name, sig, spawner, in.populate)
+	}
+}
+
+// syncMethods lists the methods of the sync types that stubs used only as locks
+// or wait groups become, with their number of parameters
+var syncMethods = []struct {
+	typ     string
+	methods map[string]int
+}{
+	{"sync.Mutex", map[string]int{"Lock": 0, "Unlock": 0}},
+	{"sync.RWMutex", map[string]int{"Lock": 0, "Unlock": 0, "RLock": 0, "RUnlock": 0}},
+	{"sync.WaitGroup", map[string]int{"Add": 1, "Done": 0, "Wait": 0}},
+}
+
+// syncType returns the sync type a field-less stub is used as, so that
+// locking in the skeleton actually excludes, or "" if there is none
+func syncType(n *named) string {
+	if len(n.fieldSeq) > 0 || n.valueRecv {
+		return ""
+	}
+	for _, lib := range syncMethods {
+		matches := true
+		for _, name := range n.methSeq {
+			params, ok := lib.methods[name]
+			m := resolve(n.methods[name])
+			if !ok || n.declared[name] || m.kind != funcKind || m.sig.loose || len(m.sig.params) != params || len(m.sig.results) > 0 {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return lib.typ
+		}
+	}
+	return ""
+}
+
+// writeFunc writes a function or, with a receiver, a method returning zero or
+// populated values. On spawner types Go runs its argument in a goroutine and Wait joins them.
+func writeFunc(b *bytes.Buffer, recv, name string, sig *signature, spawner, populate bool) {
+	if recv != "" {
+		fmt.Fprintf(b, "func (s %s) ", recv)
+	} else {
+		b.WriteString("func ")
+	}
+	fmt.Fprintf(b, "%s%s {\n", name, signatureString(sig, true))
+	switch {
+	case spawner && spawns(name, funcTerm(sig)):
+		fmt.Fprintf(b, "s.%s.Add(1)\ngo func() {\ndefer s.%[1]s.Done()\np0()\n}()\n", waitGroupField)
+	case spawner && name == "Wait":
+		fmt.Fprintf(b, "s.%s.Wait()\n", waitGroupField)
+	case populate && !sig.loose:
+		// Run callbacks, as the functions taking them usually do
+		for i, p := range sig.params {
+			f := resolve(p)
+			if f.kind != funcKind || f.sig.loose || f.sig.variadic || sig.variadic && i == len(sig.params)-1 {
+				continue
+			}
+			var args []string
+			for _, q := range f.sig.params {
+				args = append(args, populatedOrZero(q, populateDepth))
+			}
+			fmt.Fprintf(b, "if p%d != nil {\np%[1]d(%s)\n}\n", i, strings.Join(args, ", "))
+		}
+	}
+	for i, r := range sig.results {
+		if !populate {
+			break
+		}
+		if v := populated(r, populateDepth); v != "" {
+			fmt.Fprintf(b, "r%d = %s\n", i, v)
+		}
+	}
+	if len(sig.results) > 0 {
+		b.WriteString("return\n")
+	}
+	b.WriteString("}\n\n")
+}
+
+const (
+	populateLen   = 2 // Elements of populated slices, so that goroutines spawned per element race
+	populateDepth = 3
+)
+
+// populated returns a non-empty value of type t, or "" to keep the zero value
+func populated(t *term, depth int) string {
+	if depth == 0 {
+		return ""
+	}
+	typ := render(t)
+	r := resolve(t)
+	switch r.kind {
+	case basicKind:
+		switch r.name {
+		case "string":
+			return ""
+		case "bool":
+			// Skeletons mostly keep the conditions that lead to the race
+			return "true"
+		}
+		return strconv.Itoa(populateLen)
+	case pointerKind:
+		if !strings.HasPrefix(render(r), "*") {
+			// Rendered as a value, see render
+			return ""
+		}
+		return "new(" + render(r.elem) + ")"
+	case sliceKind:
+		elems := make([]string, populateLen)
+		for i := range elems {
+			elems[i] = populatedOrZero(r.elem, depth-1)
+		}
+		return typ + "{" + strings.Join(elems, ", ") + "}"
+	case mapKind:
+		return typ + "{*new(" + render(r.key) + "): " + populatedOrZero(r.elem, depth-1) + "}"
+	case chanKind:
+		return "make(" + typ + ", " + strconv.Itoa(populateLen) + ")"
+	}
+	return ""
+}
+
+func populatedOrZero(t *term, depth int) string {
+	if v := populated(t, depth); v != "" {
+		return v
+	}
+	return "*new(" + render(t) + ")"
+}
+
+// placeholderLess orders placeholders by prefix, then numerically
+func placeholderLess(a, b string) bool {
+	ma, mb := constPattern.FindStringSubmatch(a), constPattern.FindStringSubmatch(b)
+	if ma == nil || mb == nil || ma[1] != mb[1] {
+		return a < b
+	}
+	na, _ := strconv.Atoi(ma[2])
+	nb, _ := strconv.Atoi(mb[2])
+	return na < nb
+}
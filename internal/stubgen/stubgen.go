@@ -0,0 +1,498 @@
+package stubgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uber/data-race-skeletons/internal/corpus"
+	"github.com/uber/data-race-skeletons/internal/skeletonizer"
+)
+
+const (
+	// StubFile is the module file holding the synthesized declarations
+	StubFile = "stubs.go"
+	// ModuleSuffix is appended to a skeleton's path to name its default module directory
+	ModuleSuffix = corpus.ModuleSuffix
+
+	modulePath   = "skeleton"
+	maxFixRounds = 3
+	goVersion    = "1.20"
+)
+
+// stdPackages maps the standard library packages skeletons may use without importing them
+var stdPackages = map[string]string{
+	"sync":    "sync",
+	"atomic":  "sync/atomic",
+	"context": "context",
+	"time":    "time",
+	"errors":  "errors",
+	"fmt":     "fmt",
+	"strings": "strings",
+	"strconv": "strconv",
+	"sort":    "sort",
+	"math":    "math",
+	"os":      "os",
+}
+
+var packagePattern = regexp.MustCompile(`^pkg[0-9]+$`)
+
+// Source is one Go file of a skeleton package
+type Source struct {
+	Name string
+	Src  []byte
+}
+
+// Module is a skeleton turned into a self-contained Go module. Members of
+// placeholder packages are flattened into the skeleton package (pkg0.v1 becomes
+// pkg0_v1), because Go does not allow selecting unexported names across packages.
+type Module struct {
+	// Files maps paths relative to the module root to their content
+	Files map[string][]byte
+}
+
+// Options controls how stubs are synthesized
+type Options struct {
+	// Populate makes synthesized functions return allocated pointers, non-empty
+	// slices and maps and non-zero numbers instead of zero values, so that code
+	// ranging over their results runs, as the race harness needs
+	Populate bool
+}
+
+// GenerateFiles reads skeleton files of one package and generates their module
+func GenerateFiles(filenames []string, opts Options) (*Module, error) {
+	var srcs []Source
+	for _, filename := range filenames {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		srcs = append(srcs, Source{Name: filepath.Base(filename), Src: src})
+	}
+	return Generate(srcs, opts)
+}
+
+// Generate synthesizes the declarations the skeleton files use but do not declare,
+// inferring minimal types from how each name is used
+func Generate(srcs []Source, opts Options) (*Module, error) {
+	if len(srcs) == 0 {
+		return nil, fmt.Errorf("no skeleton files")
+	}
+
+	// Import the standard library and flatten placeholder packages
+	fset, files, err := parseAll(srcs)
+	if err != nil {
+		return nil, err
+	}
+	_, info, _ := check(fset, files)
+	for i, file := range files {
+		srcs[i].Src, err = edit(srcs[i].Src, resolveImports(fset, file, info))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", srcs[i].Name, err)
+		}
+	}
+
+	// Infer the missing declarations
+	fset, files, err = parseAll(srcs)
+	if err != nil {
+		return nil, err
+	}
+	_, info, _ = check(fset, files)
+	in := newInferrer(info)
+	in.populate = opts.Populate
+	in.run(files)
+	stubs, err := in.source(files[0].Name.Name, stdPackages)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting stubs: %v", err)
+	}
+
+	// Unused variables and missing returns only matter to the compiler. Fixing
+	// them can expose more, such as a variable used only by a removed statement.
+	for round := 0; round < maxFixRounds; round++ {
+		fset, files, err = parseAll(append(srcs, Source{Name: StubFile, Src: stubs}))
+		if err != nil {
+			return nil, err
+		}
+		_, _, errs := check(fset, files)
+		fixed := false
+		for i := range srcs {
+			edits := compilerFixes(fset, files[i], errs)
+			if len(edits) == 0 {
+				continue
+			}
+			if srcs[i].Src, err = edit(srcs[i].Src, edits); err != nil {
+				return nil, fmt.Errorf("%s: %v", srcs[i].Name, err)
+			}
+			fixed = true
+		}
+		if !fixed {
+			break
+		}
+	}
+
+	m := &Module{Files: map[string][]byte{
+		"go.mod": []byte(fmt.Sprintf("module %s\n\ngo %s\n", modulePath, goVersion)),
+		StubFile: stubs,
+	}}
+	for _, src := range srcs {
+		out, err := format.Source(src.Src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", src.Name, err)
+		}
+		m.Files[src.Name] = out
+	}
+	return m, nil
+}
+
+// Write writes the module into dir, creating it if needed
+func (m *Module) Write(dir string) error {
+	for _, name := range m.sortedFiles() {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, m.Files[name], 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check type-checks the module and returns its errors
+func (m *Module) Check() []error {
+	_, errs := m.Package()
+	return errs
+}
+
+// Package type-checks the module. The package is returned even if it has errors.
+func (m *Module) Package() (*types.Package, []error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range m.sortedFiles() {
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || strings.Contains(name, "/") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, m.Files[name], 0)
+		if err != nil {
+			return nil, []error{err}
+		}
+		files = append(files, file)
+	}
+	pkg, _, errs := check(fset, files)
+	var out []error
+	for _, err := range errs {
+		out = append(out, err)
+	}
+	return pkg, out
+}
+
+func (m *Module) sortedFiles() []string {
+	var names []string
+	for name := range m.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseAll(srcs []Source) (*token.FileSet, []*ast.File, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, src := range srcs {
+		file, err := parser.ParseFile(fset, src.Name, src.Src, parser.ParseComments)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing file: %v", err)
+		}
+		if len(files) > 0 && file.Name.Name != files[0].Name.Name {
+			return nil, nil, fmt.Errorf("%s: package %s, expected %s", src.Name, file.Name.Name, files[0].Name.Name)
+		}
+		files = append(files, file)
+	}
+	return fset, files, nil
+}
+
+// stdImporter is shared because importing the standard library from source is slow.
+// The source importer is not safe for concurrent use.
+var stdImporter = struct {
+	sync.Mutex
+	types.Importer
+}{Importer: importer.ForCompiler(token.NewFileSet(), "source", nil)}
+
+type lockedImporter struct{}
+
+func (lockedImporter) Import(path string) (*types.Package, error) {
+	stdImporter.Lock()
+	defer stdImporter.Unlock()
+	return stdImporter.Import(path)
+}
+
+// check type-checks files as the module package, tolerating errors
+func check(fset *token.FileSet, files []*ast.File) (*types.Package, *types.Info, []types.Error) {
+	var errs []types.Error
+	conf := types.Config{
+		Importer: lockedImporter{},
+		Error: func(err error) {
+			if terr, ok := err.(types.Error); ok {
+				errs = append(errs, terr)
+			}
+		},
+	}
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Implicits: make(map[ast.Node]types.Object),
+	}
+	// Errors are collected by conf.Error
+	pkg, _ := conf.Check(modulePath, fset, files, info)
+	return pkg, info, errs
+}
+
+// textEdit replaces the source between two offsets
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+func edit(src []byte, edits []textEdit) ([]byte, error) {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	out := append([]byte(nil), src...)
+	last := len(out)
+	for _, e := range edits {
+		if e.start > e.end || e.end > last {
+			return nil, fmt.Errorf("overlapping edits at offset %d", e.start)
+		}
+		out = append(out[:e.start], append([]byte(e.text), out[e.end:]...)...)
+		last = e.start
+	}
+	return out, nil
+}
+
+func offset(fset *token.FileSet, pos token.Pos) int {
+	return fset.Position(pos).Offset
+}
+
+// resolveImports imports the standard library packages a file uses and flattens
+// selectors on every other undefined package, including non-standard imports
+func resolveImports(fset *token.FileSet, file *ast.File, info *types.Info) []textEdit {
+	var edits []textEdit
+	qualifiers := typeQualifiers(file)
+	imported := make(map[string]bool)
+	dropped := make(map[string]bool)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			dropped[name] = true
+			edits = append(edits, textEdit{start: offset(fset, spec.Pos()), end: offset(fset, spec.End())})
+			continue
+		}
+		imported[name] = true
+	}
+
+	var missing []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if (info.Uses[x] != nil || info.Defs[x] != nil) && !dropped[x.Name] {
+			return false
+		}
+		if path, ok := stdPackages[x.Name]; ok && !dropped[x.Name] {
+			if !imported[x.Name] {
+				imported[x.Name] = true
+				missing = append(missing, path)
+			}
+			return false
+		}
+		if dropped[x.Name] || qualifiers[x.Name] || packagePattern.MatchString(x.Name) || skeletonizer.ConcurrencyNames[x.Name] {
+			edits = append(edits, textEdit{start: offset(fset, x.Pos()), end: offset(fset, sel.End()), text: x.Name + "_" + sel.Sel.Name})
+		}
+		return false
+	})
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		var b bytes.Buffer
+		b.WriteString("\n\nimport (\n")
+		for _, path := range missing {
+			fmt.Fprintf(&b, "%q\n", path)
+		}
+		b.WriteString(")")
+		o := offset(fset, file.Name.End())
+		edits = append(edits, textEdit{start: o, end: o, text: b.String()})
+	}
+	return edits
+}
+
+// typeQualifiers returns the names used as package qualifiers in type expressions
+func typeQualifiers(file *ast.File) map[string]bool {
+	qualifiers := make(map[string]bool)
+	var typeExpr func(e ast.Expr)
+	typeExpr = func(e ast.Expr) {
+		ast.Inspect(e, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				if x, ok := n.X.(*ast.Ident); ok {
+					qualifiers[x.Name] = true
+				}
+				return false
+			case *ast.ArrayType:
+				// Array lengths are values
+				typeExpr(n.Elt)
+				return false
+			}
+			return true
+		})
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			typeExpr(n.Type)
+		case *ast.ValueSpec:
+			if n.Type != nil {
+				typeExpr(n.Type)
+			}
+		case *ast.TypeSpec:
+			typeExpr(n.Type)
+		case *ast.CompositeLit:
+			if n.Type != nil {
+				typeExpr(n.Type)
+			}
+		case *ast.TypeAssertExpr:
+			if n.Type != nil {
+				typeExpr(n.Type)
+			}
+		case *ast.TypeSwitchStmt:
+			for _, c := range n.Body.List {
+				for _, e := range c.(*ast.CaseClause).List {
+					typeExpr(e)
+				}
+			}
+		case *ast.CallExpr:
+			if fun, ok := n.Fun.(*ast.Ident); ok && (fun.Name == "make" || fun.Name == "new") && len(n.Args) > 0 {
+				typeExpr(n.Args[0])
+			}
+		}
+		return true
+	})
+	return qualifiers
+}
+
+// compilerFixes silences the errors the compiler raises on skeletons that are otherwise
+// well typed: variables left unused by anonymization and slicing, and missing returns
+func compilerFixes(fset *token.FileSet, file *ast.File, errs []types.Error) []textEdit {
+	var edits []textEdit
+	tf := fset.File(file.Pos())
+	for _, err := range errs {
+		if fset.File(err.Pos) != tf {
+			continue
+		}
+		switch {
+		case strings.Contains(err.Msg, "declared and not used"), strings.Contains(err.Msg, "declared but not used"):
+			name := identAt(file, err.Pos)
+			if name == "" {
+				continue
+			}
+			if at := usePoint(file, err.Pos); at.IsValid() {
+				o := offset(fset, at)
+				edits = append(edits, textEdit{start: o, end: o, text: "\n_ = " + name})
+			}
+		case err.Msg == "missing return":
+			o := offset(fset, err.Pos)
+			edits = append(edits, textEdit{start: o, end: o, text: "\npanic(\"unreachable\")\n"})
+		}
+	}
+	return edits
+}
+
+func identAt(file *ast.File, pos token.Pos) string {
+	var name string
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Pos() == pos {
+			name = id.Name
+		}
+		return name == ""
+	})
+	return name
+}
+
+// usePoint returns where a use of the variable declared at pos can be inserted:
+// after its declaring statement, or at the start of the body whose header declares it
+func usePoint(file *ast.File, pos token.Pos) token.Pos {
+	var at token.Pos
+	ast.Inspect(file, func(n ast.Node) bool {
+		var list []ast.Stmt
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			list = n.List
+		case *ast.CaseClause:
+			list = n.Body
+		case *ast.CommClause:
+			if n.Comm != nil && n.Comm.Pos() <= pos && pos < n.Comm.End() {
+				at = n.Colon + 1
+			}
+			list = n.Body
+		}
+		for _, s := range list {
+			if s.Pos() <= pos && pos < s.End() {
+				at = headerUsePoint(s, pos)
+			}
+		}
+		return true
+	})
+	return at
+}
+
+func headerUsePoint(s ast.Stmt, pos token.Pos) token.Pos {
+	for {
+		labeled, ok := s.(*ast.LabeledStmt)
+		if !ok {
+			break
+		}
+		s = labeled.Stmt
+	}
+	var body *ast.BlockStmt
+	clauses := false
+	switch s := s.(type) {
+	case *ast.IfStmt:
+		body = s.Body
+	case *ast.ForStmt:
+		body = s.Body
+	case *ast.RangeStmt:
+		body = s.Body
+	case *ast.SwitchStmt:
+		body, clauses = s.Body, true
+	case *ast.TypeSwitchStmt:
+		body, clauses = s.Body, true
+	}
+	if body == nil || pos >= body.Lbrace {
+		return s.End()
+	}
+	if !clauses {
+		return body.Lbrace + 1
+	}
+	if len(body.List) == 0 {
+		return token.NoPos
+	}
+	return body.List[0].(*ast.CaseClause).Colon + 1
+}
@@ -0,0 +1,145 @@
+package stubgen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	m, err := GenerateFiles([]string{"testdata/skeleton.go"}, Options{})
+	if err != nil {
+		t.Fatalf("GenerateFiles() error = %v", err)
+	}
+	if errs := m.Check(); len(errs) > 0 {
+		t.Fatalf("Check() errors = %v\nstubs:\n%s", errs, m.Files[StubFile])
+	}
+
+	skeleton := string(m.Files["skeleton.go"])
+	stubs := string(m.Files[StubFile])
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{name: "standard library imported", file: skeleton, want: `"sync/atomic"`},
+		{name: "package members flattened", file: skeleton, want: "v2 pkg0_v3"},
+		{name: "unused variable silenced", file: skeleton, want: "_ = v7"},
+		{name: "receiver type", file: stubs, want: "type type0 struct"},
+		{name: "atomic field type", file: stubs, want: "v14 int64"},
+		{name: "method from call", file: stubs, want: "Func2(p0 pkg0_v3, p1 interface{}) (r0 *pkg1_v5, r1 type1)"},
+		{name: "spawner runs goroutines", file: stubs, want: "go func() {"},
+		{name: "spawner joins goroutines", file: stubs, want: "s.stubWG.Wait()"},
+		{name: "spawner is not nil", file: stubs, want: "var Wrapper1 = &"},
+		{name: "constant", file: stubs, want: "IntConst0 = 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(tt.file, tt.want) {
+				t.Errorf("missing %q in:\n%s", tt.want, tt.file)
+			}
+		})
+	}
+}
+
+func TestGeneratePopulate(t *testing.T) {
+	src := []byte(`package skeleton
+
+func (v0 *type0) func1(v1 pkg0.v2) {
+	v0.v3.Lock()
+	defer v0.v3.Unlock()
+	for _, v4 := range v1.Func4() {
+		if v4.Func5() {
+			racyVar0 = append(racyVar0, v4)
+		}
+	}
+	v1.Func6(func(v5 *pkg0.v6) {})
+}
+`)
+	tests := []struct {
+		name     string
+		populate bool
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:    "zero values",
+			want:    []string{"type stub2 = sync.Mutex", "v3 stub2\n"},
+			notWant: []string{"r0 = "},
+		},
+		{
+			name:     "populated",
+			populate: true,
+			want:     []string{"r0 = []*stub3{new(stub3), new(stub3)}", "r0 = true", "if p0 != nil {\n\t\tp0(new(pkg0_v6))", "var racyVar0 []*stub3 = []*stub3{new(stub3), new(stub3)}"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Generate([]Source{{Name: "write1.go", Src: src}}, Options{Populate: tt.populate})
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+			if errs := m.Check(); len(errs) > 0 {
+				t.Fatalf("Check() errors = %v\nstubs:\n%s", errs, m.Files[StubFile])
+			}
+			stubs := string(m.Files[StubFile])
+			for _, want := range tt.want {
+				if !strings.Contains(stubs, want) {
+					t.Errorf("missing %q in:\n%s", want, stubs)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(stubs, notWant) {
+					t.Errorf("unexpected %q in:\n%s", notWant, stubs)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateDataset(t *testing.T) {
+	for _, name := range []string{"D10447847/read1.go", "D6645345/write1.go", "D10069435/write1.go"} {
+		t.Run(name, func(t *testing.T) {
+			m, err := GenerateFiles([]string{filepath.Join("../../data/skeletons", name)}, Options{})
+			if err != nil {
+				t.Fatalf("GenerateFiles() error = %v", err)
+			}
+			if errs := m.Check(); len(errs) > 0 {
+				t.Errorf("Check() errors = %v", errs)
+			}
+		})
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	if _, err := Generate(nil, Options{}); err == nil {
+		t.Errorf("Generate() expected error for no files")
+	}
+	if _, err := Generate([]Source{{Name: "broken.go", Src: []byte("package")}}, Options{}); err == nil {
+		t.Errorf("Generate() expected parse error")
+	}
+	srcs := []Source{
+		{Name: "a.go", Src: []byte("package skeleton\n")},
+		{Name: "b.go", Src: []byte("package other\n")},
+	}
+	if _, err := Generate(srcs, Options{}); err == nil {
+		t.Errorf("Generate() expected error for mismatched packages")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	m, err := GenerateFiles([]string{"testdata/skeleton.go"}, Options{})
+	if err != nil {
+		t.Fatalf("GenerateFiles() error = %v", err)
+	}
+	dir := filepath.Join(t.TempDir(), "skeleton"+ModuleSuffix)
+	if err := m.Write(dir); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	for _, name := range []string{"go.mod", StubFile, "skeleton.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Write() did not write %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package stubgen
+
+import (
+	"go/ast"
+)
+
+// kind is the shape of an inferred type
+type kind int
+
+const (
+	unknownKind   kind = iota
+	basicKind          // Predeclared type such as int or string
+	errorKind          // The error interface
+	interfaceKind      // The empty interface
+	namedKind          // A stub type declared in the module
+	pointerKind        // *elem
+	sliceKind          // []elem
+	arrayKind          // [length]elem
+	mapKind            // map[key]elem
+	chanKind           // chan elem
+	funcKind           // Function with sig
+	sourceKind         // A type printed verbatim, such as sync.WaitGroup or a struct literal
+)
+
+// hint records how an unknown type is used, to pick a default when nothing else is known
+type hint uint8
+
+const (
+	hintNil hint = 1 << iota
+	hintInt
+	hintFloat
+	hintString
+	hintBool
+	hintSized // Passed to len or cap
+)
+
+// term is a type in the inference, unified through union-find
+type term struct {
+	link   *term
+	kind   kind
+	name   string // Basic name, or source text for sourceKind
+	named  *named
+	elem   *term
+	key    *term
+	length string // Array length expression
+	dir    ast.ChanDir
+	sig    *signature
+	hints  hint
+}
+
+// signature is the type of a function
+type signature struct {
+	params   []*term
+	variadic bool // The last parameter is a slice passed as ...elem
+	loose    bool // Called with different arities; rendered as ...interface{}
+	results  []*term
+	fixed    bool // The number of results is known
+}
+
+// named is a stub type. Stub types get fields and methods from their uses,
+// or become an alias when they are unified with another type.
+type named struct {
+	link     *named
+	name     string
+	fields   map[string]*term
+	fieldSeq []string
+	methods  map[string]*term
+	methSeq  []string
+	declared map[string]bool // Methods declared by the skeleton itself
+	alias    *term
+	hints    hint
+	// valueRecv is set when methods are called on values that are not addressable
+	valueRecv bool
+}
+
+func find(t *term) *term {
+	for t.link != nil {
+		if t.link.link != nil {
+			t.link = t.link.link
+		}
+		t = t.link
+	}
+	return t
+}
+
+func findNamed(n *named) *named {
+	for n.link != nil {
+		n = n.link
+	}
+	return n
+}
+
+func fresh() *term {
+	return &term{}
+}
+
+func hinted(h hint) *term {
+	return &term{hints: h}
+}
+
+func basic(name string) *term {
+	return &term{kind: basicKind, name: name}
+}
+
+func pointerTo(elem *term) *term {
+	return &term{kind: pointerKind, elem: elem}
+}
+
+func sliceOf(elem *term) *term {
+	return &term{kind: sliceKind, elem: elem}
+}
+
+func namedTerm(n *named) *term {
+	return &term{kind: namedKind, named: n}
+}
+
+func funcTerm(sig *signature) *term {
+	return &term{kind: funcKind, sig: sig}
+}
+
+func newNamed(name string) *named {
+	return &named{
+		name:     name,
+		fields:   make(map[string]*term),
+		methods:  make(map[string]*term),
+		declared: make(map[string]bool),
+	}
+}
+
+// isStruct reports whether a stub type is rendered as a struct
+func (n *named) isStruct() bool {
+	return n.alias == nil && (len(n.fields) > 0 || len(n.methods) > 0)
+}
+
+// occurs reports whether v appears inside t, which would make a cyclic unnamed type
+func occurs(v, t *term) bool {
+	t = find(t)
+	if t == v {
+		return true
+	}
+	for _, child := range []*term{t.elem, t.key} {
+		if child != nil && occurs(v, child) {
+			return true
+		}
+	}
+	if t.sig != nil {
+		for _, p := range t.sig.params {
+			if occurs(v, p) {
+				return true
+			}
+		}
+		for _, r := range t.sig.results {
+			if occurs(v, r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unify makes a and b the same type where their shapes allow it.
+// Conflicting shapes are left alone; the type check of the module reports them.
+func unify(a, b *term) {
+	a, b = find(a), find(b)
+	if a == b {
+		return
+	}
+	if a.kind == unknownKind {
+		bind(a, b)
+		return
+	}
+	if b.kind == unknownKind {
+		bind(b, a)
+		return
+	}
+
+	if a.kind == namedKind || b.kind == namedKind {
+		unifyNamed(a, b)
+		return
+	}
+	if a.kind != b.kind {
+		return
+	}
+	switch a.kind {
+	case pointerKind, sliceKind, arrayKind, chanKind:
+		unify(a.elem, b.elem)
+	case mapKind:
+		unify(a.key, b.key)
+		unify(a.elem, b.elem)
+	case funcKind:
+		unifySig(a.sig, b.sig)
+	}
+}
+
+// bind resolves the unknown v to t
+func bind(v, t *term) {
+	if occurs(v, t) {
+		return
+	}
+	if t.kind == unknownKind {
+		t.hints |= v.hints
+	} else if t.kind == namedKind {
+		n := findNamed(t.named)
+		n.hints |= v.hints
+	}
+	v.link = t
+}
+
+func unifyNamed(a, b *term) {
+	if a.kind != namedKind {
+		a, b = b, a
+	}
+	na := findNamed(a.named)
+	if na.alias != nil {
+		unify(na.alias, b)
+		return
+	}
+	if b.kind == namedKind {
+		nb := findNamed(b.named)
+		if na == nb {
+			return
+		}
+		if nb.alias != nil {
+			unify(a, nb.alias)
+			return
+		}
+		mergeNamed(na, nb)
+		return
+	}
+	if na.isStruct() {
+		// A struct stub used as a pointer, interface or basic type cannot be reconciled
+		return
+	}
+	na.alias = b
+}
+
+// mergeNamed folds stub type b into a. Synthetic stubs are folded into named ones.
+func mergeNamed(a, b *named) {
+	if isSynthetic(a.name) && !isSynthetic(b.name) {
+		a, b = b, a
+	}
+	if !isSynthetic(b.name) {
+		// Both types are written in the skeleton: keep both names, b becomes an alias of a
+		b.alias = namedTerm(a)
+		moveMembers(a, b)
+		return
+	}
+	moveMembers(a, b)
+	b.link = a
+}
+
+func moveMembers(a, b *named) {
+	for _, name := range b.fieldSeq {
+		if f, ok := a.fields[name]; ok {
+			unify(f, b.fields[name])
+		} else {
+			a.addField(name, b.fields[name])
+		}
+	}
+	for _, name := range b.methSeq {
+		if m, ok := a.methods[name]; ok {
+			unify(m, b.methods[name])
+		} else {
+			a.addMethod(name, b.methods[name])
+		}
+		if b.declared[name] {
+			a.declared[name] = true
+		}
+	}
+	a.hints |= b.hints
+	a.valueRecv = a.valueRecv || b.valueRecv
+	b.fields, b.fieldSeq = make(map[string]*term), nil
+	b.methods, b.methSeq = make(map[string]*term), nil
+}
+
+func (n *named) addField(name string, t *term) {
+	n.fields[name] = t
+	n.fieldSeq = append(n.fieldSeq, name)
+}
+
+func (n *named) addMethod(name string, t *term) {
+	n.methods[name] = t
+	n.methSeq = append(n.methSeq, name)
+}
+
+// assign unifies the type of a value with the type it is assigned to.
+// Anything is assignable to the empty interface, so that is not unified.
+func assign(dst, src *term) {
+	if resolve(dst).kind == interfaceKind {
+		return
+	}
+	unify(dst, src)
+}
+
+func unifySig(a, b *signature) {
+	if len(a.params) == len(b.params) && a.variadic == b.variadic {
+		for i := range a.params {
+			unify(a.params[i], b.params[i])
+		}
+	} else {
+		a.loose, b.loose = true, true
+	}
+	if len(a.results) == len(b.results) {
+		for i := range a.results {
+			unify(a.results[i], b.results[i])
+		}
+	}
+}
@@ -27,6 +27,22 @@ FileStats = Dict[str, int]
 PatternStats = Dict[str, int]
 AnalysisResult = Tuple[str, str, Optional[str]]  # (file_path, status, code_line)
 
+# Suffix of the stub modules cmd/stubgen writes next to skeletons
+MODULE_SUFFIX = ".module"
+
+def walk_skeletons(skeletons_dir: str):
+    """Walk the skeletons directory like os.walk, skipping generated stub modules.
+    
+    Args:
+        skeletons_dir: Path to the skeletons directory
+        
+    Yields:
+        Tuple[str, List[str], List[str]]: Directory path, subdirectories and files
+    """
+    for root, dirs, files in os.walk(skeletons_dir):
+        dirs[:] = [d for d in dirs if not d.endswith(MODULE_SUFFIX)]
+        yield root, dirs, files
+
 def parse_args() -> argparse.Namespace:
     """Parse command line arguments for skeleton verification.
     
@@ -84,7 +100,7 @@ def rename_files(skeletons_dir: str) -> int:
         int: Number of files renamed
     """
     rename_count = 0
-    for root, _, files in os.walk(skeletons_dir):
+    for root, _, files in walk_skeletons(skeletons_dir):
         for filename in files:
             file_path = os.path.join(root, filename)
             new_filename = normalize_filename(filename)
@@ -182,7 +198,7 @@ def check_files(skeletons_dir: str) -> Tuple[Dict[str, str], Set[str], FileStats
         'package_updates': 0
     }
 
-    for root, _, files in os.walk(skeletons_dir):
+    for root, _, files in walk_skeletons(skeletons_dir):
         for filename in files:
             if filename.endswith(".go"):
                 stats['total_files'] += 1
@@ -262,7 +278,7 @@ def create_final_combined_file(skeletons_dir: str, output_file: str) -> None:
         os.makedirs(output_dir)
         
     with open(output_file, "w") as final_file:
-        for root, _, files in os.walk(skeletons_dir):
+        for root, _, files in walk_skeletons(skeletons_dir):
             for filename in sorted(files):
                 if filename.endswith(".go"):
                     file_path = os.path.join(root, filename)
@@ -347,6 +363,8 @@ def analyze_directory_pairs(skeletons_dir: str, output_csv: str) -> None:
             'file2_line',                 # Line containing racy variable in second file
             'has_write',                  # TRUE if either file contains a write to a racy variable
             'race_type',                  # Type of race (read-write or write-write)
+            'patterns',                   # Race patterns matched by either file, most confident first
+            'pattern_confidence',         # Confidence of each pattern, in the same order
             'file1_size',                 # Size of first file in bytes
             'file2_size',                 # Size of second file in bytes
             'file1_line_count',           # Number of lines in first file
@@ -372,6 +390,9 @@ def analyze_directory_pairs(skeletons_dir: str, output_csv: str) -> None:
             # Determine race type
             race_type = determine_race_type(file1_path, file2_path)
             
+            # Combine the race patterns of both files
+            pattern_names, pattern_confidences = pattern_columns(merge_patterns(result1, result2))
+            
             # Get any error messages
             error_msg = ""
             if result1.get("error"):
@@ -389,6 +410,8 @@ def analyze_directory_pairs(skeletons_dir: str, output_csv: str) -> None:
                 result2.get("line_content", ""),
                 has_write,
                 race_type,
+                pattern_names,
+                pattern_confidences,
                 file1_stats['size'],
                 file2_stats['size'],
                 file1_stats['line_count'],
@@ -402,6 +425,36 @@ def analyze_directory_pairs(skeletons_dir: str, output_csv: str) -> None:
     
     print(f"Analysis results written to {output_csv}")
 
+def merge_patterns(*results: Dict[str, Any]) -> List[Tuple[str, float]]:
+    """Merge the race patterns reported by the analyzer for the files of a case.
+    
+    Args:
+        results: Analyzer results of the files
+        
+    Returns:
+        List of (pattern, confidence) pairs, keeping the highest confidence of
+        each pattern, sorted by decreasing confidence
+    """
+    merged: Dict[str, float] = {}
+    for result in results:
+        for match in result.get("patterns") or []:
+            name = match.get("pattern", "")
+            merged[name] = max(merged.get(name, 0.0), match.get("confidence", 0.0))
+    return sorted(merged.items(), key=lambda item: (-item[1], item[0]))
+
+def pattern_columns(patterns: List[Tuple[str, float]]) -> Tuple[str, str]:
+    """Format merged race patterns as the patterns and confidences CSV columns.
+    
+    Args:
+        patterns: (pattern, confidence) pairs returned by merge_patterns
+        
+    Returns:
+        Tuple of the ';'-separated pattern names and confidences
+    """
+    names = ";".join(name for name, _ in patterns)
+    confidences = ";".join(f"{confidence:.2f}" for _, confidence in patterns)
+    return names, confidences
+
 def determine_race_type(file1_path: str, file2_path: str) -> str:
     """Determine the type of race (read-write or write-write) by analyzing the files.
     
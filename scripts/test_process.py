@@ -5,6 +5,7 @@ This module contains tests for the main functionality of process.py,
 including argument parsing and file processing.
 """
 
+import json
 import os
 import tempfile
 import pytest
@@ -14,7 +15,10 @@ from process import (
     create_final_combined_file,
     normalize_filename,
     ensure_package_declaration,
-    remove_line_comments
+    remove_line_comments,
+    walk_skeletons,
+    merge_patterns,
+    pattern_columns
 )
 
 def test_parse_args(monkeypatch):
@@ -149,4 +153,57 @@ def test_create_final_combined_file():
                 assert f'// {os.path.join(input_dir, filename)}' in content
             
             # Check that content is in sorted order
-            assert content.find('func a()') < content.find('func b()') < content.find('func c()') 
\ No newline at end of file
+            assert content.find('func a()') < content.find('func b()') < content.find('func c()') 
+
+def test_walk_skeletons_skips_modules():
+    """Test that generated stub modules are not walked as skeletons."""
+    with tempfile.TemporaryDirectory() as tmpdir:
+        case_dir = os.path.join(tmpdir, 'D1')
+        module_dir = os.path.join(case_dir, 'read1.module')
+        os.makedirs(module_dir)
+        for path in [os.path.join(case_dir, 'read1.go'), os.path.join(module_dir, 'stubs.go')]:
+            with open(path, 'w') as f:
+                f.write('package skeleton\n')
+
+        walked = [os.path.join(root, f) for root, _, files in walk_skeletons(tmpdir) for f in files]
+        assert walked == [os.path.join(case_dir, 'read1.go')]
+
+def test_merge_patterns():
+    """Test pattern merging on the matches of TestMerge in internal/patterns.
+
+    Verifies that each pattern keeps its highest confidence, and that the
+    patterns are sorted by decreasing confidence, then by name.
+    """
+    a = {'patterns': [{'pattern': 'captured-variable-write', 'confidence': 0.7}]}
+    b = {'patterns': [
+        {'pattern': 'loop-variable-capture', 'confidence': 0.9},
+        {'pattern': 'captured-variable-write', 'confidence': 0.8}
+    ]}
+    assert merge_patterns(a, b) == [('loop-variable-capture', 0.9), ('captured-variable-write', 0.8)]
+    assert merge_patterns(a, {'patterns': None}, {'error': 'parse error'}) == [('captured-variable-write', 0.7)]
+
+def test_pattern_columns_of_fixtures():
+    """Test the CSV pattern columns of the cases in testdata.
+
+    Each case holds skeleton files with the analyzer output for each file,
+    and the expected columns are the patterns cmd/export merges for the case.
+    """
+    testdata_dir = os.path.join(os.path.dirname(os.path.abspath(__file__)), 'testdata')
+    # Test cases: (case, expected patterns, expected confidences)
+    test_cases = [
+        # The higher confidence of a pattern reported by both files is kept
+        ('D5922069', 'slice-header-reassignment;struct-field-receiver', '0.90;0.80'),
+        ('D5949389', 'struct-field-receiver;unsynchronized-lazy-init', '0.80;0.50'),
+        # Patterns of equal confidence are sorted by name
+        ('D7263551', 'captured-variable-write;loop-variable-capture', '0.70;0.70')
+    ]
+
+    for case, names, confidences in test_cases:
+        case_dir = os.path.join(testdata_dir, case)
+        results = []
+        for filename in sorted(os.listdir(case_dir)):
+            if filename.endswith('.json'):
+                with open(os.path.join(case_dir, filename)) as f:
+                    results.append(json.load(f))
+        assert len(results) == 2, case
+        assert pattern_columns(merge_patterns(*results)) == (names, confidences), case
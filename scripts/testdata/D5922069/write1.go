@@ -0,0 +1,6 @@
+package skeleton
+
+func (v0 *type0) func1(_ pkg0.v1, _ pkg1.v2) (<-chan *pkg1.v3, type1) {
+	v0.racyVar0 = append(v0.racyVar0, v4)
+	return v4, nil
+}
\ No newline at end of file